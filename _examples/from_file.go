@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
 )
@@ -18,17 +19,21 @@ func main() {
 		panic(err)
 	}
 	p := parser.NewParser(tokens)
-	rootNode := p.Parse()
+	rootNode, err := p.Parse()
+	if err != nil {
+		panic(err)
+	}
 	reconstruct := rootNode.Reconstruct()
-	for rootNode != nil {
-		fmt.Printf("Stage:  %s\n", rootNode.Identifier)
-		if len(rootNode.Instructions) > 0 {
-			for _, instr := range rootNode.Instructions {
-				fmt.Printf("InstructionNode: %s\n", reflect.TypeOf(instr))
-			}
+	ast.Inspect(rootNode, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case nil:
+		case *ast.StageNode:
+			fmt.Printf("Stage:  %s\n", node.Identifier)
+		default:
+			fmt.Printf("InstructionNode: %s\n", reflect.TypeOf(node))
 		}
-		rootNode = rootNode.Subsequent
-	}
+		return true
+	})
 
 	for _, l := range reconstruct {
 		fmt.Println(l)
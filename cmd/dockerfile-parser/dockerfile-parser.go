@@ -1,19 +1,166 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/report"
 	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/wrapper"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/format"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFormat(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:], os.Stdout))
+	}
+	os.Exit(runParse(os.Args[1:]))
+}
+
+// dockerfile-parser [flags] <path>
+// A path of - reads from stdin
+// Exits with 2 if the flags are invalid
+func runParse(args []string) int {
 	startTime := time.Now()
-	recursive := slices.Contains(os.Args, "-r")
-	output := slices.Contains(os.Args, "-o")
-	count := wrapper.ParsePath(os.Args[len(os.Args)-1], recursive, output)
+	flags := flag.NewFlagSet("dockerfile-parser", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "search directories recursively")
+	output := flags.Bool("o", false, "write the reconstructed files to ./out")
+	outputFormat := flags.String("format", wrapper.TextFormat, "output format: "+strings.Join(wrapper.Formats, ", "))
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || !slices.Contains(wrapper.Formats, *outputFormat) {
+		fmt.Fprintln(os.Stderr, "usage: dockerfile-parser [flags] <path>")
+		flags.PrintDefaults()
+		return 2
+	}
+	count := wrapper.ParsePath(flags.Arg(0), *recursive, *output, *outputFormat)
 	diff := time.Now().Sub(startTime)
-	fmt.Printf("Parsing %d files finished in %v\n", count, diff)
+	// Keep stdout machine readable
+	summary := os.Stdout
+	if *outputFormat == wrapper.JSONFormat {
+		summary = os.Stderr
+	}
+	fmt.Fprintf(summary, "Parsing %d files finished in %v\n", count, diff)
+	return 0
+}
+
+// dockerfile-parser fmt [flags] <paths>
+// A path of - reads from stdin
+// Exits with 1 if --check found unformatted files and with 2 if files could not be processed
+func runFormat(args []string) int {
+	defaults := format.DefaultOptions()
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "print a diff and exit non-zero if a file is not formatted")
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	recursive := flags.Bool("r", false, "search directories recursively")
+	width := flags.Int("width", defaults.LineWidth, "maximum line width before RUN chains are wrapped (0 disables wrapping)")
+	separation := flags.Int("stage-separation", defaults.StageSeparation, "blank lines between stages (negative keeps them as they are)")
+	noAlign := flags.Bool("no-align", false, "keep multi pair ENV and LABEL instructions on a single line")
+	keepCase := flags.Bool("keep-case", false, "keep the casing of keywords")
+	flags.Parse(args)
+
+	opts := defaults
+	opts.LineWidth = *width
+	opts.StageSeparation = *separation
+	opts.AlignPairs = !*noAlign
+	opts.UppercaseKeywords = !*keepCase
+	opts.UppercaseAs = !*keepCase
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: dockerfile-parser fmt [flags] <paths>")
+		flags.PrintDefaults()
+		return 2
+	}
+	unformatted, failed := 0, 0
+	for _, path := range flags.Args() {
+		u, f := wrapper.FormatPath(path, *recursive, *check, *write, opts)
+		unformatted += u
+		failed += f
+	}
+	if failed != 0 {
+		return 2
+	}
+	if *check && unformatted != 0 {
+		return 1
+	}
+	return 0
+}
+
+// dockerfile-parser lint [flags] <paths>
+// A path of - reads from stdin
+// The report is written to stdout
+// Exits with 1 if a finding reaches the --fail-level and with 2 if files could not be processed
+func runLint(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "search directories recursively")
+	outputFormat := flags.String("format", report.TextFormat, "output format: "+strings.Join(report.Formats, ", "))
+	failLevel := flags.String("fail-level", diagnostic.Error.String(), "lowest severity that results in a non-zero exit code: error, warning, info or none")
+	disable := flags.String("disable", "", "comma separated codes of rules that are not run")
+	severities := flags.String("severity", "", "comma separated severity overrides, e.g. DL3007=error,DL3000=info")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 || !slices.Contains(report.Formats, *outputFormat) {
+		fmt.Fprintln(os.Stderr, "usage: dockerfile-parser lint [flags] <paths>")
+		flags.PrintDefaults()
+		return 2
+	}
+	cfg := lint.Config{Severities: map[string]diagnostic.Severity{}}
+	for _, code := range strings.Split(*disable, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			cfg.Disabled = append(cfg.Disabled, code)
+		}
+	}
+	for _, override := range strings.Split(*severities, ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		code, name, _ := strings.Cut(override, "=")
+		severity, err := diagnostic.ParseSeverity(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid severity override %q: %s\n", override, err.Error())
+			return 2
+		}
+		cfg.Severities[strings.TrimSpace(code)] = severity
+	}
+	// Severities are ordered from error to info, none never fails
+	threshold := diagnostic.Severity(-1)
+	if *failLevel != "none" {
+		severity, err := diagnostic.ParseSeverity(*failLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid fail level: %s\n", err.Error())
+			return 2
+		}
+		threshold = severity
+	}
+
+	files, failed := []report.File{}, 0
+	for _, path := range flags.Args() {
+		f, n := wrapper.LintPath(path, *recursive, cfg)
+		files = append(files, f...)
+		failed += n
+	}
+	if err := report.Write(stdout, *outputFormat, files); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing the report failed: %s\n", err.Error())
+		return 2
+	}
+	if failed != 0 {
+		return 2
+	}
+	for _, file := range files {
+		for _, d := range file.Diagnostics {
+			if d.Severity <= threshold {
+				return 1
+			}
+		}
+	}
+	return 0
 }
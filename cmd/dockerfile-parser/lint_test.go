@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	// Reports DL3006 and DL3002, both warnings by default
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Writing the Dockerfile failed: %s", err.Error())
+	}
+	tests := []struct {
+		Args     []string
+		Expected int
+	}{
+		{Args: []string{path}, Expected: 0},
+		{Args: []string{"--fail-level", "error", path}, Expected: 0},
+		{Args: []string{"--fail-level", "warning", path}, Expected: 1},
+		{Args: []string{"--fail-level=info", path}, Expected: 1},
+		{Args: []string{"--fail-level", "none", path}, Expected: 0},
+		{Args: []string{"--severity", "DL3006=error", path}, Expected: 1},
+		{Args: []string{"--severity", "DL3006=error", "--fail-level", "none", path}, Expected: 0},
+		{Args: []string{"--severity", "DL3006=info,DL3002=info", "--fail-level", "warning", path}, Expected: 0},
+		{Args: []string{"--severity", "DL3006=info,DL3002=info", "--fail-level", "info", path}, Expected: 1},
+		{Args: []string{"--disable", "DL3006,DL3002", "--fail-level", "info", path}, Expected: 0},
+		{Args: []string{"-r", "--fail-level", "warning", dir}, Expected: 1},
+		{Args: []string{"--fail-level", "fatal", path}, Expected: 2},
+		{Args: []string{"--severity", "DL3006=fatal", path}, Expected: 2},
+		{Args: []string{"--format", "yaml", path}, Expected: 2},
+		{Args: []string{filepath.Join(dir, "missing.Dockerfile")}, Expected: 2},
+		{Args: []string{}, Expected: 2},
+	}
+	for _, tc := range tests {
+		var stdout bytes.Buffer
+		if got := runLint(tc.Args, &stdout); got != tc.Expected {
+			t.Errorf("Exit code mismatch for %v: Expected %d Got %d", tc.Args, tc.Expected, got)
+		}
+	}
+}
+
+func TestLintJSONOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine:3\nUSER app\n"), 0644); err != nil {
+		t.Fatalf("Writing the Dockerfile failed: %s", err.Error())
+	}
+	var stdout bytes.Buffer
+	if got := runLint([]string{"--format=json", path}, &stdout); got != 0 {
+		t.Fatalf("Exit code mismatch: Expected %d Got %d", 0, got)
+	}
+	files := []struct {
+		Path        string            `json:"path"`
+		Diagnostics []json.RawMessage `json:"diagnostics"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &files); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	if len(files) != 1 || files[0].Path != path || len(files[0].Diagnostics) != 0 {
+		t.Errorf("Output mismatch: Expected %s without findings Got %s", path, stdout.String())
+	}
+}
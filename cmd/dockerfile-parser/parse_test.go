@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseUsage(t *testing.T) {
+	tests := []struct {
+		Args     []string
+		Expected int
+	}{
+		{Args: []string{"--format", "yaml", "Dockerfile"}, Expected: 2},
+		{Args: []string{"--format=yaml", "Dockerfile"}, Expected: 2},
+		{Args: []string{"--format=json"}, Expected: 2},
+		{Args: []string{"a.Dockerfile", "b.Dockerfile"}, Expected: 2},
+		{Args: []string{}, Expected: 2},
+	}
+	for _, tc := range tests {
+		if got := runParse(tc.Args); got != tc.Expected {
+			t.Errorf("Exit code mismatch for %v: Expected %d Got %d", tc.Args, tc.Expected, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const context = 3
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	a, b int // line index in the old and new input
+}
+
+// Line based unified diff of the inputs
+// Returns an empty string if the inputs are equal
+func Unified(fromName, toName string, a, b []string) string {
+	ops := compute(a, b)
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// Extend the hunk until there are more than two context blocks worth of unchanged lines
+		first := max(start-context, 0)
+		last := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*context {
+				break
+			}
+		}
+		end := min(last+context+1, len(ops))
+		if sb.Len() == 0 {
+			sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+		sb.WriteString(header(ops[first:end]))
+		for _, o := range ops[first:end] {
+			sb.WriteString(fmt.Sprintf("%c%s\n", o.kind, o.line))
+		}
+		start = end
+	}
+	return sb.String()
+}
+
+func header(ops []op) string {
+	aStart, bStart, aCount, bCount := ops[0].a+1, ops[0].b+1, 0, 0
+	for _, o := range ops {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+	// Empty ranges refer to the line before the change
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+}
+
+// Edit script based on the longest common subsequence
+// Dockerfiles are small enough for the quadratic approach
+func compute(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := []op{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{kind: ' ', line: a[i], a: i, b: j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{kind: '-', line: a[i], a: i, b: j})
+			i++
+		default:
+			ops = append(ops, op{kind: '+', line: b[j], a: i, b: j})
+			j++
+		}
+	}
+	return ops
+}
@@ -7,11 +7,16 @@ import (
 )
 
 func DisplayAst(root *ast.StageNode) {
-	for root != nil {
-		fmt.Println(root.ToString())
-		for _, instruction := range root.Instructions {
-			fmt.Println(fmt.Sprintf(" > %s", instruction.ToString()))
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case nil:
+		case *ast.StageNode:
+			fmt.Println(node.ToString())
+		default:
+			fmt.Println(fmt.Sprintf(" > %s", node.ToString()))
+			// The trigger is part of the ONBUILD output
+			return false
 		}
-		root = root.Subsequent
-	}
+		return true
+	})
 }
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type checkstyleLog struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func writeCheckstyle(w io.Writer, files []File) error {
+	log := checkstyleLog{Version: "4.3", Files: []checkstyleFile{}}
+	for _, file := range files {
+		entry := checkstyleFile{Name: file.Path, Errors: []checkstyleError{}}
+		for _, d := range file.Diagnostics {
+			entry.Errors = append(entry.Errors, checkstyleError{
+				Line:     d.Start.Line,
+				Column:   d.Start.Column,
+				Severity: d.Severity.String(),
+				Message:  d.Message,
+				Source:   toolName + "." + d.Code,
+			})
+		}
+		log.Files = append(log.Files, entry)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,54 @@
+// Package writing lint results in the formats supported by the cli
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+)
+
+// Supported output formats
+const (
+	TextFormat       = "text"
+	JSONFormat       = "json"
+	SARIFFormat      = "sarif"
+	CheckstyleFormat = "checkstyle"
+)
+
+var Formats = []string{TextFormat, JSONFormat, SARIFFormat, CheckstyleFormat}
+
+// Findings of a single file
+type File struct {
+	Path        string          `json:"path"`
+	Diagnostics diagnostic.List `json:"diagnostics"`
+}
+
+// Write the findings in the format
+func Write(w io.Writer, format string, files []File) error {
+	switch format {
+	case TextFormat:
+		return writeText(w, files)
+	case JSONFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(files)
+	case SARIFFormat:
+		return writeSARIF(w, files)
+	case CheckstyleFormat:
+		return writeCheckstyle(w, files)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func writeText(w io.Writer, files []File) error {
+	for _, file := range files {
+		for _, d := range file.Diagnostics {
+			if _, err := fmt.Fprintf(w, "%s:%s\n", file.Path, d.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/report"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
+)
+
+var files = []report.File{
+	{
+		Path: "a.Dockerfile",
+		Diagnostics: diagnostic.List{
+			{Severity: diagnostic.Warning, Code: lint.UntaggedImage, Message: "untagged", Start: token.Position{Line: 1, Column: 1}, End: token.Position{Line: 1, Column: 12}},
+			{Severity: diagnostic.Error, Code: diagnostic.UnknownFlag, Message: "unknown <flag>"},
+		},
+	},
+	{
+		Path: "dir/b.Dockerfile",
+		Diagnostics: diagnostic.List{
+			{Severity: diagnostic.Info, Code: lint.UntaggedImage, Message: "untagged", Start: token.Position{Line: 3, Column: 2}, End: token.Position{Line: 4, Column: 5}},
+		},
+	},
+	{Path: "clean.Dockerfile", Diagnostics: diagnostic.List{}},
+}
+
+func write(t *testing.T, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := report.Write(&buf, format, files); err != nil {
+		t.Fatalf("Writing %s failed: %s", format, err.Error())
+	}
+	return buf.Bytes()
+}
+
+func TestText(t *testing.T) {
+	expected := "a.Dockerfile:1:1: warning: untagged [DL3006]\n" +
+		"a.Dockerfile:0:0: error: unknown <flag> [unknown-flag]\n" +
+		"dir/b.Dockerfile:3:2: info: untagged [DL3006]\n"
+	if got := string(write(t, report.TextFormat)); got != expected {
+		t.Errorf("Text mismatch: Expected %q Got %q", expected, got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	decoded := []report.File{}
+	if err := json.Unmarshal(write(t, report.JSONFormat), &decoded); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(decoded, files) {
+		t.Errorf("JSON mismatch: Expected %v Got %v", files, decoded)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	type region struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+		EndLine     int `json:"endLine"`
+		EndColumn   int `json:"endColumn"`
+	}
+	type result struct {
+		RuleID    string `json:"ruleId"`
+		RuleIndex *int   `json:"ruleIndex"`
+		Level     string `json:"level"`
+		Message   struct {
+			Text string `json:"text"`
+		} `json:"message"`
+		Locations []struct {
+			PhysicalLocation struct {
+				ArtifactLocation struct {
+					URI string `json:"uri"`
+				} `json:"artifactLocation"`
+				Region *region `json:"region"`
+			} `json:"physicalLocation"`
+		} `json:"locations"`
+	}
+	type rule struct {
+		ID               string `json:"id"`
+		ShortDescription *struct {
+			Text string `json:"text"`
+		} `json:"shortDescription"`
+		DefaultConfiguration *struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+	log := struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []rule `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []result `json:"results"`
+		} `json:"runs"`
+	}{}
+	if err := json.Unmarshal(write(t, report.SARIFFormat), &log); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	if log.Version != "2.1.0" || log.Schema != "https://json.schemastore.org/sarif-2.1.0.json" {
+		t.Errorf("Version mismatch: Expected %s Got %s (%s)", "2.1.0", log.Version, log.Schema)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("Run count mismatch: Expected %d Got %d", 1, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "dockerfile-parser" {
+		t.Errorf("Tool name mismatch: Expected %s Got %s", "dockerfile-parser", run.Tool.Driver.Name)
+	}
+
+	// Every code is listed once, in order of appearance
+	rules := run.Tool.Driver.Rules
+	if len(rules) != 2 || rules[0].ID != lint.UntaggedImage || rules[1].ID != diagnostic.UnknownFlag {
+		t.Fatalf("Rules mismatch: Expected [%s %s] Got %v", lint.UntaggedImage, diagnostic.UnknownFlag, rules)
+	}
+	if rules[0].ShortDescription == nil || rules[0].ShortDescription.Text == "" {
+		t.Errorf("Expected a description for lint rule %s", rules[0].ID)
+	}
+	if rules[0].DefaultConfiguration == nil || rules[0].DefaultConfiguration.Level != "warning" {
+		t.Errorf("Default level mismatch: Expected %s Got %v", "warning", rules[0].DefaultConfiguration)
+	}
+	if rules[1].ShortDescription != nil || rules[1].DefaultConfiguration != nil {
+		t.Errorf("Expected no metadata for parser diagnostic %s", rules[1].ID)
+	}
+
+	expected := []struct {
+		ruleID    string
+		ruleIndex int
+		level     string
+		uri       string
+		region    *region
+	}{
+		{lint.UntaggedImage, 0, "warning", "a.Dockerfile", &region{StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 12}},
+		{diagnostic.UnknownFlag, 1, "error", "a.Dockerfile", nil},
+		{lint.UntaggedImage, 0, "note", "dir/b.Dockerfile", &region{StartLine: 3, StartColumn: 2, EndLine: 4, EndColumn: 5}},
+	}
+	if len(run.Results) != len(expected) {
+		t.Fatalf("Result count mismatch: Expected %d Got %d", len(expected), len(run.Results))
+	}
+	for i, e := range expected {
+		r := run.Results[i]
+		if r.RuleID != e.ruleID {
+			t.Errorf("%d: Rule id mismatch: Expected %s Got %s", i, e.ruleID, r.RuleID)
+		}
+		if r.RuleIndex == nil || *r.RuleIndex != e.ruleIndex {
+			t.Errorf("%d: Rule index mismatch: Expected %d Got %v", i, e.ruleIndex, r.RuleIndex)
+		}
+		if r.Level != e.level {
+			t.Errorf("%d: Level mismatch: Expected %s Got %s", i, e.level, r.Level)
+		}
+		if len(r.Locations) != 1 {
+			t.Fatalf("%d: Location count mismatch: Expected %d Got %d", i, 1, len(r.Locations))
+		}
+		location := r.Locations[0].PhysicalLocation
+		if location.ArtifactLocation.URI != e.uri {
+			t.Errorf("%d: Uri mismatch: Expected %s Got %s", i, e.uri, location.ArtifactLocation.URI)
+		}
+		if !reflect.DeepEqual(location.Region, e.region) {
+			t.Errorf("%d: Region mismatch: Expected %v Got %v", i, e.region, location.Region)
+		}
+	}
+}
+
+func TestCheckstyle(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="a.Dockerfile">
+    <error line="1" column="1" severity="warning" message="untagged" source="dockerfile-parser.DL3006"></error>
+    <error line="0" severity="error" message="unknown &lt;flag&gt;" source="dockerfile-parser.unknown-flag"></error>
+  </file>
+  <file name="dir/b.Dockerfile">
+    <error line="3" column="2" severity="info" message="untagged" source="dockerfile-parser.DL3006"></error>
+  </file>
+  <file name="clean.Dockerfile"></file>
+</checkstyle>
+`
+	if got := string(write(t, report.CheckstyleFormat)); got != expected {
+		t.Errorf("Checkstyle mismatch: Expected %s Got %s", expected, got)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report.Write(&buf, "yaml", files); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "dockerfile-parser"
+	toolURI      = "https://github.com/coffeemakingtoaster/dockerfile-parser"
+)
+
+// Subset of the SARIF 2.1.0 object model that is required for code scanning
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     *sarifMessage      `json:"shortDescription,omitempty"`
+	DefaultConfiguration *sarifRuleDefaults `json:"defaultConfiguration,omitempty"`
+}
+
+type sarifRuleDefaults struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+func sarifLevel(s diagnostic.Severity) string {
+	switch s {
+	case diagnostic.Error:
+		return "error"
+	case diagnostic.Warning:
+		return "warning"
+	}
+	return "note"
+}
+
+func writeSARIF(w io.Writer, files []File) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: toolName, InformationURI: toolURI, Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	ruleIndex := func(code string) int {
+		if i := slices.IndexFunc(run.Tool.Driver.Rules, func(r sarifRule) bool { return r.ID == code }); i != -1 {
+			return i
+		}
+		rule := sarifRule{ID: code}
+		// Diagnostics of the lexer and parser are not backed by a lint rule
+		if registered, ok := lint.Lookup(code); ok {
+			rule.ShortDescription = &sarifMessage{Text: registered.Description()}
+			rule.DefaultConfiguration = &sarifRuleDefaults{Level: sarifLevel(registered.DefaultSeverity())}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		return len(run.Tool.Driver.Rules) - 1
+	}
+	for _, file := range files {
+		for _, d := range file.Diagnostics {
+			location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(file.Path)},
+			}}
+			if d.Start.Line > 0 {
+				region := &sarifRegion{StartLine: d.Start.Line, StartColumn: d.Start.Column}
+				if d.End.Line >= d.Start.Line {
+					region.EndLine, region.EndColumn = d.End.Line, d.End.Column
+				}
+				location.PhysicalLocation.Region = region
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    d.Code,
+				RuleIndex: ruleIndex(d.Code),
+				Level:     sarifLevel(d.Severity),
+				Message:   sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
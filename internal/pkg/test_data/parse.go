@@ -0,0 +1,26 @@
+package testdata
+
+import (
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+)
+
+// Lex and parse the lines of a Dockerfile, the test fails if the input can not be parsed
+// The lines are used as they are, unlike dockerfile.Parse they are not read from a reader
+func Parse(t *testing.T, input []string) *ast.StageNode {
+	t.Helper()
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	return root
+}
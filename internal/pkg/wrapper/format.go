@@ -0,0 +1,64 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/diff"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/format"
+)
+
+// Format the files at the path
+// check prints a diff instead of the formatted file, write replaces the file with the formatted version
+// Returns the number of files that were not formatted and the number of files that could not be processed
+func FormatPath(path string, recursive, check, write bool, opts format.Options) (int, int) {
+	isFile, err := isFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err.Error())
+		return 0, 1
+	}
+	paths := []string{path}
+	if !isFile {
+		paths = findDockerfiles(path, recursive)
+	}
+	unformatted, failed := 0, 0
+	for _, p := range paths {
+		changed, err := formatFile(p, check, write, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", p, err.Error())
+			failed++
+			continue
+		}
+		if changed {
+			unformatted++
+		}
+	}
+	return unformatted, failed
+}
+
+func formatFile(path string, check, write bool, opts format.Options) (bool, error) {
+	if write && path == StdinPath {
+		return false, fmt.Errorf("cannot write the formatted result to stdin")
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return false, err
+	}
+	formatted, err := format.Source(lines, opts)
+	if err != nil {
+		return false, err
+	}
+	changed := diff.Unified(path, path+" (formatted)", lines, formatted)
+	switch {
+	case check:
+		fmt.Print(changed)
+	case write:
+		if changed != "" {
+			return true, os.WriteFile(path, []byte(strings.Join(formatted, "\n")+"\n"), 0644)
+		}
+	default:
+		fmt.Println(strings.Join(formatted, "\n"))
+	}
+	return changed != "", nil
+}
@@ -0,0 +1,55 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/report"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+)
+
+// Lint the files at the path
+// Diagnostics of the lexer and parser are reported next to the findings of the rules
+// Returns the findings per file and the number of files that could not be read
+func LintPath(path string, recursive bool, cfg lint.Config) ([]report.File, int) {
+	isFile, err := isFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err.Error())
+		return nil, 1
+	}
+	paths := []string{path}
+	if !isFile {
+		paths = findDockerfiles(path, recursive)
+	}
+	files, failed := []report.File{}, 0
+	for _, p := range paths {
+		diagnostics, err := lintFile(p, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", p, err.Error())
+			failed++
+			continue
+		}
+		files = append(files, report.File{Path: p, Diagnostics: diagnostics})
+	}
+	return files, failed
+}
+
+func lintFile(path string, cfg lint.Config) (diagnostic.List, error) {
+	l, err := newLexer(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := l.Lex()
+	if err != nil {
+		return l.Diagnostics(), nil
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	diagnostics := append(l.Diagnostics(), p.Diagnostics()...)
+	if err != nil {
+		return diagnostics, nil
+	}
+	return append(diagnostics, lint.Lint(root, cfg)...), nil
+}
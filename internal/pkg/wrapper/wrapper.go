@@ -1,6 +1,7 @@
 package wrapper
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,26 +9,50 @@ import (
 
 	"github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/display"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
 )
 
-func ParsePath(path string, recursive, output bool) int {
+// Output formats of ParsePath
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+var Formats = []string{TextFormat, JSONFormat}
+
+// Path that reads the Dockerfile from stdin
+const StdinPath = "-"
+
+func ParsePath(path string, recursive, output bool, format string) int {
 	isFile, err := isFile(path)
 	if err != nil {
 		panic(err)
 	}
-	if isFile {
-		parseAndDisplayFileList([]string{path}, output)
-		return 1
+	paths := []string{path}
+	if !isFile {
+		paths = findDockerfiles(path, recursive)
+	}
+	if format == JSONFormat {
+		parseAndEncodeFileList(paths, output)
 	} else {
-		paths := buildDirPathList(path, recursive)
 		parseAndDisplayFileList(paths, output)
-		return len(paths)
 	}
+	return len(paths)
 }
 
-// Only looks for files ending with .Dockerfile
+// Dockerfiles in the directory, prints a message if there are none
+func findDockerfiles(dir string, recursive bool) []string {
+	paths := buildDirPathList(dir, recursive)
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: no Dockerfile found (looking for Dockerfile, Dockerfile.* and *.Dockerfile)\n", dir)
+	}
+	return paths
+}
+
+// Looks for files named Dockerfile, Dockerfile.* or *.Dockerfile
 func buildDirPathList(basePath string, recursive bool) []string {
 	res := []string{}
 	entries, err := os.ReadDir(basePath)
@@ -41,14 +66,21 @@ func buildDirPathList(basePath string, recursive bool) []string {
 				subFiles := buildDirPathList(fullPath, recursive)
 				res = append(res, subFiles...)
 			}
-		} else if strings.HasSuffix(entry.Name(), ".Dockerfile") {
+		} else if isDockerfileName(entry.Name()) {
 			res = append(res, fullPath)
 		}
 	}
 	return res
 }
 
+func isDockerfileName(name string) bool {
+	return name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".Dockerfile")
+}
+
 func isFile(path string) (bool, error) {
+	if path == StdinPath {
+		return true, nil
+	}
 	// This returns an *os.FileInfo type
 	file, err := os.Open(path)
 	if err != nil {
@@ -70,16 +102,21 @@ func isFile(path string) (bool, error) {
 func parseAndDisplayFileList(paths []string, output bool) {
 	for _, path := range paths {
 		fmt.Printf("---\t%s\t---\n", path)
-		l, err := lexer.NewFromFile(path)
+		l, err := newLexer(path)
 		if err != nil {
 			panic(err)
 		}
 		tokens, err := l.Lex()
 		if err != nil {
-			panic(err)
+			displayDiagnostics(path, l.Diagnostics())
+			continue
 		}
 		p := parser.NewParser(tokens)
-		root := p.Parse()
+		root, err := p.Parse()
+		displayDiagnostics(path, p.Diagnostics())
+		if err != nil {
+			continue
+		}
 
 		if root == nil {
 			fmt.Printf("Dockerfile at path %s contains no valid instruction of no FROM", path)
@@ -92,7 +129,69 @@ func parseAndDisplayFileList(paths []string, output bool) {
 	}
 }
 
+// Result of parsing a single file as encoded in the json output
+type fileResult struct {
+	Path        string          `json:"path"`
+	AST         *ast.StageNode  `json:"ast,omitempty"`
+	Diagnostics diagnostic.List `json:"diagnostics"`
+}
+
+func parseAndEncodeFileList(paths []string, output bool) {
+	results := []fileResult{}
+	for _, path := range paths {
+		result := fileResult{Path: path, Diagnostics: diagnostic.List{}}
+		l, err := newLexer(path)
+		if err != nil {
+			panic(err)
+		}
+		tokens, err := l.Lex()
+		result.Diagnostics = append(result.Diagnostics, l.Diagnostics()...)
+		if err == nil {
+			p := parser.NewParser(tokens)
+			root, err := p.Parse()
+			result.Diagnostics = append(result.Diagnostics, p.Diagnostics()...)
+			if err == nil {
+				result.AST = root
+				if output {
+					outputReconstructed(root, filepath.Base(path))
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		fmt.Fprintf(os.Stderr, "Encoding failed: %s\n", err.Error())
+	}
+}
+
+// Lexer for the file at path or stdin for StdinPath
+func newLexer(path string) (lexer.Lexer, error) {
+	if path == StdinPath {
+		return lexer.NewFromReader(os.Stdin)
+	}
+	return lexer.NewFromFile(path)
+}
+
+// Lines of the file at path or stdin for StdinPath
+func readLines(path string) ([]string, error) {
+	if path == StdinPath {
+		return util.ReadLines(os.Stdin)
+	}
+	return util.ReadFileLines(path)
+}
+
+func displayDiagnostics(path string, diagnostics diagnostic.List) {
+	for _, d := range diagnostics {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, d.String())
+	}
+}
+
 func outputReconstructed(root *ast.StageNode, filename string) {
+	if filename == StdinPath {
+		filename = "stdin.Dockerfile"
+	}
 	os.MkdirAll("./out", 0755)
 	content := root.Reconstruct()
 	data := strings.Join(content, "\n")
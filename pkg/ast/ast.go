@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"slices"
 	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
 )
 
 const colorGreen = "\033[0;32m"
@@ -20,8 +22,28 @@ type Node interface {
 	ToString() string
 	Instruction() string
 	Reconstruct() []string
+	Pos() token.Position
+	End() token.Position
+	Info() *SourceInfo
+}
+
+// Information about the part of the source a node was parsed from
+// Nodes that were not created by the parser have a zero SourceInfo
+type SourceInfo struct {
+	StartPos token.Position `json:"start"`
+	EndPos   token.Position `json:"end"`
+	Comments []string       `json:"comments,omitempty"` // Comment lines found in between the continuation lines of the instruction
+	Raw      []string       `json:"raw,omitempty"`      // Physical lines of the source exactly as they were read
 }
 
+// Position of the first character of the node
+func (si *SourceInfo) Pos() token.Position { return si.StartPos }
+
+// Position directly after the last character of the node
+func (si *SourceInfo) End() token.Position { return si.EndPos }
+
+func (si *SourceInfo) Info() *SourceInfo { return si }
+
 // An InstructionNode is everything that does not define a stage
 type InstructionNode interface {
 	Node
@@ -49,20 +71,25 @@ func (*WorkdirInstructionNode) InstructionNode()     {}
 func (*CommentInstructionNode) InstructionNode()     {}
 func (*EmptyLineNode) InstructionNode()              {}
 
-// For the edge case that instruction supplied to ONBUILD cannot be parsed
+// For the edge case that an instruction cannot be parsed
 func (*UnknownInstructionNode) InstructionNode() {}
 
 // Stagenode defines the current stage for the instructions
 type StageNode struct {
-	Node
-	Identifier      string
-	Subsequent      *StageNode
-	ReferencedByIds []string
+	SourceInfo
+	Identifier      string     `json:"identifier,omitempty"`
+	Subsequent      *StageNode `json:"subsequent,omitempty"`
+	ReferencedByIds []string   `json:"referencedByIds,omitempty"`
 	// This could be a tree in of itself...but docker Instructions dont really have a lot of logic so that may be overkill
-	Instructions   []InstructionNode
-	Image          string
-	ParserMetadata map[string]string
-	Name           string
+	Instructions   []InstructionNode `json:"instructions,omitempty"`
+	Image          string            `json:"image,omitempty"` // Image as written in the FROM instruction
+	ParserMetadata map[string]string `json:"parserMetadata,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Platform       string            `json:"platform,omitempty"`     // Value of FROM --platform
+	Reference      Reference         `json:"reference"`              // Parsed image, only meaningful if the image is not a stage
+	ImageIsStage   bool              `json:"imageIsStage,omitempty"` // The image refers to a previous stage
+
+	snapshot map[Node][]string // normalized reconstruction of every node at the time of the last snapshot
 }
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
@@ -84,18 +111,53 @@ func (sn *StageNode) ToString() string {
 
 func (sn *StageNode) Instruction() string { return "FROM" }
 
+// Escape character declared by the escape parser directive, only the root stage holds parser directives
+func (sn *StageNode) Escape() byte {
+	if sn.ParserMetadata["escape"] == "`" {
+		return '`'
+	}
+	return '\\'
+}
+
 // Generated by chatgpt because i ain't writing all that
 
+// Heredoc as supported by RUN, COPY and ADD
+type Heredoc struct {
+	Name      string `json:"name,omitempty"`      // Delimiter terminating the heredoc
+	Body      string `json:"body,omitempty"`      // Raw lines of the heredoc, every line is terminated by a newline
+	Expand    bool   `json:"expand,omitempty"`    // The delimiter was not quoted -> variables in the body are expanded
+	StripTabs bool   `json:"stripTabs,omitempty"` // Started with <<- instead of << -> leading tabs are removed from the body
+}
+
+// Content of the heredoc as seen by the instruction
+func (h Heredoc) Content() string {
+	if !h.StripTabs {
+		return h.Body
+	}
+	lines := strings.SplitAfter(h.Body, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimLeft(lines[i], "\t")
+	}
+	return strings.Join(lines, "")
+}
+
+func (h Heredoc) ToString() string {
+	return fmt.Sprintf("<<%s (%d bytes)", h.Name, len(h.Body))
+}
+
 // ADD
 type AddInstructionNode struct {
-	Source      []string
-	Destination string
-	KeepGitDir  bool
-	CheckSum    string
-	Chown       string
-	Chmod       string
-	Link        bool
-	Exclude     string
+	SourceInfo
+	Source       []string  `json:"source,omitempty"`
+	Destination  string    `json:"destination,omitempty"`
+	KeepGitDir   bool      `json:"keepGitDir,omitempty"`
+	CheckSum     string    `json:"checksum,omitempty"`
+	Chown        string    `json:"chown,omitempty"`
+	Chmod        string    `json:"chmod,omitempty"`
+	Link         bool      `json:"link,omitempty"`
+	Exclude      []string  `json:"exclude,omitempty"`      // --exclude can be repeated
+	UnknownFlags []string  `json:"unknownFlags,omitempty"` // Flags not supported by ADD as written, e.g. --foo=bar
+	Heredocs     []Heredoc `json:"heredocs,omitempty"`     // Heredocs used as sources
 }
 
 func (ai *AddInstructionNode) ToString() string {
@@ -106,17 +168,16 @@ func (ai *AddInstructionNode) Instruction() string { return "ADD" }
 
 // ARG
 type ArgInstructionNode struct {
-	Pairs map[string]string
+	SourceInfo
+	Pairs map[string]string `json:"pairs,omitempty"`
+	Order []string          `json:"order,omitempty"` // Keys of Pairs in the order they were written
 }
 
+func (ai *ArgInstructionNode) Keys() []string { return OrderedKeys(ai.Order, ai.Pairs) }
+
 func (ai *ArgInstructionNode) ToString() string {
 	mapStrings := []string{}
-	keys := make([]string, 0, len(ai.Pairs))
-	for k := range ai.Pairs {
-		keys = append(keys, k)
-	}
-	slices.Sort(keys)
-	for _, k := range keys {
+	for _, k := range ai.Keys() {
 		mapStrings = append(mapStrings, fmt.Sprintf("%s=%s", k, ai.Pairs[k]))
 	}
 	return fmt.Sprintf("%sARG%s %s %s", colorPurple, colorCyan, strings.Join(mapStrings, ","), colorNone)
@@ -126,24 +187,32 @@ func (ai *ArgInstructionNode) Instruction() string { return "ARG" }
 
 // CMD
 type CmdInstructionNode struct {
-	Cmd []string
+	SourceInfo
+	Cmd          []string `json:"cmd,omitempty"`          // Arguments of the exec form, see ShellCommand for the shell form
+	ShellForm    bool     `json:"shellForm,omitempty"`    // true if shell form, false if exec form
+	ShellCommand string   `json:"shellCommand,omitempty"` // Command as written if the shell form is used
 }
 
 func (ci *CmdInstructionNode) ToString() string {
-	return fmt.Sprintf("%sCMD%s %+q %s", colorPurple, colorCyan, ci.Cmd, colorNone)
+	return fmt.Sprintf("%sCMD%s %s %s", colorPurple, colorCyan, commandToString(ci.Cmd, ci.ShellForm, ci.ShellCommand), colorNone)
 }
 
 func (ci *CmdInstructionNode) Instruction() string { return "CMD" }
 
 // COPY
 type CopyInstructionNode struct {
-	Source      []string
-	Destination string
-	Chown       string
-	From        string
-	KeepGitDir  bool
-	Link        bool
-	IsHereDoc   bool
+	SourceInfo
+	Source       []string  `json:"source,omitempty"`
+	Destination  string    `json:"destination,omitempty"`
+	Chown        string    `json:"chown,omitempty"`
+	Chmod        string    `json:"chmod,omitempty"`
+	From         string    `json:"from,omitempty"`
+	Link         bool      `json:"link,omitempty"`
+	Parents      bool      `json:"parents,omitempty"`      // Keep the parent directories of the sources
+	Exclude      []string  `json:"exclude,omitempty"`      // --exclude can be repeated
+	UnknownFlags []string  `json:"unknownFlags,omitempty"` // Flags not supported by COPY as written, e.g. --foo=bar
+	IsHereDoc    bool      `json:"isHeredoc,omitempty"`
+	Heredocs     []Heredoc `json:"heredocs,omitempty"` // Heredocs used as sources
 }
 
 func (ci *CopyInstructionNode) ToString() string {
@@ -154,24 +223,32 @@ func (ci *CopyInstructionNode) Instruction() string { return "COPY" }
 
 // ENTRYPOINT
 type EntrypointInstructionNode struct {
-	Exec []string
+	SourceInfo
+	Exec         []string `json:"exec,omitempty"`         // Arguments of the exec form, see ShellCommand for the shell form
+	ShellForm    bool     `json:"shellForm,omitempty"`    // true if shell form, false if exec form
+	ShellCommand string   `json:"shellCommand,omitempty"` // Command as written if the shell form is used
 }
 
 func (ei *EntrypointInstructionNode) ToString() string {
-	return fmt.Sprintf("%sENTRYPOINT%s %+q %s", colorPurple, colorCyan, ei.Exec, colorNone)
+	return fmt.Sprintf("%sENTRYPOINT%s %s %s", colorPurple, colorCyan, commandToString(ei.Exec, ei.ShellForm, ei.ShellCommand), colorNone)
 }
 
 func (ei *EntrypointInstructionNode) Instruction() string { return "ENTRYPOINT" }
 
 // ENV
 type EnvInstructionNode struct {
-	Pairs map[string]string
+	SourceInfo
+	Pairs  map[string]string `json:"pairs,omitempty"`
+	Order  []string          `json:"order,omitempty"`  // Keys of Pairs in the order they were written
+	Legacy bool              `json:"legacy,omitempty"` // Written as ENV KEY value instead of ENV KEY=value
 }
 
+func (ei *EnvInstructionNode) Keys() []string { return OrderedKeys(ei.Order, ei.Pairs) }
+
 func (ei *EnvInstructionNode) ToString() string {
 	mapStrings := []string{}
-	for k, v := range ei.Pairs {
-		mapStrings = append(mapStrings, fmt.Sprintf("%s=%s", k, v))
+	for _, k := range ei.Keys() {
+		mapStrings = append(mapStrings, fmt.Sprintf("%s=%s", k, ei.Pairs[k]))
 	}
 	return fmt.Sprintf("%sENV%s %s %s", colorPurple, colorCyan, strings.Join(mapStrings, ","), colorNone)
 }
@@ -179,17 +256,26 @@ func (ei *EnvInstructionNode) ToString() string {
 func (ei *EnvInstructionNode) Instruction() string { return "ENV" }
 
 type PortInfo struct {
-	Port  string
-	IsTCP bool // can only be tcp or udp
+	Port     string `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"` // Lowercase protocol as written (e.g. tcp, udp or sctp), tcp if empty
 }
 
 func (pi *PortInfo) ToString() string {
-	return fmt.Sprintf("Port %s (tcp: %v)", pi.Port, pi.IsTCP)
+	return fmt.Sprintf("Port %s (%s)", pi.Port, pi.Proto())
+}
+
+// Protocol of the port, docker defaults to tcp
+func (pi *PortInfo) Proto() string {
+	if pi.Protocol == "" {
+		return "tcp"
+	}
+	return pi.Protocol
 }
 
 // EXPOSE
 type ExposeInstructionNode struct {
-	Ports []PortInfo
+	SourceInfo
+	Ports []PortInfo `json:"ports,omitempty"`
 }
 
 func (ei *ExposeInstructionNode) ToString() string {
@@ -203,34 +289,72 @@ func (ei *ExposeInstructionNode) ToString() string {
 func (ei *ExposeInstructionNode) Instruction() string { return "EXPOSE" }
 
 // HEALTHCHECK
+// Values docker uses for HEALTHCHECK flags that are not given
+const (
+	DefaultHealthcheckInterval      = "30s"
+	DefaultHealthcheckTimeout       = "30s"
+	DefaultHealthcheckStartPeriod   = "0s"
+	DefaultHealthcheckStartInterval = "5s"
+	DefaultHealthcheckRetries       = 3
+)
+
 type HealthcheckInstructionNode struct {
-	Interval        string
-	Timeout         string
-	StartPeriod     string
-	StartInterval   string
-	Retries         int
-	Cmd             []string // CMD or NONE
-	CancelStatement bool     // setting it to None overwrites previous
+	SourceInfo
+	Interval        string   `json:"interval,omitempty"`
+	Timeout         string   `json:"timeout,omitempty"`
+	StartPeriod     string   `json:"startPeriod,omitempty"`
+	StartInterval   string   `json:"startInterval,omitempty"`
+	Retries         int      `json:"retries,omitempty"`
+	Cmd             []string `json:"cmd,omitempty"`             // Exec form command following the CMD keyword
+	ShellForm       bool     `json:"shellForm,omitempty"`       // true if shell form, false if exec form
+	ShellCommand    string   `json:"shellCommand,omitempty"`    // Command as written if the shell form is used
+	CancelStatement bool     `json:"cancelStatement,omitempty"` // setting it to None overwrites previous
+	SetFlags        []string `json:"setFlags,omitempty"`        // Flags given in the source (e.g. interval), the others hold docker's defaults
+}
+
+// Whether the flag (e.g. start-period) was given or its value was changed from docker's default
+func (hi *HealthcheckInstructionNode) IsSet(flag string) bool {
+	if slices.Contains(hi.SetFlags, flag) {
+		return true
+	}
+	switch flag {
+	case "interval":
+		return hi.Interval != DefaultHealthcheckInterval
+	case "timeout":
+		return hi.Timeout != DefaultHealthcheckTimeout
+	case "start-period":
+		return hi.StartPeriod != DefaultHealthcheckStartPeriod
+	case "start-interval":
+		return hi.StartInterval != DefaultHealthcheckStartInterval
+	case "retries":
+		return hi.Retries != DefaultHealthcheckRetries
+	}
+	return false
 }
 
 func (hi *HealthcheckInstructionNode) ToString() string {
 	if hi.CancelStatement {
 		return fmt.Sprintf("%sHEALTHCHECK%s OVERWRITTEN WITH NONE %s", colorPurple, colorCyan, colorNone)
 	}
-	return fmt.Sprintf("%sHEALTHCHECK%s %+q %s", colorPurple, colorCyan, hi.Cmd, colorNone)
+	return fmt.Sprintf("%sHEALTHCHECK%s %s %s", colorPurple, colorCyan, commandToString(hi.Cmd, hi.ShellForm, hi.ShellCommand), colorNone)
 }
 
 func (hi *HealthcheckInstructionNode) Instruction() string { return "HEALTHCHECK" }
 
 // LABEL
 type LabelInstructionNode struct {
-	Pairs map[string]string
+	SourceInfo
+	Pairs  map[string]string `json:"pairs,omitempty"`
+	Order  []string          `json:"order,omitempty"`  // Keys of Pairs in the order they were written
+	Legacy bool              `json:"legacy,omitempty"` // Written as LABEL KEY value instead of LABEL KEY=value
 }
 
+func (li *LabelInstructionNode) Keys() []string { return OrderedKeys(li.Order, li.Pairs) }
+
 func (li *LabelInstructionNode) ToString() string {
 	mapStrings := []string{}
-	for k, v := range li.Pairs {
-		mapStrings = append(mapStrings, fmt.Sprintf("%s=%s", k, v))
+	for _, k := range li.Keys() {
+		mapStrings = append(mapStrings, fmt.Sprintf("%s=%s", k, li.Pairs[k]))
 	}
 	return fmt.Sprintf("%sLABEL%s %s %s", colorPurple, colorCyan, strings.Join(mapStrings, ","), colorNone)
 }
@@ -239,7 +363,8 @@ func (li *LabelInstructionNode) Instruction() string { return "LABEL" }
 
 // MAINTAINER (deprecated)
 type MaintainerInstructionNode struct {
-	Name string
+	SourceInfo
+	Name string `json:"name,omitempty"`
 }
 
 func (mi *MaintainerInstructionNode) ToString() string {
@@ -250,7 +375,8 @@ func (mi *MaintainerInstructionNode) Instruction() string { return "MAINTAINER"
 
 // ONBUILD
 type OnbuildInstructionNode struct {
-	Trigger InstructionNode
+	SourceInfo
+	Trigger InstructionNode `json:"trigger,omitempty"`
 }
 
 func (oi *OnbuildInstructionNode) ToString() string {
@@ -261,24 +387,64 @@ func (oi *OnbuildInstructionNode) Instruction() string { return "ONBUILD" }
 
 // RUN
 type RunInstructionNode struct {
-	Cmd       []string
-	ShellForm bool // true if shell form, false if exec form
-	IsHeredoc bool // true if heredoc
-	Device    string
-	Mount     []string
-	Network   string
-	Security  string
+	SourceInfo
+	Cmd          []string  `json:"cmd,omitempty"`          // Arguments of the exec form, see ShellCommand for the shell form
+	ShellForm    bool      `json:"shellForm,omitempty"`    // true if shell form, false if exec form
+	ShellCommand string    `json:"shellCommand,omitempty"` // Command as written if the shell form is used, see Script
+	IsHeredoc    bool      `json:"isHeredoc,omitempty"`    // true if heredoc
+	Heredocs     []Heredoc `json:"heredocs,omitempty"`
+	Device       string    `json:"device,omitempty"`
+	Mount        []string  `json:"mount,omitempty"`
+	Network      string    `json:"network,omitempty"`
+	Security     string    `json:"security,omitempty"`
 }
 
 func (ri *RunInstructionNode) ToString() string {
-	return fmt.Sprintf("%sRUN%s %+q %s", colorPurple, colorCyan, ri.Cmd, colorNone)
+	if len(ri.Heredocs) != 0 {
+		return fmt.Sprintf("%sRUN%s %s %s %s", colorPurple, colorCyan, commandToString(ri.Cmd, ri.ShellForm, ri.ShellCommand), heredocsToString(ri.Heredocs), colorNone)
+	}
+	return fmt.Sprintf("%sRUN%s %s %s", colorPurple, colorCyan, commandToString(ri.Cmd, ri.ShellForm, ri.ShellCommand), colorNone)
+}
+
+// Keys of pairs following order, keys that are not part of order are appended sorted
+func OrderedKeys(order []string, pairs map[string]string) []string {
+	keys := make([]string, 0, len(pairs))
+	for _, k := range order {
+		if _, ok := pairs[k]; ok && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	rest := []string{}
+	for k := range pairs {
+		if !slices.Contains(keys, k) {
+			rest = append(rest, k)
+		}
+	}
+	slices.Sort(rest)
+	return append(keys, rest...)
+}
+
+func commandToString(cmd []string, shellForm bool, shellCommand string) string {
+	if shellForm {
+		return fmt.Sprintf("%+q", shellCommand)
+	}
+	return fmt.Sprintf("%+q", cmd)
+}
+
+func heredocsToString(heredocs []Heredoc) string {
+	res := make([]string, len(heredocs))
+	for i, h := range heredocs {
+		res[i] = h.ToString()
+	}
+	return strings.Join(res, " ")
 }
 
 func (ri *RunInstructionNode) Instruction() string { return "RUN" }
 
 // SHELL
 type ShellInstructionNode struct {
-	Shell []string
+	SourceInfo
+	Shell []string `json:"shell,omitempty"`
 }
 
 func (si *ShellInstructionNode) ToString() string {
@@ -289,7 +455,8 @@ func (si *ShellInstructionNode) Instruction() string { return "SHELL" }
 
 // STOPSIGNAL
 type StopsignalInstructionNode struct {
-	Signal string
+	SourceInfo
+	Signal string `json:"signal,omitempty"`
 }
 
 func (si *StopsignalInstructionNode) ToString() string {
@@ -300,7 +467,8 @@ func (si *StopsignalInstructionNode) Instruction() string { return "STOPSIGNAL"
 
 // USER
 type UserInstructionNode struct {
-	User string
+	SourceInfo
+	User string `json:"user,omitempty"`
 }
 
 func (ui *UserInstructionNode) ToString() string {
@@ -311,7 +479,8 @@ func (ui *UserInstructionNode) Instruction() string { return "USER" }
 
 // VOLUME
 type VolumeInstructionNode struct {
-	Mounts []string
+	SourceInfo
+	Mounts []string `json:"mounts,omitempty"`
 }
 
 func (vi *VolumeInstructionNode) ToString() string {
@@ -322,7 +491,8 @@ func (vi *VolumeInstructionNode) Instruction() string { return "VOLUME" }
 
 // WORKDIR
 type WorkdirInstructionNode struct {
-	Path string
+	SourceInfo
+	Path string `json:"path,omitempty"`
 }
 
 func (wi *WorkdirInstructionNode) ToString() string {
@@ -332,9 +502,10 @@ func (wi *WorkdirInstructionNode) ToString() string {
 func (wi *WorkdirInstructionNode) Instruction() string { return "WORKDIR" }
 
 // Unparseable instruction node
-// Relevant if the instruction passed to ONBUILD could not be parsed
+// Relevant if the instruction passed to ONBUILD could not be parsed or the lexer recovered from an illegal instruction
 type UnknownInstructionNode struct {
-	Text string
+	SourceInfo
+	Text string `json:"text,omitempty"`
 }
 
 func (ui *UnknownInstructionNode) ToString() string {
@@ -344,7 +515,8 @@ func (ui *UnknownInstructionNode) ToString() string {
 func (ui *UnknownInstructionNode) Instruction() string { return "UNKNOWN" }
 
 type CommentInstructionNode struct {
-	Text string
+	SourceInfo
+	Text string `json:"text,omitempty"`
 }
 
 func (ci *CommentInstructionNode) ToString() string {
@@ -353,7 +525,9 @@ func (ci *CommentInstructionNode) ToString() string {
 
 func (ei *CommentInstructionNode) Instruction() string { return "COMMENT" }
 
-type EmptyLineNode struct{}
+type EmptyLineNode struct {
+	SourceInfo
+}
 
 func (*EmptyLineNode) ToString() string    { return fmt.Sprintf("%sEMPTY%s", colorPurple, colorNone) }
 func (*EmptyLineNode) Instruction() string { return "EMPTY LINE" }
@@ -0,0 +1,172 @@
+package ast
+
+import (
+	"maps"
+	"slices"
+)
+
+// Deep copy of the stage and all subsequent stages
+// The copy shares no memory with the original, unmodified nodes of a parsed tree stay unmodified in the copy
+func (sn *StageNode) Clone() *StageNode {
+	clones := make(map[Node]Node)
+	var root, previous *StageNode
+	for stage := sn; stage != nil; stage = stage.Subsequent {
+		c := &StageNode{
+			SourceInfo:      stage.SourceInfo.clone(),
+			Identifier:      stage.Identifier,
+			ReferencedByIds: slices.Clone(stage.ReferencedByIds),
+			Instructions:    make([]InstructionNode, len(stage.Instructions)),
+			Image:           stage.Image,
+			ParserMetadata:  maps.Clone(stage.ParserMetadata),
+			Name:            stage.Name,
+			Platform:        stage.Platform,
+			Reference:       stage.Reference,
+			ImageIsStage:    stage.ImageIsStage,
+		}
+		if stage.Instructions == nil {
+			c.Instructions = nil
+		}
+		for i, instruction := range stage.Instructions {
+			c.Instructions[i] = CloneInstruction(instruction)
+			clones[instruction] = c.Instructions[i]
+		}
+		clones[stage] = c
+		if root == nil {
+			root = c
+		} else {
+			previous.Subsequent = c
+		}
+		previous = c
+	}
+	if sn.snapshot != nil {
+		root.snapshot = make(map[Node][]string, len(sn.snapshot))
+		for original, reconstructed := range sn.snapshot {
+			if c, ok := clones[original]; ok {
+				root.snapshot[c] = reconstructed
+			}
+		}
+	}
+	return root
+}
+
+func (si SourceInfo) clone() SourceInfo {
+	return SourceInfo{StartPos: si.StartPos, EndPos: si.EndPos, Comments: slices.Clone(si.Comments), Raw: slices.Clone(si.Raw)}
+}
+
+func cloneHeredocs(heredocs []Heredoc) []Heredoc {
+	return slices.Clone(heredocs)
+}
+
+// Deep copy of a single instruction
+func CloneInstruction(node InstructionNode) InstructionNode {
+	switch n := node.(type) {
+	case *AddInstructionNode:
+		c := *n
+		c.Source = slices.Clone(n.Source)
+		c.Exclude = slices.Clone(n.Exclude)
+		c.UnknownFlags = slices.Clone(n.UnknownFlags)
+		c.Heredocs = cloneHeredocs(n.Heredocs)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *ArgInstructionNode:
+		c := *n
+		c.Pairs = maps.Clone(n.Pairs)
+		c.Order = slices.Clone(n.Order)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *CmdInstructionNode:
+		c := *n
+		c.Cmd = slices.Clone(n.Cmd)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *CopyInstructionNode:
+		c := *n
+		c.Source = slices.Clone(n.Source)
+		c.Exclude = slices.Clone(n.Exclude)
+		c.UnknownFlags = slices.Clone(n.UnknownFlags)
+		c.Heredocs = cloneHeredocs(n.Heredocs)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *EntrypointInstructionNode:
+		c := *n
+		c.Exec = slices.Clone(n.Exec)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *EnvInstructionNode:
+		c := *n
+		c.Pairs = maps.Clone(n.Pairs)
+		c.Order = slices.Clone(n.Order)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *ExposeInstructionNode:
+		c := *n
+		c.Ports = slices.Clone(n.Ports)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *HealthcheckInstructionNode:
+		c := *n
+		c.Cmd = slices.Clone(n.Cmd)
+		c.SetFlags = slices.Clone(n.SetFlags)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *LabelInstructionNode:
+		c := *n
+		c.Pairs = maps.Clone(n.Pairs)
+		c.Order = slices.Clone(n.Order)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *MaintainerInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *OnbuildInstructionNode:
+		c := *n
+		if n.Trigger != nil {
+			c.Trigger = CloneInstruction(n.Trigger)
+		}
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *RunInstructionNode:
+		c := *n
+		c.Cmd = slices.Clone(n.Cmd)
+		c.Heredocs = cloneHeredocs(n.Heredocs)
+		c.Mount = slices.Clone(n.Mount)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *ShellInstructionNode:
+		c := *n
+		c.Shell = slices.Clone(n.Shell)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *StopsignalInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *UserInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *VolumeInstructionNode:
+		c := *n
+		c.Mounts = slices.Clone(n.Mounts)
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *WorkdirInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *CommentInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *EmptyLineNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	case *UnknownInstructionNode:
+		c := *n
+		c.SourceInfo = n.SourceInfo.clone()
+		return &c
+	}
+	return node
+}
@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Reference of a stage to another stage or an image
+type Dependency struct {
+	Name string // Name or index of a stage, otherwise an image reference
+	Node Node   // Node causing the dependency, the stage itself for FROM
+}
+
+// Everything the stage depends on: FROM <image|stage>, COPY --from=<name|index|image> and RUN --mount=from=<name|index|image>
+// Triggers of ONBUILD are not part of this build and therefore not included
+func (sn *StageNode) Dependencies() []Dependency {
+	dependencies := []Dependency{}
+	if sn.Image != "" {
+		dependencies = append(dependencies, Dependency{Name: sn.Image, Node: sn})
+	}
+	for _, instruction := range sn.Instructions {
+		switch n := instruction.(type) {
+		case *CopyInstructionNode:
+			if n.From != "" {
+				dependencies = append(dependencies, Dependency{Name: n.From, Node: n})
+			}
+		case *RunInstructionNode:
+			for _, mount := range n.Mount {
+				// Invalid mounts are reported by the parser
+				if m, err := ParseMount(mount); err == nil && m.From != "" {
+					dependencies = append(dependencies, Dependency{Name: m.From, Node: n})
+				}
+			}
+		}
+	}
+	return dependencies
+}
+
+// Stage the dependency refers to or nil if it refers to an image
+// FROM can only refer to previous stages by name, COPY and RUN can refer to any stage by name or index
+// Stage names are case insensitive
+func (sn *StageNode) Resolve(d Dependency) *StageNode {
+	stages := sn.Stages()
+	name := strings.ToLower(d.Name)
+	if from, ok := d.Node.(*StageNode); ok {
+		for _, stage := range stages {
+			if stage == from {
+				break
+			}
+			if stage.Name != "" && strings.ToLower(stage.Name) == name {
+				return stage
+			}
+		}
+		return nil
+	}
+	for _, stage := range stages {
+		if stage.Name != "" && strings.ToLower(stage.Name) == name {
+			return stage
+		}
+	}
+	if index, err := strconv.Atoi(d.Name); err == nil && index >= 0 && index < len(stages) {
+		return stages[index]
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+var (
+	ErrOutOfRange      = errors.New("index out of range")
+	ErrStageReferenced = errors.New("stage is referenced")
+)
+
+func checkIndex(index, length int) error {
+	if index < 0 || index > length {
+		return fmt.Errorf("%w: %d not in [0, %d]", ErrOutOfRange, index, length)
+	}
+	return nil
+}
+
+// A stage does not know the root, so the instruction edits below leave ReferencedByIds and ImageIsStage as they are
+// Call RelinkReferences on the root after adding, replacing or removing instructions that reference other stages
+
+// Insert the instructions in front of the instruction at the index
+// An index equal to the number of instructions appends them
+func (sn *StageNode) InsertInstructions(index int, nodes ...InstructionNode) error {
+	if err := checkIndex(index, len(sn.Instructions)); err != nil {
+		return err
+	}
+	sn.Instructions = slices.Insert(sn.Instructions, index, nodes...)
+	return nil
+}
+
+// Replace the instruction at the index
+func (sn *StageNode) ReplaceInstruction(index int, node InstructionNode) error {
+	if err := checkIndex(index, len(sn.Instructions)-1); err != nil {
+		return err
+	}
+	sn.Instructions[index] = node
+	return nil
+}
+
+// Remove the instruction at the index
+func (sn *StageNode) RemoveInstruction(index int) error {
+	if err := checkIndex(index, len(sn.Instructions)-1); err != nil {
+		return err
+	}
+	sn.Instructions = slices.Delete(sn.Instructions, index, index+1)
+	return nil
+}
+
+// Index of the first instruction matching the predicate or -1
+func (sn *StageNode) IndexOf(match func(InstructionNode) bool) int {
+	return slices.IndexFunc(sn.Instructions, match)
+}
+
+// Insert the instructions in front of the first instruction matching the predicate
+// Returns false if no instruction matched
+func (sn *StageNode) InsertBefore(match func(InstructionNode) bool, nodes ...InstructionNode) bool {
+	index := sn.IndexOf(match)
+	if index == -1 {
+		return false
+	}
+	sn.Instructions = slices.Insert(sn.Instructions, index, nodes...)
+	return true
+}
+
+// Insert the instructions after the first instruction matching the predicate
+// Returns false if no instruction matched
+func (sn *StageNode) InsertAfter(match func(InstructionNode) bool, nodes ...InstructionNode) bool {
+	index := sn.IndexOf(match)
+	if index == -1 {
+		return false
+	}
+	sn.Instructions = slices.Insert(sn.Instructions, index+1, nodes...)
+	return true
+}
+
+// Replace all instructions matching the predicate with the result of replace
+// Returns the number of replaced instructions
+func (sn *StageNode) ReplaceWhere(match func(InstructionNode) bool, replace func(InstructionNode) InstructionNode) int {
+	count := 0
+	for i, instruction := range sn.Instructions {
+		if match(instruction) {
+			sn.Instructions[i] = replace(instruction)
+			count++
+		}
+	}
+	return count
+}
+
+// Remove all instructions matching the predicate
+// Returns the number of removed instructions
+func (sn *StageNode) RemoveWhere(match func(InstructionNode) bool) int {
+	before := len(sn.Instructions)
+	sn.Instructions = slices.DeleteFunc(sn.Instructions, match)
+	return before - len(sn.Instructions)
+}
+
+// Stages following the root stage
+// The index of a stage in the result is the index used by docker (e.g. COPY --from=0)
+func (sn *StageNode) Stages() []*StageNode {
+	stages := []*StageNode{}
+	for stage := sn.Subsequent; stage != nil; stage = stage.Subsequent {
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// Insert the stage in front of the stage at the index
+// An index equal to the number of stages appends the stage
+func (sn *StageNode) InsertStage(index int, stage *StageNode) error {
+	stages := sn.Stages()
+	if err := checkIndex(index, len(stages)); err != nil {
+		return err
+	}
+	if stage == nil || stage == sn || slices.Contains(stages, stage) {
+		return errors.New("stage is nil or already part of the tree")
+	}
+	sn.restructure(stages, slices.Insert(slices.Clone(stages), index, stage))
+	return nil
+}
+
+// Remove the stage at the index
+func (sn *StageNode) RemoveStage(index int) error {
+	return sn.RemoveStages(index)
+}
+
+// Remove the stages at the indices
+// Nothing is removed if a remaining stage references a removed stage by name or index as the reference would point to another stage
+func (sn *StageNode) RemoveStages(indices ...int) error {
+	stages := sn.Stages()
+	removed := []*StageNode{}
+	for _, index := range indices {
+		if err := checkIndex(index, len(stages)-1); err != nil {
+			return err
+		}
+		removed = append(removed, stages[index])
+	}
+	remaining := slices.DeleteFunc(slices.Clone(stages), func(stage *StageNode) bool { return slices.Contains(removed, stage) })
+	for _, stage := range remaining {
+		for _, d := range stage.Dependencies() {
+			if referenced := sn.Resolve(d); referenced != nil && slices.Contains(removed, referenced) {
+				return fmt.Errorf("%w: stage %d is referenced as %s", ErrStageReferenced, slices.Index(stages, referenced), d.Name)
+			}
+		}
+	}
+	sn.restructure(stages, remaining)
+	return nil
+}
+
+// Move the stage at index from so it ends up at index to
+func (sn *StageNode) MoveStage(from, to int) error {
+	stages := sn.Stages()
+	if err := checkIndex(from, len(stages)-1); err != nil {
+		return err
+	}
+	if err := checkIndex(to, len(stages)-1); err != nil {
+		return err
+	}
+	stage := stages[from]
+	reordered := slices.Delete(slices.Clone(stages), from, from+1)
+	sn.restructure(stages, slices.Insert(reordered, to, stage))
+	return nil
+}
+
+// Relink the stages in the new order and update everything depending on the order
+// Numeric stage references of COPY --from and RUN --mount=from are updated to keep pointing to the same stage
+func (sn *StageNode) restructure(before, after []*StageNode) {
+	for _, stage := range after {
+		// Numeric references of inserted stages already refer to the new order
+		if !slices.Contains(before, stage) {
+			continue
+		}
+		for _, instruction := range stage.Instructions {
+			switch n := instruction.(type) {
+			case *CopyInstructionNode:
+				n.From, _ = renumber(n.From, before, after)
+			case *RunInstructionNode:
+				mounts, err := n.Mounts()
+				if err != nil {
+					continue
+				}
+				changed := false
+				for i := range mounts {
+					var ok bool
+					if mounts[i].From, ok = renumber(mounts[i].From, before, after); ok {
+						changed = true
+					}
+				}
+				if changed {
+					n.SetMounts(mounts)
+				}
+			}
+		}
+	}
+	previous := sn
+	for _, stage := range after {
+		previous.Subsequent = stage
+		previous = stage
+	}
+	previous.Subsequent = nil
+	sn.RelinkReferences()
+}
+
+// Numeric reference to the stage the reference pointed to before the stages were restructured
+// Returns false if the reference is unchanged (not numeric, out of range, removed or not moved)
+func renumber(reference string, before, after []*StageNode) (string, bool) {
+	index, err := strconv.Atoi(reference)
+	if err != nil || index < 0 || index >= len(before) {
+		return reference, false
+	}
+	moved := slices.Index(after, before[index])
+	if moved == -1 || moved == index {
+		return reference, false
+	}
+	return strconv.Itoa(moved), true
+}
+
+// Recompute the ReferencedByIds and ImageIsStage of all stages based on the dependencies of the stages
+// Has to be called on the root, stage edits call it themselves but instruction edits do not
+func (sn *StageNode) RelinkReferences() {
+	stages := sn.Stages()
+	for _, stage := range stages {
+		stage.ReferencedByIds = nil
+		stage.ImageIsStage = stage.Image != "" && sn.Resolve(Dependency{Name: stage.Image, Node: stage}) != nil
+	}
+	for _, stage := range stages {
+		for _, d := range stage.Dependencies() {
+			if referenced := sn.Resolve(d); referenced != nil && !slices.Contains(referenced.ReferencedByIds, stage.Identifier) {
+				referenced.ReferencedByIds = append(referenced.ReferencedByIds, stage.Identifier)
+			}
+		}
+	}
+}
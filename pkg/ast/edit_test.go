@@ -0,0 +1,168 @@
+package ast_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func isKind(kind string) func(ast.InstructionNode) bool {
+	return func(n ast.InstructionNode) bool { return ast.Kind(n) == kind }
+}
+
+func TestEditInstructions(t *testing.T) {
+	root := testdata.Parse(t, []string{"FROM alpine", "RUN a", "ENV A=1", "CMD [\"b\"]"})
+	stage := root.Subsequent
+	if err := stage.InsertInstructions(0, &ast.LabelInstructionNode{Pairs: map[string]string{"a": "b"}}); err != nil {
+		t.Fatalf("Insert failed: %s", err.Error())
+	}
+	if !stage.InsertBefore(isKind("CMD"), &ast.UserInstructionNode{User: "app"}) {
+		t.Errorf("Expected CMD to be found")
+	}
+	if !stage.InsertAfter(isKind("ENV"), &ast.WorkdirInstructionNode{Path: "/app"}) {
+		t.Errorf("Expected ENV to be found")
+	}
+	if stage.InsertAfter(isKind("HEALTHCHECK"), &ast.WorkdirInstructionNode{Path: "/app"}) {
+		t.Errorf("Expected HEALTHCHECK not to be found")
+	}
+	if count := stage.RemoveWhere(isKind("RUN")); count != 1 {
+		t.Errorf("Removal count mismatch: Expected %d Got %d", 1, count)
+	}
+	if err := stage.ReplaceInstruction(stage.IndexOf(isKind("ENV")), &ast.EnvInstructionNode{Pairs: map[string]string{"B": "2"}}); err != nil {
+		t.Fatalf("Replace failed: %s", err.Error())
+	}
+	if err := stage.RemoveInstruction(len(stage.Instructions)); !errors.Is(err, ast.ErrOutOfRange) {
+		t.Errorf("Expected out of range error Got %v", err)
+	}
+	expected := []string{"FROM alpine", "LABEL a=b", "ENV B=2", "WORKDIR /app", "USER app", "CMD [\"b\"]"}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+}
+
+func TestEditInstructionsRelink(t *testing.T) {
+	root := testdata.Parse(t, []string{"FROM alpine AS a", "FROM alpine AS b", "COPY --from=a /x /x", "FROM scratch"})
+	stages := root.Stages()
+	stages[1].RemoveWhere(isKind("COPY"))
+	if err := stages[2].InsertInstructions(0, &ast.CopyInstructionNode{From: "b", Source: []string{"/y"}, Destination: "/y"}); err != nil {
+		t.Fatalf("Insert failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(stages[0].ReferencedByIds, []string{stages[1].Identifier}) || len(stages[1].ReferencedByIds) != 0 {
+		t.Errorf("Expected instruction edits to keep the references Got %v %v", stages[0].ReferencedByIds, stages[1].ReferencedByIds)
+	}
+	root.RelinkReferences()
+	if len(stages[0].ReferencedByIds) != 0 || !reflect.DeepEqual(stages[1].ReferencedByIds, []string{stages[2].Identifier}) {
+		t.Errorf("Reference mismatch: Got %v %v", stages[0].ReferencedByIds, stages[1].ReferencedByIds)
+	}
+	stages[2].ReplaceWhere(isKind("COPY"), func(ast.InstructionNode) ast.InstructionNode {
+		return &ast.CopyInstructionNode{From: "0", Source: []string{"/y"}, Destination: "/y"}
+	})
+	root.RelinkReferences()
+	if !reflect.DeepEqual(stages[0].ReferencedByIds, []string{stages[2].Identifier}) || len(stages[1].ReferencedByIds) != 0 {
+		t.Errorf("Reference mismatch: Got %v %v", stages[0].ReferencedByIds, stages[1].ReferencedByIds)
+	}
+}
+
+func TestEditStages(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS a",
+		"FROM alpine AS b",
+		"COPY --from=0 /x /x",
+		"FROM scratch",
+		"COPY --from=B /y /y",
+		"COPY --from=1 /z /z",
+	})
+	stages := root.Stages()
+	if len(stages) != 3 {
+		t.Fatalf("Stage count mismatch: Expected %d Got %d", 3, len(stages))
+	}
+	root.RelinkReferences()
+	if !reflect.DeepEqual(stages[0].ReferencedByIds, []string{stages[1].Identifier}) || !reflect.DeepEqual(stages[1].ReferencedByIds, []string{stages[2].Identifier}) {
+		t.Errorf("Reference mismatch: Got %v %v", stages[0].ReferencedByIds, stages[1].ReferencedByIds)
+	}
+
+	if err := root.MoveStage(0, 1); err != nil {
+		t.Fatalf("Move failed: %s", err.Error())
+	}
+	expected := []string{"FROM alpine AS b", "COPY --from=1 /x /x", "FROM alpine AS a", "FROM scratch", "COPY --from=B /y /y", "COPY --from=0 /z /z"}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+
+	inserted := &ast.StageNode{Identifier: ast.GenerateStageNodeID(), Image: "busybox", Name: "c"}
+	if err := root.InsertStage(3, inserted); err != nil {
+		t.Fatalf("Insert failed: %s", err.Error())
+	}
+	if err := root.InsertStage(0, inserted); err == nil {
+		t.Errorf("Expected error when inserting a stage twice")
+	}
+	if err := root.RemoveStage(0); !errors.Is(err, ast.ErrStageReferenced) {
+		t.Errorf("Expected referenced stage error Got %v", err)
+	}
+	if err := root.RemoveStage(2); err != nil {
+		t.Fatalf("Remove failed: %s", err.Error())
+	}
+	expected = []string{"FROM alpine AS b", "COPY --from=1 /x /x", "FROM alpine AS a", "FROM busybox AS c"}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+	stages = root.Stages()
+	if len(stages) != 3 || stages[2] != inserted || inserted.Subsequent != nil {
+		t.Errorf("Stage links mismatch: Got %v", stages)
+	}
+	if !reflect.DeepEqual(stages[1].ReferencedByIds, []string{stages[0].Identifier}) || len(stages[0].ReferencedByIds) != 0 {
+		t.Errorf("Reference mismatch: Got %v %v", stages[0].ReferencedByIds, stages[1].ReferencedByIds)
+	}
+	if err := root.MoveStage(0, 3); !errors.Is(err, ast.ErrOutOfRange) {
+		t.Errorf("Expected out of range error Got %v", err)
+	}
+}
+
+func TestRemoveReferencedStage(t *testing.T) {
+	input := []string{
+		"FROM alpine AS a",
+		"FROM alpine AS b",
+		"FROM scratch AS c",
+		"COPY --from=1 /b /b",
+		"RUN --mount=from=a,target=/a ls /a",
+	}
+	root := testdata.Parse(t, input)
+	for _, index := range []int{0, 1} {
+		if err := root.RemoveStage(index); !errors.Is(err, ast.ErrStageReferenced) {
+			t.Errorf("Expected referenced stage error for stage %d Got %v", index, err)
+		}
+	}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(input, actual) {
+		t.Errorf("Expected the tree to be unchanged: Expected %v Got %v", input, actual)
+	}
+	// Stages only referenced by removed stages can be removed together with them
+	if err := root.RemoveStages(2, 1, 0); err != nil {
+		t.Fatalf("Remove failed: %s", err.Error())
+	}
+	if stages := root.Stages(); len(stages) != 0 {
+		t.Errorf("Stage count mismatch: Expected %d Got %d", 0, len(stages))
+	}
+}
+
+func TestClone(t *testing.T) {
+	input := []string{"from alpine as a", "run  echo", "onbuild env A=1", "FROM a", "label x=y"}
+	root := testdata.Parse(t, input)
+	clone := root.Clone()
+	if !reflect.DeepEqual(input, clone.ReconstructLossless()) {
+		t.Errorf("Reconstruction mismatch: Expected %v Got %v", input, clone.ReconstructLossless())
+	}
+	clone.Subsequent.Instructions[1].(*ast.OnbuildInstructionNode).Trigger.(*ast.EnvInstructionNode).Pairs["A"] = "2"
+	clone.Subsequent.Instructions[0].(*ast.RunInstructionNode).ShellCommand = "true"
+	clone.Subsequent.Subsequent.Instructions[0].Info().Raw[0] = "LABEL x=z"
+	if !reflect.DeepEqual(input, root.ReconstructLossless()) {
+		t.Errorf("Original was modified: Expected %v Got %v", input, root.ReconstructLossless())
+	}
+	expected := []string{"from alpine as a", "RUN true", "ONBUILD ENV A=2", "FROM a", "LABEL x=z"}
+	if actual := clone.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+}
@@ -0,0 +1,176 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Value of the "kind" field identifying the type of a node in JSON
+const StageKind = "STAGE"
+
+// Constructors for all instruction nodes by kind
+var instructionKinds = map[string]func() InstructionNode{
+	"ADD":         func() InstructionNode { return &AddInstructionNode{} },
+	"ARG":         func() InstructionNode { return &ArgInstructionNode{} },
+	"CMD":         func() InstructionNode { return &CmdInstructionNode{} },
+	"COPY":        func() InstructionNode { return &CopyInstructionNode{} },
+	"ENTRYPOINT":  func() InstructionNode { return &EntrypointInstructionNode{} },
+	"ENV":         func() InstructionNode { return &EnvInstructionNode{} },
+	"EXPOSE":      func() InstructionNode { return &ExposeInstructionNode{} },
+	"HEALTHCHECK": func() InstructionNode { return &HealthcheckInstructionNode{} },
+	"LABEL":       func() InstructionNode { return &LabelInstructionNode{} },
+	"MAINTAINER":  func() InstructionNode { return &MaintainerInstructionNode{} },
+	"ONBUILD":     func() InstructionNode { return &OnbuildInstructionNode{} },
+	"RUN":         func() InstructionNode { return &RunInstructionNode{} },
+	"SHELL":       func() InstructionNode { return &ShellInstructionNode{} },
+	"STOPSIGNAL":  func() InstructionNode { return &StopsignalInstructionNode{} },
+	"USER":        func() InstructionNode { return &UserInstructionNode{} },
+	"VOLUME":      func() InstructionNode { return &VolumeInstructionNode{} },
+	"WORKDIR":     func() InstructionNode { return &WorkdirInstructionNode{} },
+	"COMMENT":     func() InstructionNode { return &CommentInstructionNode{} },
+	"EMPTY_LINE":  func() InstructionNode { return &EmptyLineNode{} },
+	"UNKNOWN":     func() InstructionNode { return &UnknownInstructionNode{} },
+}
+
+// Value of the "kind" field of the node
+func Kind(node Node) string {
+	switch node.(type) {
+	case *StageNode:
+		return StageKind
+	case *EmptyLineNode:
+		return "EMPTY_LINE"
+	}
+	return node.Instruction()
+}
+
+// Encode the instruction including its kind
+func MarshalInstruction(node InstructionNode) ([]byte, error) {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	// Nodes are encoded as objects -> the kind can be put in front of the other fields
+	kind, _ := json.Marshal(Kind(node))
+	encoded := append([]byte(`{"kind":`), kind...)
+	if len(data) > 2 {
+		encoded = append(encoded, ',')
+	}
+	return append(encoded, data[1:]...), nil
+}
+
+// Decode an instruction encoded by MarshalInstruction into its typed node
+func UnmarshalInstruction(data []byte) (InstructionNode, error) {
+	var header struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	constructor, ok := instructionKinds[header.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction kind %q", header.Kind)
+	}
+	node := constructor()
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func marshalInstructions(nodes []InstructionNode) ([]json.RawMessage, error) {
+	res := make([]json.RawMessage, len(nodes))
+	for i, n := range nodes {
+		data, err := MarshalInstruction(n)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = data
+	}
+	return res, nil
+}
+
+func unmarshalInstructions(data []json.RawMessage) ([]InstructionNode, error) {
+	res := make([]InstructionNode, len(data))
+	for i, d := range data {
+		node, err := UnmarshalInstruction(d)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = node
+	}
+	return res, nil
+}
+
+// Prevent the custom marshalling from being called recursively
+type stageAlias StageNode
+
+type stageJSON struct {
+	Kind string `json:"kind"`
+	*stageAlias
+	Instructions []json.RawMessage `json:"instructions"`
+}
+
+func (sn *StageNode) MarshalJSON() ([]byte, error) {
+	instructions, err := marshalInstructions(sn.Instructions)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stageJSON{Kind: StageKind, stageAlias: (*stageAlias)(sn), Instructions: instructions})
+}
+
+// Decode the stage and all subsequent stages
+// No snapshot is taken as the JSON may have been changed without updating the original source
+// Call Snapshot on the decoded root to let ReconstructLossless trust the original source again
+func (sn *StageNode) UnmarshalJSON(data []byte) error {
+	decoded := stageJSON{stageAlias: (*stageAlias)(sn)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Kind != StageKind {
+		return fmt.Errorf("expected kind %q got %q", StageKind, decoded.Kind)
+	}
+	instructions, err := unmarshalInstructions(decoded.Instructions)
+	if err != nil {
+		return err
+	}
+	sn.Instructions = instructions
+	if sn.ParserMetadata == nil {
+		sn.ParserMetadata = make(map[string]string)
+	}
+	return nil
+}
+
+type onbuildAlias OnbuildInstructionNode
+
+type onbuildJSON struct {
+	*onbuildAlias
+	Trigger json.RawMessage `json:"trigger,omitempty"`
+}
+
+func (oi *OnbuildInstructionNode) MarshalJSON() ([]byte, error) {
+	encoded := onbuildJSON{onbuildAlias: (*onbuildAlias)(oi)}
+	if oi.Trigger != nil {
+		trigger, err := MarshalInstruction(oi.Trigger)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Trigger = trigger
+	}
+	return json.Marshal(encoded)
+}
+
+func (oi *OnbuildInstructionNode) UnmarshalJSON(data []byte) error {
+	decoded := onbuildJSON{onbuildAlias: (*onbuildAlias)(oi)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if len(decoded.Trigger) == 0 {
+		return nil
+	}
+	trigger, err := UnmarshalInstruction(decoded.Trigger)
+	if err != nil {
+		return err
+	}
+	oi.Trigger = trigger
+	return nil
+}
@@ -0,0 +1,105 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := [][]string{
+		{
+			"# syntax=docker/dockerfile:1",
+			"ARG VERSION=1",
+			"from alpine:3.20 as build",
+			"RUN <<EOT bash",
+			"echo hi",
+			"EOT",
+			"onbuild expose 80/udp",
+			"# comment",
+			"",
+			"HEALTHCHECK --interval=5s CMD [\"true\"]",
+			"FROM scratch",
+			"COPY --from=build /a /b",
+		},
+		testdata.SampleDockerfile,
+	}
+	for _, input := range inputs {
+		root := testdata.Parse(t, input)
+		data, err := json.Marshal(root)
+		if err != nil {
+			t.Fatalf("Encoding failed: %s", err.Error())
+		}
+		decoded := &ast.StageNode{}
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Decoding failed: %s", err.Error())
+		}
+		if !reflect.DeepEqual(root.Reconstruct(), decoded.Reconstruct()) {
+			t.Errorf("Reconstruction mismatch: Expected %v Got %v", root.Reconstruct(), decoded.Reconstruct())
+		}
+		// Decoded nodes are not trusted to match their original source until a snapshot is taken
+		if !reflect.DeepEqual(root.Reconstruct(), decoded.ReconstructLossless()) {
+			t.Errorf("Lossless reconstruction mismatch: Expected %v Got %v", root.Reconstruct(), decoded.ReconstructLossless())
+		}
+		ast.Snapshot(decoded)
+		if !reflect.DeepEqual(input, decoded.ReconstructLossless()) {
+			t.Errorf("Lossless reconstruction mismatch: Expected %v Got %v", input, decoded.ReconstructLossless())
+		}
+		again, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatalf("Encoding failed: %s", err.Error())
+		}
+		if string(data) != string(again) {
+			t.Errorf("Encoding not stable: Expected %s Got %s", data, again)
+		}
+	}
+}
+
+func TestJSONKinds(t *testing.T) {
+	root := testdata.Parse(t, []string{"FROM alpine", "ONBUILD USER root", ""})
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatalf("Encoding failed: %s", err.Error())
+	}
+	for _, expected := range []string{`"kind":"STAGE"`, `"kind":"ONBUILD"`, `"trigger":{"kind":"USER"`, `"kind":"EMPTY_LINE"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Encoding mismatch: Expected %s in %s", expected, data)
+		}
+	}
+	decoded := &ast.StageNode{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	onbuild, ok := decoded.Subsequent.Instructions[0].(*ast.OnbuildInstructionNode)
+	if !ok {
+		t.Fatalf("Type mismatch: Expected *ast.OnbuildInstructionNode Got %T", decoded.Subsequent.Instructions[0])
+	}
+	if user, ok := onbuild.Trigger.(*ast.UserInstructionNode); !ok || user.User != "root" {
+		t.Errorf("Trigger mismatch: Expected USER root Got %v", onbuild.Trigger)
+	}
+	if _, err := ast.UnmarshalInstruction([]byte(`{"kind":"NOPE"}`)); err == nil {
+		t.Errorf("Expected error for unknown kind")
+	}
+}
+
+func TestJSONExternalChange(t *testing.T) {
+	root := testdata.Parse(t, []string{"from alpine:3.19", "run  echo hi"})
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatalf("Encoding failed: %s", err.Error())
+	}
+	// Change the image the way an external tool would, the original source stays untouched
+	changed := strings.Replace(string(data), `"image":"alpine:3.19"`, `"image":"alpine:3.20"`, 1)
+	decoded := &ast.StageNode{}
+	if err := json.Unmarshal([]byte(changed), decoded); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	expected := []string{"FROM alpine:3.20", "RUN echo hi"}
+	if actual := decoded.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Lossless reconstruction mismatch: Expected %q Got %q", expected, actual)
+	}
+}
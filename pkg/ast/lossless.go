@@ -0,0 +1,67 @@
+package ast
+
+import "slices"
+
+// Record the current state of the stage and all subsequent stages
+// ReconstructLossless only keeps the original source of nodes that did not change since the last snapshot
+// The parser takes a snapshot of the root stage after parsing
+func Snapshot(root *StageNode) {
+	root.snapshot = make(map[Node][]string)
+	for stage := root; stage != nil; stage = stage.Subsequent {
+		root.snapshot[stage] = stage.reconstructHead()
+		for _, instruction := range stage.Instructions {
+			root.snapshot[instruction] = reconstructInstruction(instruction)
+		}
+	}
+}
+
+// Reconstruct the stage and all subsequent stages while keeping the original source of unmodified nodes
+// Nodes that were modified or created after the last snapshot are reconstructed the same way Reconstruct does
+// This keeps keyword casing, whitespace, quoting, flag ordering and line breaks of everything that was not edited
+func (sn *StageNode) ReconstructLossless() []string {
+	reconstructed := []string{}
+	for stage := sn; stage != nil; stage = stage.Subsequent {
+		reconstructed = append(reconstructed, sn.ReconstructNode(stage)...)
+		for _, instruction := range stage.Instructions {
+			reconstructed = append(reconstructed, sn.ReconstructNode(instruction)...)
+		}
+	}
+	return reconstructed
+}
+
+// Reconstruct a single node the same way ReconstructLossless does
+// The stage has to be the stage the snapshot was taken of
+func (sn *StageNode) ReconstructNode(node Node) []string {
+	switch n := node.(type) {
+	case *StageNode:
+		return sn.lossless(n, n.reconstructHead())
+	case InstructionNode:
+		return sn.lossless(n, reconstructInstruction(n))
+	}
+	return []string{}
+}
+
+// Check if the node changed since the snapshot of the stage was taken
+// Nodes without original source always count as modified
+func (sn *StageNode) IsModified(node Node) bool {
+	switch n := node.(type) {
+	case *StageNode:
+		return !sn.unchanged(n, n.reconstructHead())
+	case InstructionNode:
+		return !sn.unchanged(n, reconstructInstruction(n))
+	}
+	return true
+}
+
+func (sn *StageNode) unchanged(node Node, normalized []string) bool {
+	original, ok := sn.snapshot[node]
+	return ok && node.Info().Raw != nil && slices.Equal(original, normalized)
+}
+
+// Original source if the node is unmodified, the normalized reconstruction otherwise
+func (sn *StageNode) lossless(node Node, normalized []string) []string {
+	if sn.unchanged(node, normalized) {
+		return node.Info().Raw
+	}
+	return normalized
+}
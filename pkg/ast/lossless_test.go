@@ -0,0 +1,97 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestReconstructLosslessUnmodified(t *testing.T) {
+	inputs := [][]string{
+		{
+			"# syntax=docker/dockerfile:1",
+			"# Escape=\\",
+			"",
+			"from   alpine:3.20   as Build",
+			"  run apk add \\",
+			"    # trivia",
+			"    curl   git # inline",
+			"Copy --link --chown=root:root  [\"a b\", \"/c\"]",
+			"env B=2  A='1'",
+			"RUN <<EOT bash",
+			"  echo hi",
+			"EOT",
+			"",
+			"FROM scratch",
+			"CMD [ \"/app\" ]",
+		},
+		testdata.SampleDockerfile,
+	}
+	for _, input := range inputs {
+		root := testdata.Parse(t, input)
+		if actual := root.ReconstructLossless(); !reflect.DeepEqual(input, actual) {
+			t.Errorf("Lossless reconstruction mismatch: Expected %v Got %v", input, actual)
+		}
+	}
+}
+
+func TestReconstructLosslessModified(t *testing.T) {
+	input := []string{
+		"from alpine as base",
+		"run echo  a",
+		"env B=2  A=1",
+		"",
+		"FROM base",
+		"user   root",
+	}
+	root := testdata.Parse(t, input)
+	root.Subsequent.Instructions[1].(*ast.EnvInstructionNode).Pairs["C"] = "3"
+	root.Subsequent.Subsequent.Name = "final"
+	root.Subsequent.Instructions = append(root.Subsequent.Instructions, &ast.WorkdirInstructionNode{Path: "/app"})
+	expected := []string{
+		"from alpine as base",
+		"run echo  a",
+		"ENV B=2 A=1 C=3",
+		"",
+		"WORKDIR /app",
+		"FROM base AS final",
+		"user   root",
+	}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Lossless reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+	if root.IsModified(root.Subsequent.Instructions[0]) || !root.IsModified(root.Subsequent.Instructions[1]) {
+		t.Errorf("Modification mismatch: Expected only ENV to be modified")
+	}
+}
+
+func TestReconstructShellCommand(t *testing.T) {
+	input := []string{
+		"FROM alpine",
+		"run echo  a",
+		"CMD  echo  \"b  c\"",
+		"HEALTHCHECK --interval=5s CMD curl  -f localhost",
+	}
+	root := testdata.Parse(t, input)
+	instructions := root.Subsequent.Instructions
+	expected := [][]string{{"RUN echo  a"}, {"CMD echo  \"b  c\""}, {"HEALTHCHECK --interval=5s CMD curl  -f localhost"}}
+	for i := range expected {
+		if actual := instructions[i].Reconstruct(); !reflect.DeepEqual(expected[i], actual) {
+			t.Errorf("Reconstruction mismatch: Expected %v Got %v", expected[i], actual)
+		}
+	}
+	instructions[0].(*ast.RunInstructionNode).ShellCommand = "echo  bye"
+	instructions[2].(*ast.HealthcheckInstructionNode).ShellCommand = "true"
+	expectedLossless := []string{
+		"FROM alpine",
+		"RUN echo  bye",
+		"CMD  echo  \"b  c\"",
+		"HEALTHCHECK --interval=5s CMD true",
+	}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expectedLossless, actual) {
+		t.Errorf("Lossless reconstruction mismatch: Expected %v Got %v", expectedLossless, actual)
+	}
+}
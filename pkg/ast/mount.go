@@ -0,0 +1,320 @@
+package ast
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type MountType string
+
+const (
+	BindMount   MountType = "bind"
+	CacheMount  MountType = "cache"
+	TmpfsMount  MountType = "tmpfs"
+	SecretMount MountType = "secret"
+	SSHMount    MountType = "ssh"
+)
+
+// Options supported by each mount type, see https://docs.docker.com/reference/dockerfile/#run---mount
+var mountTypeOptions = map[MountType][]string{
+	BindMount:   {"type", "target", "source", "from", "readonly"},
+	CacheMount:  {"type", "target", "source", "from", "readonly", "id", "sharing", "mode", "uid", "gid"},
+	TmpfsMount:  {"type", "target", "size"},
+	SecretMount: {"type", "target", "id", "env", "required", "mode", "uid", "gid"},
+	SSHMount:    {"type", "target", "id", "required", "mode", "uid", "gid"},
+}
+
+// Spellings accepted by docker mapped to the option they set
+var mountAliases = map[string]string{
+	"type":        "type",
+	"target":      "target",
+	"dst":         "target",
+	"destination": "target",
+	"source":      "source",
+	"src":         "source",
+	"from":        "from",
+	"id":          "id",
+	"sharing":     "sharing",
+	"mode":        "mode",
+	"uid":         "uid",
+	"gid":         "gid",
+	"required":    "required",
+	"readonly":    "readonly",
+	"ro":          "readonly",
+	"readwrite":   "readonly",
+	"rw":          "readonly",
+	"size":        "size",
+	"env":         "env",
+}
+
+// Order in which options that were not part of the parsed mount are written
+var mountOptionOrder = []string{"type", "id", "from", "source", "target", "env", "sharing", "mode", "uid", "gid", "size", "readonly", "required"}
+
+// Typed representation of a RUN --mount option (e.g. type=cache,target=/root/.cache,sharing=locked)
+type Mount struct {
+	Type     MountType `json:"type"`
+	Target   string    `json:"target,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	From     string    `json:"from,omitempty"`
+	ID       string    `json:"id,omitempty"`
+	Sharing  string    `json:"sharing,omitempty"` // shared, private or locked
+	Mode     string    `json:"mode,omitempty"`    // Octal file mode as written, e.g. 0755
+	UID      *int      `json:"uid,omitempty"`
+	GID      *int      `json:"gid,omitempty"`
+	Required bool      `json:"required,omitempty"`
+	ReadOnly bool      `json:"readOnly,omitempty"` // Bind mounts are read only unless rw is set
+	Size     string    `json:"size,omitempty"`
+	Env      string    `json:"env,omitempty"` // Environment variable a secret is exposed as
+	options  []mountOption
+}
+
+// Option as written in the source, used to reconstruct the mount faithfully
+type mountOption struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// Parse a single mount as found in RunInstructionNode.Mount
+// Unknown options and options not supported by the mount type are reported as errors
+func ParseMount(mount string) (Mount, error) {
+	m := Mount{Type: BindMount}
+	for _, field := range strings.Split(mount, ",") {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(field), "=")
+		if key == "" {
+			return Mount{}, fmt.Errorf("empty mount option in %q", mount)
+		}
+		m.options = append(m.options, mountOption{key: key, value: value, hasValue: hasValue})
+		if mountAliases[strings.ToLower(key)] == "type" {
+			m.Type = MountType(strings.ToLower(value))
+		}
+	}
+	allowed, ok := mountTypeOptions[m.Type]
+	if !ok {
+		return Mount{}, fmt.Errorf("unknown mount type %q", m.Type)
+	}
+	m.ReadOnly = m.Type == BindMount
+	for _, o := range m.options {
+		name, ok := mountAliases[strings.ToLower(o.key)]
+		if !ok {
+			return Mount{}, fmt.Errorf("unknown mount option %q", o.key)
+		}
+		if !slices.Contains(allowed, name) {
+			return Mount{}, fmt.Errorf("mount option %q is not supported by type=%s", o.key, m.Type)
+		}
+		if err := m.set(name, o); err != nil {
+			return Mount{}, err
+		}
+	}
+	if m.Target == "" && m.Type != SecretMount && m.Type != SSHMount {
+		return Mount{}, fmt.Errorf("type=%s mount requires a target", m.Type)
+	}
+	return m, nil
+}
+
+func (m *Mount) set(name string, o mountOption) error {
+	if !o.hasValue && name != "readonly" && name != "required" {
+		return fmt.Errorf("mount option %q requires a value", o.key)
+	}
+	switch name {
+	case "target":
+		m.Target = o.value
+	case "source":
+		m.Source = o.value
+	case "from":
+		m.From = o.value
+	case "id":
+		m.ID = o.value
+	case "env":
+		m.Env = o.value
+	case "size":
+		m.Size = o.value
+	case "sharing":
+		if !slices.Contains([]string{"shared", "private", "locked"}, o.value) {
+			return fmt.Errorf("unknown sharing mode %q", o.value)
+		}
+		m.Sharing = o.value
+	case "mode":
+		if _, err := strconv.ParseUint(o.value, 8, 32); err != nil {
+			return fmt.Errorf("mode %q is not an octal number", o.value)
+		}
+		m.Mode = o.value
+	case "uid", "gid":
+		id, err := strconv.Atoi(o.value)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a number", name, o.value)
+		}
+		if name == "uid" {
+			m.UID = &id
+		} else {
+			m.GID = &id
+		}
+	case "readonly", "required":
+		value, err := boolOption(o)
+		if err != nil {
+			return err
+		}
+		if name == "required" {
+			m.Required = value
+		} else {
+			m.ReadOnly = value
+		}
+	}
+	return nil
+}
+
+// Value of a boolean option, rw and readwrite are the negation of readonly
+func boolOption(o mountOption) (bool, error) {
+	value := true
+	if o.hasValue {
+		var err error
+		if value, err = strconv.ParseBool(o.value); err != nil {
+			return false, fmt.Errorf("mount option %q requires a boolean value", o.key)
+		}
+	}
+	if isReadWrite(o.key) {
+		return !value, nil
+	}
+	return value, nil
+}
+
+func isReadWrite(key string) bool {
+	key = strings.ToLower(key)
+	return key == "rw" || key == "readwrite"
+}
+
+// Current value of the option, empty if it is not set
+func (m Mount) value(name string) string {
+	switch name {
+	case "type":
+		return string(m.Type)
+	case "target":
+		return m.Target
+	case "source":
+		return m.Source
+	case "from":
+		return m.From
+	case "id":
+		return m.ID
+	case "env":
+		return m.Env
+	case "size":
+		return m.Size
+	case "sharing":
+		return m.Sharing
+	case "mode":
+		return m.Mode
+	case "uid", "gid":
+		id := m.UID
+		if name == "gid" {
+			id = m.GID
+		}
+		if id == nil {
+			return ""
+		}
+		return strconv.Itoa(*id)
+	case "required":
+		return strconv.FormatBool(m.Required)
+	case "readonly":
+		return strconv.FormatBool(m.ReadOnly)
+	}
+	return ""
+}
+
+// Whether the option has the value docker uses if it is omitted
+func (m Mount) isDefault(name string) bool {
+	switch name {
+	case "type":
+		return m.Type == "" || m.Type == BindMount
+	case "readonly":
+		return m.ReadOnly == (m.Type == "" || m.Type == BindMount)
+	case "required":
+		return !m.Required
+	}
+	return m.value(name) == ""
+}
+
+// Mount option as written in a Dockerfile
+// Options are kept in the order and spelling they were parsed in, options set afterwards are appended
+func (m Mount) String() string {
+	written := map[string]bool{}
+	fields := []string{}
+	for _, o := range m.options {
+		name := mountAliases[strings.ToLower(o.key)]
+		value := m.value(name)
+		if value == "" {
+			continue
+		}
+		written[name] = true
+		if name == "readonly" || name == "required" {
+			current, _ := strconv.ParseBool(value)
+			if isReadWrite(o.key) {
+				current = !current
+			}
+			if original, err := boolOption(mountOption{key: name, value: o.value, hasValue: o.hasValue}); err == nil && original == current {
+				fields = append(fields, formatMountOption(o))
+			} else {
+				fields = append(fields, fmt.Sprintf("%s=%t", o.key, current))
+			}
+			continue
+		}
+		// Keep the original spelling of the value (e.g. Type=Bind or leading zeros of ids)
+		switch name {
+		case "type":
+			if strings.ToLower(o.value) == value {
+				value = o.value
+			}
+		case "uid", "gid":
+			if id, err := strconv.Atoi(o.value); err == nil && strconv.Itoa(id) == value {
+				value = o.value
+			}
+		}
+		fields = append(fields, fmt.Sprintf("%s=%s", o.key, value))
+	}
+	for _, name := range mountOptionOrder {
+		if written[name] || m.isDefault(name) {
+			continue
+		}
+		switch name {
+		case "readonly":
+			if m.ReadOnly {
+				fields = append(fields, "ro")
+			} else {
+				fields = append(fields, "rw")
+			}
+		default:
+			fields = append(fields, fmt.Sprintf("%s=%s", name, m.value(name)))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func formatMountOption(o mountOption) string {
+	if !o.hasValue {
+		return o.key
+	}
+	return fmt.Sprintf("%s=%s", o.key, o.value)
+}
+
+// Typed mounts of the instruction
+func (ri *RunInstructionNode) Mounts() ([]Mount, error) {
+	mounts := make([]Mount, len(ri.Mount))
+	for i, mount := range ri.Mount {
+		m, err := ParseMount(mount)
+		if err != nil {
+			return nil, err
+		}
+		mounts[i] = m
+	}
+	return mounts, nil
+}
+
+// Replace the mounts of the instruction
+func (ri *RunInstructionNode) SetMounts(mounts []Mount) {
+	ri.Mount = make([]string, len(mounts))
+	for i, m := range mounts {
+		ri.Mount[i] = m.String()
+	}
+}
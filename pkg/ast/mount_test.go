@@ -0,0 +1,146 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestParseMount(t *testing.T) {
+	m, err := ast.ParseMount("type=cache,target=/root/.cache,id=pip,sharing=locked,mode=0755,uid=1000,gid=0,ro")
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	if m.Type != ast.CacheMount || m.Target != "/root/.cache" || m.ID != "pip" || m.Sharing != "locked" || m.Mode != "0755" || !m.ReadOnly {
+		t.Errorf("Mount mismatch: Got %+v", m)
+	}
+	if m.UID == nil || *m.UID != 1000 || m.GID == nil || *m.GID != 0 {
+		t.Errorf("Owner mismatch: Got %v %v", m.UID, m.GID)
+	}
+
+	testCases := map[string]ast.Mount{
+		"target=/src":                           {Type: ast.BindMount, Target: "/src", ReadOnly: true},
+		"type=bind,from=build,src=/out,dst=/in": {Type: ast.BindMount, From: "build", Source: "/out", Target: "/in", ReadOnly: true},
+		"type=bind,target=/src,rw":              {Type: ast.BindMount, Target: "/src"},
+		"type=tmpfs,destination=/tmp,size=64m":  {Type: ast.TmpfsMount, Target: "/tmp", Size: "64m"},
+		"type=secret,id=aws,required":           {Type: ast.SecretMount, ID: "aws", Required: true},
+		"type=secret,id=token,env=TOKEN":        {Type: ast.SecretMount, ID: "token", Env: "TOKEN"},
+		"type=ssh,required=false":               {Type: ast.SSHMount},
+	}
+	for input, expected := range testCases {
+		actual, err := ast.ParseMount(input)
+		if err != nil {
+			t.Errorf("Parsing %q failed: %s", input, err.Error())
+			continue
+		}
+		if actual.Type != expected.Type || actual.Target != expected.Target || actual.Source != expected.Source || actual.From != expected.From ||
+			actual.ID != expected.ID || actual.Size != expected.Size || actual.Env != expected.Env || actual.Required != expected.Required || actual.ReadOnly != expected.ReadOnly {
+			t.Errorf("Mount mismatch for %q: Expected %+v Got %+v", input, expected, actual)
+		}
+	}
+}
+
+func TestParseMountErrors(t *testing.T) {
+	testCases := map[string]string{
+		"type=volume,target=/data":           "unknown mount type",
+		"type=cache,target=/data,color=blue": "unknown mount option",
+		"type=tmpfs,target=/tmp,from=build":  "not supported by type=tmpfs",
+		"type=cache,target=/data,size=1g":    "not supported by type=cache",
+		"type=cache":                         "requires a target",
+		"type=cache,target=/data,sharing=no": "unknown sharing mode",
+		"type=cache,target=/data,uid=root":   "not a number",
+		"type=cache,target=/data,mode=0999":  "not an octal number",
+		"type=bind,target":                   "requires a value",
+		"type=bind,target=/src,ro=maybe":     "requires a boolean value",
+		"test1":                              "unknown mount option",
+	}
+	for input, expected := range testCases {
+		_, err := ast.ParseMount(input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error mismatch for %q: Expected %q Got %v", input, expected, err)
+		}
+	}
+}
+
+func TestMountString(t *testing.T) {
+	// Unmodified mounts are written as parsed
+	for _, input := range []string{
+		"target=/src",
+		"type=cache,target=/root/.cache,sharing=locked,uid=0100",
+		"Type=Bind,src=.,dst=/src,rw",
+		"type=secret,id=aws,required",
+		"type=bind,target=/src,readonly=false",
+	} {
+		m, err := ast.ParseMount(input)
+		if err != nil {
+			t.Fatalf("Parsing %q failed: %s", input, err.Error())
+		}
+		if actual := m.String(); actual != input {
+			t.Errorf("Reconstruction mismatch: Expected %q Got %q", input, actual)
+		}
+	}
+
+	testCases := []struct {
+		Input    string
+		Modify   func(m *ast.Mount)
+		Expected string
+	}{
+		{
+			Input:    "type=cache,dst=/cache",
+			Modify:   func(m *ast.Mount) { m.Target = "/root/.cache"; m.Sharing = "locked" },
+			Expected: "type=cache,dst=/root/.cache,sharing=locked",
+		},
+		{
+			Input:    "type=bind,target=/src,rw",
+			Modify:   func(m *ast.Mount) { m.ReadOnly = true },
+			Expected: "type=bind,target=/src,rw=false",
+		},
+		{
+			Input:    "type=bind,from=build,target=/src",
+			Modify:   func(m *ast.Mount) { m.From = ""; m.ReadOnly = false },
+			Expected: "type=bind,target=/src,rw",
+		},
+		{
+			Input:    "type=secret,id=aws",
+			Modify:   func(m *ast.Mount) { uid := 1000; m.UID = &uid; m.Required = true },
+			Expected: "type=secret,id=aws,uid=1000,required=true",
+		},
+	}
+	for _, c := range testCases {
+		m, err := ast.ParseMount(c.Input)
+		if err != nil {
+			t.Fatalf("Parsing %q failed: %s", c.Input, err.Error())
+		}
+		c.Modify(&m)
+		if actual := m.String(); actual != c.Expected {
+			t.Errorf("Reconstruction mismatch: Expected %q Got %q", c.Expected, actual)
+		}
+	}
+	if actual := (ast.Mount{Type: ast.CacheMount, Target: "/go/pkg/mod"}).String(); actual != "type=cache,target=/go/pkg/mod" {
+		t.Errorf("Reconstruction mismatch: Expected %q Got %q", "type=cache,target=/go/pkg/mod", actual)
+	}
+}
+
+func TestRunMounts(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM golang",
+		"RUN --mount=type=cache,target=/go/pkg/mod --mount=type=secret,id=netrc,target=/root/.netrc [\"go\", \"build\"]",
+	})
+	run := root.Subsequent.Instructions[0].(*ast.RunInstructionNode)
+	mounts, err := run.Mounts()
+	if err != nil {
+		t.Fatalf("Parsing the mounts failed: %s", err.Error())
+	}
+	if len(mounts) != 2 || mounts[0].Type != ast.CacheMount || mounts[1].Type != ast.SecretMount || mounts[1].ID != "netrc" {
+		t.Fatalf("Mounts mismatch: Got %+v", mounts)
+	}
+	mounts[0].Sharing = "locked"
+	run.SetMounts(mounts)
+	expected := "RUN --mount=type=cache,target=/go/pkg/mod,sharing=locked --mount=type=secret,id=netrc,target=/root/.netrc [\"go\",\"build\"]"
+	if actual := root.ReconstructLossless(); actual[len(actual)-1] != expected {
+		t.Errorf("Reconstruction mismatch: Expected %q Got %q", expected, actual[len(actual)-1])
+	}
+}
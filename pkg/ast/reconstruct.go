@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/json"
 	"fmt"
 	"slices"
 	"strconv"
@@ -14,13 +15,46 @@ func formatIfValue(fstring, value string) string {
 	return fmt.Sprintf(fstring, value)
 }
 
+// Boolean flag, only written if it is set as docker defaults all of them to false
+func formatBool(flag string, value bool) string {
+	if !value {
+		return ""
+	}
+	return flag + " "
+}
+
+// Flag for every value, used for flags that can be repeated
+func formatFlags(fstring string, values []string) string {
+	var sb strings.Builder
+	for _, v := range values {
+		sb.WriteString(formatIfValue(fstring, v))
+	}
+	return sb.String()
+}
+
+// JSON string of the value, unlike json.Marshal characters like & and < are not escaped
+func quote(value string) string {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Keys are stored unquoted, keys that would not be read back as a single key are written in double quotes
+func quoteKey(key string) string {
+	if key != "" && !strings.ContainsAny(key, " \t=\"'\\`$") {
+		return key
+	}
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "$", "\\$")
+	return "\"" + replacer.Replace(key) + "\""
+}
+
 func escapeSlice[T any](slice []T) string {
 	var sb strings.Builder
 	sb.WriteString("[")
 	for i, v := range slice {
-		sb.WriteRune('"')
-		sb.WriteString(fmt.Sprintf("%v", v))
-		sb.WriteRune('"')
+		sb.WriteString(quote(fmt.Sprintf("%v", v)))
 		if i != len(slice)-1 {
 			sb.WriteRune(',')
 		}
@@ -29,18 +63,45 @@ func escapeSlice[T any](slice []T) string {
 	return sb.String()
 }
 
-func (sn *StageNode) Reconstruct() []string {
+// Shell form commands are written as they are, the exec form as JSON array
+func reconstructCommand(cmd []string, shellForm bool, shellCommand string) string {
+	if shellForm {
+		return shellCommand
+	}
+	return escapeSlice(cmd)
+}
+
+// Lines of the heredoc bodies including their delimiters
+func reconstructHeredocs(heredocs []Heredoc) []string {
 	reconstructed := []string{}
-	if sn.Image != "" {
-		var fromInstruction strings.Builder
-		fromInstruction.WriteString(fmt.Sprintf("FROM %s", sn.Image))
-		if sn.Name != "" {
-			fromInstruction.WriteString(fmt.Sprintf(" AS %s", sn.Name))
+	for _, h := range heredocs {
+		if len(h.Body) != 0 {
+			reconstructed = append(reconstructed, strings.Split(strings.TrimSuffix(h.Body, "\n"), "\n")...)
 		}
-		reconstructed = append(reconstructed, fromInstruction.String())
+		reconstructed = append(reconstructed, h.Name)
 	}
+	return reconstructed
+}
+
+// Comments in between continuation lines are emitted before the instruction
+// This is equivalent for docker as these comments are removed before the instruction is evaluated
+func reconstructComments(comments []string) []string {
+	reconstructed := make([]string, len(comments))
+	for i, c := range comments {
+		reconstructed[i] = fmt.Sprintf("#%s", c)
+	}
+	return reconstructed
+}
+
+// Instruction including the comments found in between its continuation lines
+func reconstructInstruction(node InstructionNode) []string {
+	return append(reconstructComments(node.Info().Comments), node.Reconstruct()...)
+}
+
+func (sn *StageNode) Reconstruct() []string {
+	reconstructed := sn.reconstructHead()
 	for _, instructionNode := range sn.Instructions {
-		reconstructed = append(reconstructed, instructionNode.Reconstruct()...)
+		reconstructed = append(reconstructed, reconstructInstruction(instructionNode)...)
 	}
 	if sn.Subsequent == nil {
 		return reconstructed
@@ -48,64 +109,85 @@ func (sn *StageNode) Reconstruct() []string {
 	return append(reconstructed, sn.Subsequent.Reconstruct()...)
 }
 
+// Parser directives and FROM instruction of the stage
+func (sn *StageNode) reconstructHead() []string {
+	reconstructed := []string{}
+	// Parser directives have to be kept as they may change how the file is lexed (e.g. escape)
+	directives := make([]string, 0, len(sn.ParserMetadata))
+	for k := range sn.ParserMetadata {
+		directives = append(directives, k)
+	}
+	slices.Sort(directives)
+	for _, k := range directives {
+		reconstructed = append(reconstructed, fmt.Sprintf("# %s=%s", k, sn.ParserMetadata[k]))
+	}
+	if sn.Image != "" {
+		reconstructed = append(reconstructed, reconstructComments(sn.Comments)...)
+		var fromInstruction strings.Builder
+		fromInstruction.WriteString("FROM ")
+		fromInstruction.WriteString(formatIfValue("--platform=%s ", sn.Platform))
+		fromInstruction.WriteString(sn.Image)
+		if sn.Name != "" {
+			fromInstruction.WriteString(fmt.Sprintf(" AS %s", sn.Name))
+		}
+		reconstructed = append(reconstructed, fromInstruction.String())
+	}
+	return reconstructed
+}
+
 func (ai *AddInstructionNode) Reconstruct() []string {
 	reconstructed := fmt.Sprintf("%s ", ai.Instruction())
-	reconstructed += formatIfValue("--keep-git-dir=%s ", strconv.FormatBool(ai.KeepGitDir))
+	reconstructed += formatBool("--keep-git-dir", ai.KeepGitDir)
 	reconstructed += formatIfValue("--checksum=%s ", ai.CheckSum)
 	reconstructed += formatIfValue("--chown=%s ", ai.Chown)
 	reconstructed += formatIfValue("--chmod=%s ", ai.Chmod)
-	reconstructed += formatIfValue("--link=%s ", strconv.FormatBool(ai.Link))
-	reconstructed += formatIfValue("--exclude=%s ", ai.Exclude)
+	reconstructed += formatBool("--link", ai.Link)
+	reconstructed += formatFlags("--exclude=%s ", ai.Exclude)
+	reconstructed += formatFlags("%s ", ai.UnknownFlags)
 	reconstructed += fmt.Sprintf("%s ", strings.Join(ai.Source, " "))
 	reconstructed += fmt.Sprintf("%s", ai.Destination)
-	return []string{reconstructed}
+	return append([]string{reconstructed}, reconstructHeredocs(ai.Heredocs)...)
 }
 
 func (ai *ArgInstructionNode) Reconstruct() []string {
 	reconstructed := fmt.Sprintf("%s", ai.Instruction())
-	keys := make([]string, len(ai.Pairs))
-	index := 0
-	for k := range ai.Pairs {
-		keys[index] = k
-		index++
-	}
-	slices.Sort(keys)
-	for _, k := range keys {
+	for _, k := range ai.Keys() {
 		reconstructed += fmt.Sprintf(" %s=%s", k, ai.Pairs[k])
 	}
 	return []string{reconstructed}
 }
 
 func (ci *CmdInstructionNode) Reconstruct() []string {
-	reconstructed := fmt.Sprintf("%s %s", ci.Instruction(), escapeSlice(ci.Cmd))
+	reconstructed := fmt.Sprintf("%s %s", ci.Instruction(), reconstructCommand(ci.Cmd, ci.ShellForm, ci.ShellCommand))
 	return []string{reconstructed}
 }
 func (ci *CopyInstructionNode) Reconstruct() []string {
 	var reconstructed strings.Builder
 	reconstructed.WriteString(fmt.Sprintf("%s ", ci.Instruction()))
 
-	reconstructed.WriteString(formatIfValue("--keep-git-dir=%s ", strconv.FormatBool(ci.KeepGitDir)))
 	reconstructed.WriteString(formatIfValue("--chown=%s ", ci.Chown))
-	reconstructed.WriteString(formatIfValue("--link=%s ", strconv.FormatBool(ci.Link)))
+	reconstructed.WriteString(formatIfValue("--chmod=%s ", ci.Chmod))
+	reconstructed.WriteString(formatBool("--link", ci.Link))
+	reconstructed.WriteString(formatBool("--parents", ci.Parents))
 	reconstructed.WriteString(formatIfValue("--from=%s ", ci.From))
+	reconstructed.WriteString(formatFlags("--exclude=%s ", ci.Exclude))
+	reconstructed.WriteString(formatFlags("%s ", ci.UnknownFlags))
 	reconstructed.WriteString(fmt.Sprintf("%s ", strings.Join(ci.Source, " ")))
 	reconstructed.WriteString(fmt.Sprintf("%s", ci.Destination))
-	return []string{reconstructed.String()}
+	return append([]string{reconstructed.String()}, reconstructHeredocs(ci.Heredocs)...)
 }
 func (ei *EntrypointInstructionNode) Reconstruct() []string {
-	reconstructed := fmt.Sprintf("%s %s", ei.Instruction(), escapeSlice(ei.Exec))
+	reconstructed := fmt.Sprintf("%s %s", ei.Instruction(), reconstructCommand(ei.Exec, ei.ShellForm, ei.ShellCommand))
 	return []string{reconstructed}
 }
 func (ei *EnvInstructionNode) Reconstruct() []string {
 	var reconstructed strings.Builder
 	reconstructed.WriteString(fmt.Sprintf("%s", ei.Instruction()))
-	keys := make([]string, len(ei.Pairs))
-	index := 0
-	for k := range ei.Pairs {
-		keys[index] = k
-		index++
+	keys := ei.Keys()
+	if ei.Legacy && len(keys) == 1 {
+		reconstructed.WriteString(fmt.Sprintf(" %s %s", keys[0], ei.Pairs[keys[0]]))
+		return []string{reconstructed.String()}
 	}
-	slices.Sort(keys)
 	for _, k := range keys {
 		reconstructed.WriteString(fmt.Sprintf(" %s=%s", k, ei.Pairs[k]))
 	}
@@ -116,11 +198,7 @@ func (ei *ExposeInstructionNode) Reconstruct() []string {
 	var reconstructed strings.Builder
 	reconstructed.WriteString(fmt.Sprintf("%s", ei.Instruction()))
 	for _, port := range ei.Ports {
-		protocol := "tcp"
-		if !port.IsTCP {
-			protocol = "udp"
-		}
-		reconstructed.WriteString(fmt.Sprintf(" %s/%s", port.Port, protocol))
+		reconstructed.WriteString(fmt.Sprintf(" %s/%s", port.Port, port.Proto()))
 	}
 	return []string{reconstructed.String()}
 }
@@ -131,26 +209,32 @@ func (hi *HealthcheckInstructionNode) Reconstruct() []string {
 		reconstructed.WriteString("NONE")
 		return []string{reconstructed.String()}
 	}
-	reconstructed.WriteString(formatIfValue("--interval=%s ", hi.Interval))
-	reconstructed.WriteString(formatIfValue("--timeout=%s ", hi.Timeout))
-	reconstructed.WriteString(formatIfValue("--start-period=%s ", hi.StartPeriod))
-	reconstructed.WriteString(formatIfValue("--start-interval=%s ", hi.StartInterval))
-	reconstructed.WriteString(formatIfValue("--retries=%s ", strconv.Itoa(hi.Retries)))
-	reconstructed.WriteString(escapeSlice(hi.Cmd))
+	// Defaulted flags are left out so the output matches the source
+	flags := []struct{ name, value string }{
+		{"interval", hi.Interval},
+		{"timeout", hi.Timeout},
+		{"start-period", hi.StartPeriod},
+		{"start-interval", hi.StartInterval},
+		{"retries", strconv.Itoa(hi.Retries)},
+	}
+	for _, flag := range flags {
+		if hi.IsSet(flag.name) {
+			reconstructed.WriteString(formatIfValue("--"+flag.name+"=%s ", flag.value))
+		}
+	}
+	reconstructed.WriteString(fmt.Sprintf("CMD %s", reconstructCommand(hi.Cmd, hi.ShellForm, hi.ShellCommand)))
 	return []string{reconstructed.String()}
 }
 func (li *LabelInstructionNode) Reconstruct() []string {
 	var reconstructed strings.Builder
 	reconstructed.WriteString(fmt.Sprintf("%s", li.Instruction()))
-	keys := make([]string, len(li.Pairs))
-	index := 0
-	for k := range li.Pairs {
-		keys[index] = k
-		index++
+	keys := li.Keys()
+	if li.Legacy && len(keys) == 1 {
+		reconstructed.WriteString(fmt.Sprintf(" %s %s", quoteKey(keys[0]), li.Pairs[keys[0]]))
+		return []string{reconstructed.String()}
 	}
-	slices.Sort(keys)
 	for _, k := range keys {
-		reconstructed.WriteString(fmt.Sprintf(" %s=%s", k, li.Pairs[k]))
+		reconstructed.WriteString(fmt.Sprintf(" %s=%s", quoteKey(k), li.Pairs[k]))
 	}
 	return []string{reconstructed.String()}
 }
@@ -167,15 +251,19 @@ func (oi *OnbuildInstructionNode) Reconstruct() []string {
 func (ri *RunInstructionNode) Reconstruct() []string {
 	var reconstructed strings.Builder
 	reconstructed.WriteString(fmt.Sprintf("%s ", ri.Instruction()))
-	if !ri.ShellForm && !ri.IsHeredoc {
+	for _, mount := range ri.Mount {
+		reconstructed.WriteString(fmt.Sprintf("--mount=%s ", mount))
+	}
+	reconstructed.WriteString(formatIfValue("--network=%s ", ri.Network))
+	reconstructed.WriteString(formatIfValue("--security=%s ", ri.Security))
+	reconstructed.WriteString(formatIfValue("--device=%s ", ri.Device))
+	if !ri.ShellForm && len(ri.Heredocs) == 0 {
 		reconstructed.WriteString(escapeSlice(ri.Cmd))
 		return []string{reconstructed.String()}
 	}
-	if ri.IsHeredoc {
-		reconstructed.WriteString("<< ")
-	}
-	ri.Cmd[0] = reconstructed.String() + ri.Cmd[0]
-	return ri.Cmd
+	// The heredoc markers are part of the command
+	reconstructed.WriteString(ri.ShellCommand)
+	return append([]string{reconstructed.String()}, reconstructHeredocs(ri.Heredocs)...)
 }
 func (si *ShellInstructionNode) Reconstruct() []string {
 	reconstructed := fmt.Sprintf("%s %s", si.Instruction(), escapeSlice(si.Shell))
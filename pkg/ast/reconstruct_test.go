@@ -30,6 +30,16 @@ func TestReconstructStage(t *testing.T) {
 			},
 			Expected: []string{"FROM debian:latest"},
 		},
+		{
+			Input: ast.StageNode{
+				ParserMetadata: map[string]string{"syntax": "docker/dockerfile:1", "escape": "`"},
+				Instructions: []ast.InstructionNode{
+					&ast.WorkdirInstructionNode{Path: "C:\\app"},
+				},
+				Subsequent: &ast.StageNode{Image: "mcr.microsoft.com/windows/servercore"},
+			},
+			Expected: []string{"# escape=`", "# syntax=docker/dockerfile:1", "WORKDIR C:\\app", "FROM mcr.microsoft.com/windows/servercore"},
+		},
 	}
 	for _, testCase := range expected {
 		actual := testCase.Input.Reconstruct()
@@ -52,7 +62,7 @@ func TestReconstructInstruction(t *testing.T) {
 					},
 				},
 			},
-			Expected: []string{"ADD --keep-git-dir=true --checksum=checksum --link=false ./abc ./def /home/new"},
+			Expected: []string{"ADD --keep-git-dir --checksum=checksum ./abc ./def /home/new"},
 		},
 		{
 			Input: ast.StageNode{
@@ -101,7 +111,7 @@ func TestReconstructInstruction(t *testing.T) {
 					},
 				},
 			},
-			Expected: []string{"COPY --keep-git-dir=false --link=true --from=build ./abc ./def /home/new"},
+			Expected: []string{"COPY --link --from=build ./abc ./def /home/new"},
 		},
 		{
 			Input: ast.StageNode{
@@ -132,12 +142,12 @@ func TestReconstructInstruction(t *testing.T) {
 					&ast.ExposeInstructionNode{
 						Ports: []ast.PortInfo{
 							{
-								Port:  "8080",
-								IsTCP: false,
+								Port:     "8080",
+								Protocol: "udp",
 							},
 							{
-								Port:  "3000",
-								IsTCP: true,
+								Port:     "3000",
+								Protocol: "tcp",
 							},
 						},
 					},
@@ -155,10 +165,26 @@ func TestReconstructInstruction(t *testing.T) {
 						StartInterval: "34s",
 						Retries:       3,
 						Cmd:           []string{"curl", "localhost:8080/health"},
+						SetFlags:      []string{"retries"},
+					},
+				},
+			},
+			Expected: []string{"HEALTHCHECK --interval=31s --timeout=32s --start-period=33s --start-interval=34s --retries=3 CMD [\"curl\",\"localhost:8080/health\"]"},
+		},
+		{
+			Input: ast.StageNode{
+				Instructions: []ast.InstructionNode{
+					&ast.HealthcheckInstructionNode{
+						Interval:      "10s",
+						Timeout:       ast.DefaultHealthcheckTimeout,
+						StartPeriod:   ast.DefaultHealthcheckStartPeriod,
+						StartInterval: ast.DefaultHealthcheckStartInterval,
+						Retries:       ast.DefaultHealthcheckRetries,
+						Cmd:           []string{"true"},
 					},
 				},
 			},
-			Expected: []string{"HEALTHCHECK --interval=31s --timeout=32s --start-period=33s --start-interval=34s --retries=3 [\"curl\",\"localhost:8080/health\"]"},
+			Expected: []string{"HEALTHCHECK --interval=10s CMD [\"true\"]"},
 		},
 		{
 			Input: ast.StageNode{
@@ -210,24 +236,26 @@ func TestReconstructInstruction(t *testing.T) {
 				Instructions: []ast.InstructionNode{
 					&ast.OnbuildInstructionNode{
 						Trigger: &ast.RunInstructionNode{
-							Cmd:       []string{"EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
-							IsHeredoc: true,
+							ShellForm:    true,
+							ShellCommand: "<<EOF",
+							IsHeredoc:    true,
+							Heredocs:     []ast.Heredoc{{Name: "EOF", Body: "apt install curl\ncurl ssh-coffee.dev\n", Expand: true}},
 						},
 					},
 				},
 			},
-			Expected: []string{"ONBUILD RUN << EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
+			Expected: []string{"ONBUILD RUN <<EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
 		},
 		{
 			Input: ast.StageNode{
 				Instructions: []ast.InstructionNode{
 					&ast.RunInstructionNode{
-						Cmd:       []string{"curl google.com"},
-						ShellForm: true,
+						ShellForm:    true,
+						ShellCommand: "curl  google.com",
 					},
 				},
 			},
-			Expected: []string{"RUN curl google.com"},
+			Expected: []string{"RUN curl  google.com"},
 		},
 		{
 			Input: ast.StageNode{
@@ -244,12 +272,43 @@ func TestReconstructInstruction(t *testing.T) {
 			Input: ast.StageNode{
 				Instructions: []ast.InstructionNode{
 					&ast.RunInstructionNode{
-						Cmd:       []string{"EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
-						IsHeredoc: true,
+						ShellForm:    true,
+						ShellCommand: "<<EOF",
+						IsHeredoc:    true,
+						Heredocs:     []ast.Heredoc{{Name: "EOF", Body: "apt install curl\ncurl ssh-coffee.dev\n", Expand: true}},
+					},
+				},
+			},
+			Expected: []string{"RUN <<EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
+		},
+		{
+			Input: ast.StageNode{
+				Instructions: []ast.InstructionNode{
+					&ast.RunInstructionNode{
+						ShellForm:    true,
+						ShellCommand: "python3 <<A && cat <<'B'",
+						IsHeredoc:    true,
+						Heredocs: []ast.Heredoc{
+							{Name: "A", Body: "print(1)\n", Expand: true},
+							{Name: "B", Expand: false},
+						},
+					},
+				},
+			},
+			Expected: []string{"RUN python3 <<A && cat <<'B'", "print(1)", "A", "B"},
+		},
+		{
+			Input: ast.StageNode{
+				Instructions: []ast.InstructionNode{
+					&ast.CopyInstructionNode{
+						Source:      []string{"<<EOF"},
+						Destination: "/etc/motd",
+						IsHereDoc:   true,
+						Heredocs:    []ast.Heredoc{{Name: "EOF", Body: "hello\n", Expand: true}},
 					},
 				},
 			},
-			Expected: []string{"RUN << EOF", "apt install curl", "curl ssh-coffee.dev", "EOF"},
+			Expected: []string{"COPY <<EOF /etc/motd", "hello", "EOF"},
 		},
 		{
 			Input: ast.StageNode{
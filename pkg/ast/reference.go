@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"strings"
+)
+
+const (
+	DefaultRegistry  = "docker.io"
+	officialPrefix   = "library/"
+	legacyRegistry   = "index.docker.io"
+	localhostAddress = "localhost"
+)
+
+// Image reference as used by FROM
+// Images without a registry are normalized to Docker Hub, single component repositories of Docker Hub get the library/ prefix
+type Reference struct {
+	Registry   string `json:"registry,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`    // Empty if not set, docker uses latest in that case
+	Digest     string `json:"digest,omitempty"` // e.g. sha256:...
+}
+
+// Parse an image reference like alpine, ghcr.io/org/app:1.0 or alpine@sha256:...
+func ParseReference(image string) Reference {
+	ref := Reference{}
+	rest := image
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		rest, ref.Digest = name, digest
+	}
+	// A colon after the last slash separates the tag, colons before belong to the registry port
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, ref.Tag = rest[:i], rest[i+1:]
+	}
+	first, remainder, hasSlash := strings.Cut(rest, "/")
+	if hasSlash && (strings.ContainsAny(first, ".:") || first == localhostAddress) {
+		ref.Registry, ref.Repository = first, remainder
+	} else {
+		ref.Registry, ref.Repository = DefaultRegistry, rest
+	}
+	if ref.Registry == legacyRegistry {
+		ref.Registry = DefaultRegistry
+	}
+	if ref.Registry == DefaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = officialPrefix + ref.Repository
+	}
+	return ref
+}
+
+// Fully qualified reference
+func (r Reference) String() string {
+	var sb strings.Builder
+	sb.WriteString(r.Registry)
+	sb.WriteString("/")
+	sb.WriteString(r.Repository)
+	if r.Tag != "" {
+		sb.WriteString(":" + r.Tag)
+	}
+	if r.Digest != "" {
+		sb.WriteString("@" + r.Digest)
+	}
+	return sb.String()
+}
+
+// Shortest form of the reference as used by the docker cli (e.g. alpine:3.20 instead of docker.io/library/alpine:3.20)
+func (r Reference) Familiar() string {
+	full := r.String()
+	if r.Registry != DefaultRegistry {
+		return full
+	}
+	full = strings.TrimPrefix(full, DefaultRegistry+"/")
+	return strings.TrimPrefix(full, officialPrefix)
+}
+
+// Neither a tag nor a digest is set
+func (r Reference) IsUntagged() bool {
+	return r.Tag == "" && r.Digest == ""
+}
@@ -0,0 +1,39 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+)
+
+func TestParseReference(t *testing.T) {
+	testCases := map[string]ast.Reference{
+		"alpine":                             {Registry: "docker.io", Repository: "library/alpine"},
+		"alpine:3.20":                        {Registry: "docker.io", Repository: "library/alpine", Tag: "3.20"},
+		"bitnami/redis:7":                    {Registry: "docker.io", Repository: "bitnami/redis", Tag: "7"},
+		"index.docker.io/nginx":              {Registry: "docker.io", Repository: "library/nginx"},
+		"ghcr.io/org/team/app:v1@sha256:abc": {Registry: "ghcr.io", Repository: "org/team/app", Tag: "v1", Digest: "sha256:abc"},
+		"localhost:5000/app":                 {Registry: "localhost:5000", Repository: "app"},
+		"localhost/app:dev":                  {Registry: "localhost", Repository: "app", Tag: "dev"},
+		"golang@sha256:def":                  {Registry: "docker.io", Repository: "library/golang", Digest: "sha256:def"},
+	}
+	for input, expected := range testCases {
+		if actual := ast.ParseReference(input); actual != expected {
+			t.Errorf("Reference mismatch for %s: Expected %+v Got %+v", input, expected, actual)
+		}
+	}
+}
+
+func TestReferenceString(t *testing.T) {
+	ref := ast.ParseReference("alpine:3.20")
+	if ref.String() != "docker.io/library/alpine:3.20" || ref.Familiar() != "alpine:3.20" {
+		t.Errorf("Reference string mismatch: Got %s %s", ref.String(), ref.Familiar())
+	}
+	ref = ast.ParseReference("ghcr.io/org/app@sha256:abc")
+	if ref.String() != "ghcr.io/org/app@sha256:abc" || ref.Familiar() != ref.String() {
+		t.Errorf("Reference string mismatch: Got %s %s", ref.String(), ref.Familiar())
+	}
+	if ref.IsUntagged() || !ast.ParseReference("alpine").IsUntagged() {
+		t.Errorf("Untagged mismatch")
+	}
+}
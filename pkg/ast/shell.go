@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/shell"
+)
+
+// Shell syntax tree of the command
+// Returns nil if the exec form is used
+// If the command only consists of heredocs (e.g. RUN <<EOF) the body of the first heredoc is parsed as it is what the shell executes
+func (ri *RunInstructionNode) Script() (*shell.Script, error) {
+	if ri.ShellCommand == "" {
+		return nil, nil
+	}
+	script, err := shell.Parse(ri.ShellCommand)
+	if err != nil || len(ri.Heredocs) == 0 || !onlyHeredocs(script) {
+		return script, err
+	}
+	return shell.Parse(ri.Heredocs[0].Body)
+}
+
+func onlyHeredocs(script *shell.Script) bool {
+	if len(script.Stmts) != 1 || script.Stmts[0].Cmd != nil {
+		return false
+	}
+	for _, redirect := range script.Stmts[0].Redirs {
+		if redirect.Op != "<<" && redirect.Op != "<<-" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestRunScript(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"RUN apt-get update && \\",
+		"    curl -fsSL https://example.com | sh",
+		"RUN [\"echo\", \"exec\"]",
+		"RUN <<EOF",
+		"set -e",
+		"make install",
+		"EOF",
+	})
+	testCases := [][]string{
+		{"apt-get", "curl", "sh"},
+		nil,
+		{"set", "make"},
+	}
+	for i, expected := range testCases {
+		run := root.Subsequent.Instructions[i].(*ast.RunInstructionNode)
+		script, err := run.Script()
+		if err != nil {
+			t.Fatalf("Parsing the script of instruction %d failed: %s", i, err.Error())
+		}
+		if expected == nil {
+			if script != nil {
+				t.Errorf("Expected no script for the exec form")
+			}
+			continue
+		}
+		actual := []string{}
+		for _, call := range script.Commands() {
+			actual = append(actual, call.Name())
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Commands mismatch for instruction %d: Expected %v Got %v", i, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package ast
+
+// A Visitor's Visit method is invoked for each node encountered by Walk
+// If the result visitor w is not nil, Walk visits each of the children of node with the visitor w, followed by a call of w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Traverse the tree in depth-first order
+// Children of a stage are its instructions followed by the subsequent stage
+// The child of an ONBUILD instruction is its trigger
+func Walk(node Node, v Visitor) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *StageNode:
+		for _, instruction := range n.Instructions {
+			Walk(instruction, v)
+		}
+		if n.Subsequent != nil {
+			Walk(n.Subsequent, v)
+		}
+	case *OnbuildInstructionNode:
+		if n.Trigger != nil {
+			Walk(n.Trigger, v)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Traverse the tree in depth-first order calling f for each node
+// If f returns true, Inspect is called recursively for the children of the node, followed by a call of f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(node, inspector(f))
+}
+
+// Visitor calling the hook matching the type of each node
+// Unset hooks are skipped, Node is called before the typed hook and can prevent the traversal of the children by returning false
+type TypedVisitor struct {
+	Node        func(Node) bool
+	Stage       func(*StageNode)
+	Add         func(*AddInstructionNode)
+	Arg         func(*ArgInstructionNode)
+	Cmd         func(*CmdInstructionNode)
+	Copy        func(*CopyInstructionNode)
+	Entrypoint  func(*EntrypointInstructionNode)
+	Env         func(*EnvInstructionNode)
+	Expose      func(*ExposeInstructionNode)
+	Healthcheck func(*HealthcheckInstructionNode)
+	Label       func(*LabelInstructionNode)
+	Maintainer  func(*MaintainerInstructionNode)
+	Onbuild     func(*OnbuildInstructionNode)
+	Run         func(*RunInstructionNode)
+	Shell       func(*ShellInstructionNode)
+	Stopsignal  func(*StopsignalInstructionNode)
+	User        func(*UserInstructionNode)
+	Volume      func(*VolumeInstructionNode)
+	Workdir     func(*WorkdirInstructionNode)
+	Comment     func(*CommentInstructionNode)
+	EmptyLine   func(*EmptyLineNode)
+	Unknown     func(*UnknownInstructionNode)
+}
+
+func (tv *TypedVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	if tv.Node != nil && !tv.Node(node) {
+		return nil
+	}
+	switch n := node.(type) {
+	case *StageNode:
+		call(tv.Stage, n)
+	case *AddInstructionNode:
+		call(tv.Add, n)
+	case *ArgInstructionNode:
+		call(tv.Arg, n)
+	case *CmdInstructionNode:
+		call(tv.Cmd, n)
+	case *CopyInstructionNode:
+		call(tv.Copy, n)
+	case *EntrypointInstructionNode:
+		call(tv.Entrypoint, n)
+	case *EnvInstructionNode:
+		call(tv.Env, n)
+	case *ExposeInstructionNode:
+		call(tv.Expose, n)
+	case *HealthcheckInstructionNode:
+		call(tv.Healthcheck, n)
+	case *LabelInstructionNode:
+		call(tv.Label, n)
+	case *MaintainerInstructionNode:
+		call(tv.Maintainer, n)
+	case *OnbuildInstructionNode:
+		call(tv.Onbuild, n)
+	case *RunInstructionNode:
+		call(tv.Run, n)
+	case *ShellInstructionNode:
+		call(tv.Shell, n)
+	case *StopsignalInstructionNode:
+		call(tv.Stopsignal, n)
+	case *UserInstructionNode:
+		call(tv.User, n)
+	case *VolumeInstructionNode:
+		call(tv.Volume, n)
+	case *WorkdirInstructionNode:
+		call(tv.Workdir, n)
+	case *CommentInstructionNode:
+		call(tv.Comment, n)
+	case *EmptyLineNode:
+		call(tv.EmptyLine, n)
+	case *UnknownInstructionNode:
+		call(tv.Unknown, n)
+	}
+	return tv
+}
+
+func call[T Node](hook func(T), node T) {
+	if hook != nil {
+		hook(node)
+	}
+}
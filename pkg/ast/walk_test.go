@@ -0,0 +1,70 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestInspect(t *testing.T) {
+	root := testdata.Parse(t, []string{"ARG A", "FROM alpine AS base", "ONBUILD RUN echo", "FROM base", "USER root"})
+	visited := []string{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			visited = append(visited, "nil")
+			return true
+		}
+		visited = append(visited, ast.Kind(n))
+		return true
+	})
+	expected := []string{"STAGE", "ARG", "nil", "STAGE", "ONBUILD", "RUN", "nil", "nil", "STAGE", "USER", "nil", "nil", "nil", "nil"}
+	if !reflect.DeepEqual(expected, visited) {
+		t.Errorf("Visit order mismatch: Expected %v Got %v", expected, visited)
+	}
+
+	// Children of skipped nodes are not visited
+	visited = []string{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n != nil {
+			visited = append(visited, ast.Kind(n))
+		}
+		_, isOnbuild := n.(*ast.OnbuildInstructionNode)
+		return !isOnbuild
+	})
+	expected = []string{"STAGE", "ARG", "STAGE", "ONBUILD", "STAGE", "USER"}
+	if !reflect.DeepEqual(expected, visited) {
+		t.Errorf("Visit order mismatch: Expected %v Got %v", expected, visited)
+	}
+}
+
+func TestTypedVisitor(t *testing.T) {
+	root := testdata.Parse(t, []string{"FROM alpine", "RUN a", "ONBUILD RUN b", "USER root", "FROM scratch", "RUN c"})
+	runs := []string{}
+	stages := 0
+	ast.Walk(root, &ast.TypedVisitor{
+		Stage: func(*ast.StageNode) { stages++ },
+		Run:   func(r *ast.RunInstructionNode) { runs = append(runs, r.ShellCommand) },
+	})
+	if !reflect.DeepEqual([]string{"a", "b", "c"}, runs) {
+		t.Errorf("RUN mismatch: Expected %v Got %v", []string{"a", "b", "c"}, runs)
+	}
+	if stages != 3 {
+		t.Errorf("Stage count mismatch: Expected %d Got %d", 3, stages)
+	}
+
+	// Skip everything below the first stage with a FROM
+	users := 0
+	ast.Walk(root, &ast.TypedVisitor{
+		Node: func(n ast.Node) bool {
+			s, ok := n.(*ast.StageNode)
+			return !ok || s.Image == ""
+		},
+		User: func(*ast.UserInstructionNode) { users++ },
+	})
+	if users != 0 {
+		t.Errorf("USER count mismatch: Expected %d Got %d", 0, users)
+	}
+}
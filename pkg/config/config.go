@@ -0,0 +1,176 @@
+// Package computing the configuration of the image a stage results in
+package config
+
+import (
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/expand"
+)
+
+// Health check of the image
+// Test is ["NONE"] if the health check of the base image was disabled, ["CMD", ...] or ["CMD-SHELL", command] otherwise
+type Healthcheck struct {
+	Test          []string `json:"test,omitempty"`
+	Interval      string   `json:"interval,omitempty"`
+	Timeout       string   `json:"timeout,omitempty"`
+	StartPeriod   string   `json:"startPeriod,omitempty"`
+	StartInterval string   `json:"startInterval,omitempty"`
+	Retries       int      `json:"retries,omitempty"`
+}
+
+// Configuration of the image resulting from a stage
+// Values are taken as written, use the expand package to resolve variables before computing the configuration
+type Config struct {
+	Env          map[string]string `json:"env,omitempty"`
+	EnvOrder     []string          `json:"envOrder,omitempty"` // Keys of Env in the order they were declared first
+	User         string            `json:"user,omitempty"`
+	WorkingDir   string            `json:"workingDir,omitempty"`
+	Entrypoint   []string          `json:"entrypoint,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty"`
+	ExposedPorts []string          `json:"exposedPorts,omitempty"` // port/protocol in the order they were exposed first
+	Volumes      []string          `json:"volumes,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	StopSignal   string            `json:"stopSignal,omitempty"`
+	Healthcheck  *Healthcheck      `json:"healthcheck,omitempty"`
+	Shell        []string          `json:"shell,omitempty"`
+}
+
+// Shell running shell form commands if SHELL is not used
+var DefaultShell = []string{"/bin/sh", "-c"}
+
+// Empty configuration
+func New() *Config {
+	return &Config{Env: map[string]string{}, Labels: map[string]string{}, ExposedPorts: []string{}, Volumes: []string{}}
+}
+
+// Deep copy of the configuration
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.Env = maps.Clone(c.Env)
+	clone.EnvOrder = slices.Clone(c.EnvOrder)
+	clone.Labels = maps.Clone(c.Labels)
+	clone.Entrypoint = slices.Clone(c.Entrypoint)
+	clone.Cmd = slices.Clone(c.Cmd)
+	clone.ExposedPorts = slices.Clone(c.ExposedPorts)
+	clone.Volumes = slices.Clone(c.Volumes)
+	clone.Shell = slices.Clone(c.Shell)
+	if c.Healthcheck != nil {
+		healthcheck := *c.Healthcheck
+		healthcheck.Test = slices.Clone(c.Healthcheck.Test)
+		clone.Healthcheck = &healthcheck
+	}
+	return &clone
+}
+
+// Fold the instructions of the stage into the configuration of the base image
+// base is not modified, nil is treated as an empty configuration
+// escape is the escape character of the file (see ast.StageNode.Escape) used to unquote ENV and LABEL values
+func Compute(stage *ast.StageNode, base *Config, escape byte) *Config {
+	res := New()
+	if base != nil {
+		res = base.Clone()
+	}
+	// ENTRYPOINT only resets CMD if it was inherited from the base image
+	cmdSet := false
+	for _, instruction := range stage.Instructions {
+		switch n := instruction.(type) {
+		case *ast.EnvInstructionNode:
+			for _, key := range n.Keys() {
+				// Like docker a redeclared variable keeps its position
+				if _, ok := res.Env[key]; !ok {
+					res.EnvOrder = append(res.EnvOrder, key)
+				}
+				res.Env[key] = expand.Unquote(n.Pairs[key], escape)
+			}
+		case *ast.LabelInstructionNode:
+			for _, key := range n.Keys() {
+				res.Labels[key] = expand.Unquote(n.Pairs[key], escape)
+			}
+		case *ast.UserInstructionNode:
+			res.User = n.User
+		case *ast.WorkdirInstructionNode:
+			res.WorkingDir = resolveWorkdir(res.WorkingDir, n.Path)
+		case *ast.CmdInstructionNode:
+			res.Cmd = command(n.Cmd, n.ShellForm, n.ShellCommand, res.Shell)
+			cmdSet = true
+		case *ast.EntrypointInstructionNode:
+			res.Entrypoint = command(n.Exec, n.ShellForm, n.ShellCommand, res.Shell)
+			if !cmdSet {
+				res.Cmd = nil
+			}
+		case *ast.ExposeInstructionNode:
+			for _, port := range n.Ports {
+				if p := port.Port + "/" + port.Proto(); !slices.Contains(res.ExposedPorts, p) {
+					res.ExposedPorts = append(res.ExposedPorts, p)
+				}
+			}
+		case *ast.VolumeInstructionNode:
+			for _, volume := range n.Mounts {
+				if !slices.Contains(res.Volumes, volume) {
+					res.Volumes = append(res.Volumes, volume)
+				}
+			}
+		case *ast.StopsignalInstructionNode:
+			res.StopSignal = n.Signal
+		case *ast.HealthcheckInstructionNode:
+			res.Healthcheck = healthcheckOf(n)
+		case *ast.ShellInstructionNode:
+			res.Shell = slices.Clone(n.Shell)
+		}
+	}
+	return res
+}
+
+// Relative paths are relative to the previous WORKDIR, the initial WORKDIR is /
+func resolveWorkdir(current, workdir string) string {
+	if path.IsAbs(workdir) {
+		return path.Clean(workdir)
+	}
+	if current == "" {
+		current = "/"
+	}
+	return path.Join(current, workdir)
+}
+
+// Shell form commands are run by the shell active at the instruction
+func command(cmd []string, shellForm bool, shellCommand string, shell []string) []string {
+	if !shellForm {
+		return slices.Clone(cmd)
+	}
+	if len(shell) == 0 {
+		shell = DefaultShell
+	}
+	return append(slices.Clone(shell), shellCommand)
+}
+
+func healthcheckOf(n *ast.HealthcheckInstructionNode) *Healthcheck {
+	if n.CancelStatement {
+		return &Healthcheck{Test: []string{"NONE"}}
+	}
+	// Like docker only flags that were set are stored, the defaults are applied when the container runs
+	healthcheck := &Healthcheck{}
+	if n.IsSet("interval") {
+		healthcheck.Interval = n.Interval
+	}
+	if n.IsSet("timeout") {
+		healthcheck.Timeout = n.Timeout
+	}
+	if n.IsSet("start-period") {
+		healthcheck.StartPeriod = n.StartPeriod
+	}
+	if n.IsSet("start-interval") {
+		healthcheck.StartInterval = n.StartInterval
+	}
+	if n.IsSet("retries") {
+		healthcheck.Retries = n.Retries
+	}
+	if n.ShellForm {
+		healthcheck.Test = []string{"CMD-SHELL", n.ShellCommand}
+	} else {
+		healthcheck.Test = append([]string{"CMD"}, n.Cmd...)
+	}
+	return healthcheck
+}
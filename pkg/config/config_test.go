@@ -0,0 +1,102 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/config"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestCompute(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"ENV A=1 B=\"two words\"",
+		"ENV A=3",
+		"LABEL org.opencontainers.image.title=\"app\"",
+		"LABEL \"com.example.vendor\"='ACME Inc.'",
+		"USER nobody",
+		"WORKDIR /srv",
+		"WORKDIR app",
+		"WORKDIR ../data",
+		"EXPOSE 80 53/udp",
+		"EXPOSE 80/tcp",
+		"VOLUME /data /cache",
+		"VOLUME /data",
+		"STOPSIGNAL SIGTERM",
+		"SHELL [\"/bin/bash\", \"-c\"]",
+		"HEALTHCHECK --interval=5s CMD curl -f http://localhost",
+		"CMD [\"serve\"]",
+		"ENTRYPOINT [\"/app\"]",
+	})
+	expected := &config.Config{
+		Env:          map[string]string{"A": "3", "B": "two words"},
+		EnvOrder:     []string{"A", "B"},
+		User:         "nobody",
+		WorkingDir:   "/srv/data",
+		Entrypoint:   []string{"/app"},
+		Cmd:          []string{"serve"},
+		ExposedPorts: []string{"80/tcp", "53/udp"},
+		Volumes:      []string{"/data", "/cache"},
+		Labels:       map[string]string{"org.opencontainers.image.title": "app", "com.example.vendor": "ACME Inc."},
+		StopSignal:   "SIGTERM",
+		Healthcheck: &config.Healthcheck{
+			Test:     []string{"CMD-SHELL", "curl -f http://localhost"},
+			Interval: "5s",
+		},
+		Shell: []string{"/bin/bash", "-c"},
+	}
+	actual := config.Compute(root.Subsequent, nil, root.Escape())
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Config mismatch: Expected %+v Got %+v", expected, actual)
+	}
+}
+
+func TestComputeWithBase(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS base",
+		"ENV A=1",
+		"WORKDIR /srv",
+		"CMD [\"serve\"]",
+		"HEALTHCHECK CMD [\"check\", \"--quick\"]",
+		"FROM base AS next",
+		"WORKDIR data",
+		"ENTRYPOINT [\"/app\"]",
+		"HEALTHCHECK NONE",
+	})
+	stages := root.Stages()
+	base := config.Compute(stages[0], nil, root.Escape())
+	if !reflect.DeepEqual([]string{"CMD", "check", "--quick"}, base.Healthcheck.Test) {
+		t.Errorf("Healthcheck mismatch: Got %v", base.Healthcheck.Test)
+	}
+	next := config.Compute(stages[1], base, root.Escape())
+	if next.Cmd != nil {
+		t.Errorf("Expected inherited CMD to be reset by ENTRYPOINT, Got %v", next.Cmd)
+	}
+	if next.WorkingDir != "/srv/data" || next.Env["A"] != "1" {
+		t.Errorf("Inherited config mismatch: Got workdir %s env %v", next.WorkingDir, next.Env)
+	}
+	if !reflect.DeepEqual([]string{"NONE"}, next.Healthcheck.Test) {
+		t.Errorf("Expected healthcheck to be disabled, Got %v", next.Healthcheck.Test)
+	}
+	if !reflect.DeepEqual([]string{"serve"}, base.Cmd) {
+		t.Errorf("Base config must not be modified, Got %v", base.Cmd)
+	}
+}
+
+func TestComputeShellForm(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"ENTRYPOINT exec /app --port 80",
+		"SHELL [\"/bin/bash\", \"-c\"]",
+		"CMD echo \"a,  b\"",
+	})
+	actual := config.Compute(root.Subsequent, nil, root.Escape())
+	if expected := []string{"/bin/sh", "-c", "exec /app --port 80"}; !reflect.DeepEqual(expected, actual.Entrypoint) {
+		t.Errorf("Entrypoint mismatch: Expected %q Got %q", expected, actual.Entrypoint)
+	}
+	if expected := []string{"/bin/bash", "-c", "echo \"a,  b\""}; !reflect.DeepEqual(expected, actual.Cmd) {
+		t.Errorf("Cmd mismatch: Expected %q Got %q", expected, actual.Cmd)
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/graph"
+)
+
+// Healthcheck as stored by docker in the image config, durations are encoded in nanoseconds
+type OCIHealthcheck struct {
+	Test          []string      `json:"Test,omitempty"`
+	Interval      time.Duration `json:"Interval,omitempty"`
+	Timeout       time.Duration `json:"Timeout,omitempty"`
+	StartPeriod   time.Duration `json:"StartPeriod,omitempty"`
+	StartInterval time.Duration `json:"StartInterval,omitempty"`
+	Retries       int           `json:"Retries,omitempty"`
+}
+
+// config object of the OCI image specification
+// Healthcheck is not part of the specification but added by docker
+type OCIConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+	Healthcheck  *OCIHealthcheck     `json:"Healthcheck,omitempty"`
+}
+
+// Configuration of the stage including everything inherited from the stages it is based on
+// The configuration of base images that are not stages is unknown and treated as empty
+func Resolve(root *ast.StageNode, stage *ast.StageNode) *Config {
+	chain := []*ast.StageNode{}
+	for current := stage; current != nil; current = root.Resolve(ast.Dependency{Name: current.Image, Node: current}) {
+		chain = append(chain, current)
+	}
+	var res *Config
+	for _, s := range slices.Backward(chain) {
+		res = Compute(s, res, root.Escape())
+	}
+	return res
+}
+
+// OCI representation of the configuration
+func (c *Config) OCI() (*OCIConfig, error) {
+	res := &OCIConfig{
+		User:       c.User,
+		Entrypoint: slices.Clone(c.Entrypoint),
+		Cmd:        slices.Clone(c.Cmd),
+		WorkingDir: c.WorkingDir,
+		StopSignal: c.StopSignal,
+	}
+	for _, key := range ast.OrderedKeys(c.EnvOrder, c.Env) {
+		res.Env = append(res.Env, key+"="+c.Env[key])
+	}
+	if len(c.ExposedPorts) != 0 {
+		res.ExposedPorts = set(c.ExposedPorts)
+	}
+	if len(c.Volumes) != 0 {
+		res.Volumes = set(c.Volumes)
+	}
+	if len(c.Labels) != 0 {
+		res.Labels = maps.Clone(c.Labels)
+	}
+	if c.Healthcheck != nil {
+		healthcheck, err := c.Healthcheck.oci()
+		if err != nil {
+			return nil, err
+		}
+		res.Healthcheck = healthcheck
+	}
+	return res, nil
+}
+
+func set(values []string) map[string]struct{} {
+	res := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		res[value] = struct{}{}
+	}
+	return res
+}
+
+func (h *Healthcheck) oci() (*OCIHealthcheck, error) {
+	res := &OCIHealthcheck{Test: slices.Clone(h.Test), Retries: h.Retries}
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{h.Interval, &res.Interval},
+		{h.Timeout, &res.Timeout},
+		{h.StartPeriod, &res.StartPeriod},
+		{h.StartInterval, &res.StartInterval},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck duration %q: %w", d.value, err)
+		}
+		*d.target = duration
+	}
+	return res, nil
+}
+
+// OCI image config of the target stage encoded as JSON
+// An empty target selects the last stage
+func ExportOCI(root *ast.StageNode, target string) ([]byte, error) {
+	stage, err := graph.Build(root).Target(target)
+	if err != nil {
+		return nil, err
+	}
+	oci, err := Resolve(root, stage).OCI()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(oci, "", "  ")
+}
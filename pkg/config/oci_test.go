@@ -0,0 +1,167 @@
+package config_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/config"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/graph"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestExportOCI(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS base",
+		"ENV PATH=/usr/bin B=2",
+		"WORKDIR /srv",
+		"CMD [\"serve\"]",
+		"FROM golang AS unrelated",
+		"USER root",
+		"FROM base AS final",
+		"ENV A=1",
+		"WORKDIR app",
+		"EXPOSE 8080",
+		"VOLUME /data",
+		"LABEL version=1.0",
+		"HEALTHCHECK --interval=5s --timeout=1m CMD [\"check\"]",
+	})
+	data, err := config.ExportOCI(root, "")
+	if err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+	actual := map[string]any{}
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	expected := map[string]any{
+		"Env":          []any{"PATH=/usr/bin", "B=2", "A=1"},
+		"Cmd":          []any{"serve"},
+		"WorkingDir":   "/srv/app",
+		"ExposedPorts": map[string]any{"8080/tcp": map[string]any{}},
+		"Volumes":      map[string]any{"/data": map[string]any{}},
+		"Labels":       map[string]any{"version": "1.0"},
+		"Healthcheck": map[string]any{
+			"Test":     []any{"CMD", "check"},
+			"Interval": float64(5 * time.Second),
+			"Timeout":  float64(time.Minute),
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("OCI config mismatch: Expected %v Got %v", expected, actual)
+	}
+	if _, err := config.ExportOCI(root, "missing"); err == nil {
+		t.Errorf("Expected error for unknown target")
+	}
+}
+
+func TestInvalidHealthcheckDuration(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"HEALTHCHECK --interval=often CMD check",
+	})
+	if _, err := config.Resolve(root, root.Subsequent).OCI(); err == nil {
+		t.Errorf("Expected error for invalid duration")
+	}
+}
+
+func TestExportHealthcheckFlags(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS plain",
+		"HEALTHCHECK CMD curl -f http://x",
+		"FROM alpine AS explicit",
+		"HEALTHCHECK --retries=3 --start-period=0s CMD curl -f http://x",
+	})
+	testCases := map[string]config.OCIHealthcheck{
+		"plain":    {Test: []string{"CMD-SHELL", "curl -f http://x"}},
+		"explicit": {Test: []string{"CMD-SHELL", "curl -f http://x"}, Retries: 3},
+	}
+	for target, expected := range testCases {
+		stage, _ := graph.Build(root).Target(target)
+		oci, err := config.Resolve(root, stage).OCI()
+		if err != nil {
+			t.Fatalf("Export failed: %s", err.Error())
+		}
+		if !reflect.DeepEqual(&expected, oci.Healthcheck) {
+			t.Errorf("Healthcheck mismatch for %s: Expected %+v Got %+v", target, expected, oci.Healthcheck)
+		}
+	}
+	// Values changed after parsing count as set
+	healthcheck := root.Subsequent.Instructions[0].(*ast.HealthcheckInstructionNode)
+	healthcheck.Interval = "10s"
+	if oci, _ := config.Resolve(root, root.Subsequent).OCI(); oci.Healthcheck.Interval != 10*time.Second {
+		t.Errorf("Interval mismatch: Expected %v Got %v", 10*time.Second, oci.Healthcheck.Interval)
+	}
+}
+
+func TestExportEnvOrder(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS base",
+		"ENV B=2 A=1",
+		"FROM base",
+		"ENV B=3 C=4",
+	})
+	oci, err := config.Resolve(root, root.Subsequent.Subsequent).OCI()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+	expected := []string{"B=3", "A=1", "C=4"}
+	if !reflect.DeepEqual(expected, oci.Env) {
+		t.Errorf("Env mismatch: Expected %q Got %q", expected, oci.Env)
+	}
+}
+
+func TestExportHash(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"ENV URL=http://x/#y",
+		"LABEL ref=a#b",
+	})
+	oci, err := config.Resolve(root, root.Subsequent).OCI()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+	if expected := []string{"URL=http://x/#y"}; !reflect.DeepEqual(expected, oci.Env) {
+		t.Errorf("Env mismatch: Expected %q Got %q", expected, oci.Env)
+	}
+	if expected := map[string]string{"ref": "a#b"}; !reflect.DeepEqual(expected, oci.Labels) {
+		t.Errorf("Labels mismatch: Expected %q Got %q", expected, oci.Labels)
+	}
+}
+
+func TestExportEscapeDirective(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"# escape=`",
+		"FROM mcr.microsoft.com/windows/servercore",
+		"ENV DIR=C:\\\\tools\\\\bin QUOTE=`\"a`\"",
+		"LABEL path=\"C:\\app\"",
+	})
+	oci, err := config.Resolve(root, root.Subsequent).OCI()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+	if expected := []string{"DIR=C:\\\\tools\\\\bin", "QUOTE=\"a\""}; !reflect.DeepEqual(expected, oci.Env) {
+		t.Errorf("Env mismatch: Expected %q Got %q", expected, oci.Env)
+	}
+	if expected := map[string]string{"path": "C:\\app"}; !reflect.DeepEqual(expected, oci.Labels) {
+		t.Errorf("Labels mismatch: Expected %q Got %q", expected, oci.Labels)
+	}
+}
+
+func TestExportExposeProtocol(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"EXPOSE 80/TCP 9000/sctp 53/UDP 8080",
+	})
+	oci, err := config.Resolve(root, root.Subsequent).OCI()
+	if err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+	expected := map[string]struct{}{"80/tcp": {}, "9000/sctp": {}, "53/udp": {}, "8080/tcp": {}}
+	if !reflect.DeepEqual(expected, oci.ExposedPorts) {
+		t.Errorf("Exposed ports mismatch: Expected %v Got %v", expected, oci.ExposedPorts)
+	}
+}
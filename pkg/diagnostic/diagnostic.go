@@ -0,0 +1,124 @@
+// Package containing the diagnostics reported by the lexer and parser
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Info:
+		return "info"
+	}
+	return "unknown"
+}
+
+// Severities are encoded by name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	severity, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+	*s = severity
+	return nil
+}
+
+// Severity with the name as returned by String
+func ParseSeverity(name string) (Severity, error) {
+	for _, candidate := range []Severity{Error, Warning, Info} {
+		if candidate.String() == name {
+			return candidate, nil
+		}
+	}
+	return Error, fmt.Errorf("unknown severity %q", name)
+}
+
+// Codes of the diagnostics reported by the lexer and parser
+const (
+	IllegalInstruction  = "illegal-instruction"
+	UnknownToken        = "unknown-token"
+	MissingArgument     = "missing-argument"
+	InvalidOnbuild      = "invalid-onbuild"
+	UnterminatedHeredoc = "unterminated-heredoc"
+	InvalidMount        = "invalid-mount"
+	UnknownFlag         = "unknown-flag"
+	InvalidFlag         = "invalid-flag"
+	InvalidAssignment   = "invalid-assignment"
+)
+
+// A single problem found in the input
+type Diagnostic struct {
+	Severity Severity       `json:"severity"`
+	Code     string         `json:"code"`
+	Message  string         `json:"message"`
+	Start    token.Position `json:"start"`
+	End      token.Position `json:"end"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s [%s]", d.Start.Line, d.Start.Column, d.Severity, d.Message, d.Code)
+}
+
+// Create a diagnostic spanning the passed token
+func FromToken(t token.Token, severity Severity, code, message string) Diagnostic {
+	return Diagnostic{Severity: severity, Code: code, Message: message, Start: t.Start, End: t.End}
+}
+
+// List of diagnostics
+// The list satisfies the error interface so it can be returned as error directly
+type List []Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+	for i, d := range l {
+		messages[i] = d.String()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Only the diagnostics with error severity
+func (l List) Errors() List {
+	res := List{}
+	for _, d := range l {
+		if d.Severity == Error {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func (l List) HasErrors() bool {
+	return len(l.Errors()) != 0
+}
+
+// Return the errors of the list as error or nil if there are none
+func (l List) Err() error {
+	if errs := l.Errors(); len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package diagnostic_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
+)
+
+func TestListErrors(t *testing.T) {
+	list := diagnostic.List{
+		{Severity: diagnostic.Warning, Code: diagnostic.UnknownFlag, Message: "warn"},
+		{Severity: diagnostic.Error, Code: diagnostic.IllegalInstruction, Message: "illegal", Start: token.Position{Line: 2, Column: 1}},
+	}
+	if !list.HasErrors() {
+		t.Errorf("Expected list to contain errors")
+	}
+	if len(list.Errors()) != 1 {
+		t.Errorf("Error count mismatch: Expected %d Got %d", 1, len(list.Errors()))
+	}
+	expected := "2:1: error: illegal [illegal-instruction]"
+	if err := list.Err(); err == nil || err.Error() != expected {
+		t.Errorf("Error message mismatch: Expected %s Got %v", expected, err)
+	}
+	if err := list[:1].Err(); err != nil {
+		t.Errorf("Expected no error for warnings only Got %v", err)
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	d := diagnostic.Diagnostic{Severity: diagnostic.Warning, Code: diagnostic.UnknownFlag, Message: "warn", Start: token.Position{Line: 1, Column: 2}}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Encoding failed: %s", err.Error())
+	}
+	expected := `{"severity":"warning","code":"unknown-flag","message":"warn","start":{"line":1,"column":2},"end":{"line":0,"column":0}}`
+	if string(data) != expected {
+		t.Errorf("Encoding mismatch: Expected %s Got %s", expected, data)
+	}
+	decoded := diagnostic.Diagnostic{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Decoding failed: %s", err.Error())
+	}
+	if decoded != d {
+		t.Errorf("Decoding mismatch: Expected %v Got %v", d, decoded)
+	}
+}
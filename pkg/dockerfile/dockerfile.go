@@ -0,0 +1,31 @@
+// Package to lex and parse a Dockerfile in a single call
+package dockerfile
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+)
+
+// Parse the Dockerfile read from r
+// The error contains the diagnostics with error severity, the ast is returned regardless if lexing succeeded
+func Parse(r io.Reader) (*ast.StageNode, error) {
+	l, err := lexer.NewFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := l.Lex()
+	if err != nil {
+		return nil, err
+	}
+	p := parser.NewParser(tokens)
+	return p.Parse()
+}
+
+// Parse the Dockerfile contained in data
+func ParseBytes(data []byte) (*ast.StageNode, error) {
+	return Parse(bytes.NewReader(data))
+}
@@ -0,0 +1,61 @@
+package dockerfile_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/dockerfile"
+)
+
+func TestParse(t *testing.T) {
+	long := strings.Repeat("a", 100*1024)
+	testCases := map[string]string{
+		"LF":        "FROM alpine\nRUN echo " + long + "\n",
+		"CRLF":      "FROM alpine\r\nRUN echo \\\r\n  " + long + "\r\n",
+		"BOM":       "\uFEFFFROM alpine\nRUN echo " + long,
+		"BOM, CRLF": "\uFEFFFROM alpine\r\nRUN echo " + long + "\r\n",
+	}
+	for name, input := range testCases {
+		root, err := dockerfile.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("Parsing %s failed: %s", name, err.Error())
+			continue
+		}
+		if root.Subsequent == nil || root.Subsequent.Image != "alpine" {
+			t.Errorf("Image mismatch for %s: Got %v", name, root.Subsequent)
+			continue
+		}
+		run := root.Subsequent.Instructions[0].(*ast.RunInstructionNode)
+		if cmd := run.ShellCommand; !strings.HasSuffix(cmd, long) || strings.Contains(cmd, "\r") {
+			t.Errorf("RUN mismatch for %s: Got %q", name, cmd[max(0, len(cmd)-20):])
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	root, err := dockerfile.ParseBytes([]byte("FROM alpine AS base\r\nENV A=1\r\n"))
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	expected := []string{"FROM alpine AS base", "ENV A=1"}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruction mismatch: Expected %q Got %q", expected, actual)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := dockerfile.Parse(iotest.ErrReader(errors.New("read failed"))); err == nil || err.Error() != "read failed" {
+		t.Errorf("Error mismatch: Expected %q Got %v", "read failed", err)
+	}
+	root, err := dockerfile.ParseBytes([]byte("FROM alpine\nADD ./only-destination\n"))
+	if err == nil {
+		t.Errorf("Expected parsing to fail")
+	}
+	if root == nil || len(root.Subsequent.Instructions) != 1 {
+		t.Errorf("Expected ast to be returned despite errors")
+	}
+}
@@ -0,0 +1,273 @@
+// Package resolving variables in the operands of Dockerfile instructions following the scoping rules of docker
+package expand
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+)
+
+// Platform arguments docker provides in the global scope without declaring them
+var AutomaticArgs = []string{
+	"TARGETPLATFORM", "TARGETOS", "TARGETARCH", "TARGETVARIANT",
+	"BUILDPLATFORM", "BUILDOS", "BUILDARCH", "BUILDVARIANT",
+}
+
+// Options of the expansion
+type Options struct {
+	BuildArgs map[string]string // Values passed with --build-arg, they override the defaults of ARG
+}
+
+// Variables visible at a point of the Dockerfile
+// ENV variables take precedence over ARG variables with the same name
+type Scope struct {
+	args   map[string]string
+	env    map[string]string
+	escape byte
+}
+
+func newScope(escape byte) *Scope {
+	return &Scope{args: map[string]string{}, env: map[string]string{}, escape: escape}
+}
+
+func (s *Scope) clone() *Scope {
+	return &Scope{args: maps.Clone(s.args), env: maps.Clone(s.env), escape: s.escape}
+}
+
+// Value of the variable, ok is false if the variable is not set
+func (s *Scope) Lookup(name string) (string, bool) {
+	if value, ok := s.env[name]; ok {
+		return value, true
+	}
+	value, ok := s.args[name]
+	return value, ok
+}
+
+// Expand the variables of the word using the variables of the scope
+func (s *Scope) Expand(word string) (string, error) {
+	return expandWord(word, s.escape, s.Lookup)
+}
+
+// Copy of the ENV variables of the scope
+func (s *Scope) Env() map[string]string {
+	return maps.Clone(s.env)
+}
+
+// Copy of the ARG variables of the scope
+func (s *Scope) Args() map[string]string {
+	return maps.Clone(s.args)
+}
+
+// Remove quotes and escape characters from the word like the shell would do
+func Unquote(word string, escape byte) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case quote == '\'' && c != '\'':
+			sb.WriteByte(c)
+		case c == escape && i+1 < len(word) && (quote == 0 || word[i+1] == '"' || word[i+1] == escape || word[i+1] == '$'):
+			i++
+			sb.WriteByte(word[i])
+		case (c == '"' || c == '\'') && (quote == 0 || quote == c):
+			if quote == 0 {
+				quote = c
+			} else {
+				quote = 0
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// Expanded view of a Dockerfile
+// The view is based on a copy of the tree, the original nodes and their source text are not modified
+type View struct {
+	Root   *ast.StageNode
+	nodes  map[ast.Node]ast.Node
+	scopes map[ast.Node]*Scope
+}
+
+// Expand the operands of all instructions of the tree
+// FROM only sees the ARGs declared before the first FROM, every stage starts with an empty set of ARGs
+// A stage based on another stage inherits its ENV variables
+// Operands of RUN, CMD, ENTRYPOINT, SHELL, HEALTHCHECK and ONBUILD are left as they are, they are evaluated by the shell or a later build
+func New(root *ast.StageNode, opts Options) (*View, error) {
+	clone := root.Clone()
+	v := &View{Root: clone, nodes: map[ast.Node]ast.Node{}, scopes: map[ast.Node]*Scope{}}
+	originals, copies := collect(root), collect(clone)
+	for i := range originals {
+		v.nodes[originals[i]] = copies[i]
+	}
+
+	escape := root.Escape()
+	global := newScope(escape)
+	for _, name := range AutomaticArgs {
+		if value, ok := opts.BuildArgs[name]; ok {
+			global.args[name] = value
+		}
+	}
+	expand := func(original ast.Node, scope *Scope) error {
+		v.scopes[original] = scope.clone()
+		if err := expandNode(v.nodes[original], scope); err != nil {
+			return fmt.Errorf("%d:%d: %w", original.Pos().Line, original.Pos().Column, err)
+		}
+		return nil
+	}
+	for _, instruction := range root.Instructions {
+		if err := expand(instruction, global); err != nil {
+			return nil, err
+		}
+		declare(v.nodes[instruction], global, global, opts)
+	}
+
+	final := map[*ast.StageNode]*Scope{}
+	for _, stage := range root.Stages() {
+		if err := expand(stage, global); err != nil {
+			return nil, err
+		}
+		expanded := v.nodes[stage].(*ast.StageNode)
+		expanded.Reference = ast.ParseReference(expanded.Image)
+		scope := newScope(escape)
+		if parent := clone.Resolve(ast.Dependency{Name: expanded.Image, Node: expanded}); parent != nil && final[parent] != nil {
+			scope.env = maps.Clone(final[parent].env)
+		}
+		for _, instruction := range stage.Instructions {
+			if err := expand(instruction, scope); err != nil {
+				return nil, err
+			}
+			declare(v.nodes[instruction], scope, global, opts)
+		}
+		final[expanded] = scope
+	}
+	clone.RelinkReferences()
+	return v, nil
+}
+
+// Expanded copy of the node, nil if the node is not part of the tree the view was created from
+func (v *View) Node(original ast.Node) ast.Node {
+	return v.nodes[original]
+}
+
+// Variables visible to the node, nil if the node is not part of the tree the view was created from
+func (v *View) Scope(original ast.Node) *Scope {
+	return v.scopes[original]
+}
+
+// Expand the operands of the node using the scope
+func Node(node ast.Node, scope *Scope) (ast.Node, error) {
+	var clone ast.Node
+	if stage, ok := node.(*ast.StageNode); ok {
+		copied := *stage
+		clone = &copied
+	} else {
+		clone = ast.CloneInstruction(node.(ast.InstructionNode))
+	}
+	if err := expandNode(clone, scope); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// All nodes of the tree in a deterministic order
+func collect(root *ast.StageNode) []ast.Node {
+	nodes := []ast.Node{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Update the scope with the variables declared by the instruction
+func declare(node ast.Node, scope, global *Scope, opts Options) {
+	switch n := node.(type) {
+	case *ast.ArgInstructionNode:
+		for _, name := range n.Keys() {
+			if value, ok := opts.BuildArgs[name]; ok {
+				scope.args[name] = value
+			} else if n.Pairs[name] != "" {
+				scope.args[name] = Unquote(n.Pairs[name], scope.escape)
+			} else if value, ok := global.args[name]; ok {
+				// Redeclaring a global ARG without a value makes it visible in the stage
+				scope.args[name] = value
+			}
+		}
+	case *ast.EnvInstructionNode:
+		for _, name := range n.Keys() {
+			scope.env[name] = Unquote(n.Pairs[name], scope.escape)
+		}
+	}
+}
+
+func expandNode(node ast.Node, scope *Scope) error {
+	var err error
+	word := func(w *string) {
+		if err == nil {
+			*w, err = scope.Expand(*w)
+		}
+	}
+	words := func(ws []string) {
+		for i := range ws {
+			word(&ws[i])
+		}
+	}
+	pairs := func(order []string, m map[string]string, keys bool) (map[string]string, []string) {
+		res, resOrder := make(map[string]string, len(m)), make([]string, 0, len(order))
+		for _, key := range order {
+			value := m[key]
+			if keys {
+				word(&key)
+			}
+			word(&value)
+			res[key] = value
+			resOrder = append(resOrder, key)
+		}
+		return res, resOrder
+	}
+	switch n := node.(type) {
+	case *ast.StageNode:
+		word(&n.Image)
+		word(&n.Platform)
+	case *ast.AddInstructionNode:
+		words(n.Source)
+		word(&n.Destination)
+		word(&n.Chown)
+		word(&n.Chmod)
+		word(&n.CheckSum)
+		words(n.Exclude)
+	case *ast.CopyInstructionNode:
+		words(n.Source)
+		word(&n.Destination)
+		word(&n.Chown)
+		word(&n.Chmod)
+		word(&n.From)
+		words(n.Exclude)
+	case *ast.ArgInstructionNode:
+		n.Pairs, n.Order = pairs(n.Keys(), n.Pairs, false)
+	case *ast.EnvInstructionNode:
+		n.Pairs, n.Order = pairs(n.Keys(), n.Pairs, false)
+	case *ast.LabelInstructionNode:
+		n.Pairs, n.Order = pairs(n.Keys(), n.Pairs, true)
+	case *ast.ExposeInstructionNode:
+		for i := range n.Ports {
+			word(&n.Ports[i].Port)
+		}
+	case *ast.StopsignalInstructionNode:
+		word(&n.Signal)
+	case *ast.UserInstructionNode:
+		word(&n.User)
+	case *ast.VolumeInstructionNode:
+		words(n.Mounts)
+	case *ast.WorkdirInstructionNode:
+		word(&n.Path)
+	}
+	return err
+}
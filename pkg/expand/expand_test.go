@@ -0,0 +1,104 @@
+package expand_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/expand"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestScoping(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"ARG VERSION=3.20",
+		"ARG BASE=alpine:${VERSION}",
+		"FROM ${BASE} AS base",
+		"WORKDIR /opt/${VERSION:-none}",
+		"ARG VERSION",
+		"WORKDIR /opt/$VERSION",
+		"ENV VERSION=env",
+		"ARG VERSION=arg",
+		"WORKDIR /opt/$VERSION",
+		"FROM base AS child",
+		"USER ${VERSION}",
+		"ARG APP=default",
+		"COPY $APP /srv/$APP",
+	})
+	view, err := expand.New(root, expand.Options{BuildArgs: map[string]string{"APP": "web"}})
+	if err != nil {
+		t.Fatalf("Expansion failed: %s", err.Error())
+	}
+	stages := root.Stages()
+	base := view.Node(stages[0]).(*ast.StageNode)
+	if base.Image != "alpine:3.20" || base.Reference.Tag != "3.20" {
+		t.Errorf("Image mismatch: Expected alpine:3.20 Got %s (tag %s)", base.Image, base.Reference.Tag)
+	}
+	expectedPaths := []string{"/opt/none", "/opt/3.20", "/opt/env"}
+	paths := []string{}
+	for _, instruction := range stages[0].Instructions {
+		if workdir, ok := view.Node(instruction).(*ast.WorkdirInstructionNode); ok {
+			paths = append(paths, workdir.Path)
+		}
+	}
+	if !reflect.DeepEqual(expectedPaths, paths) {
+		t.Errorf("Workdir mismatch: Expected %v Got %v", expectedPaths, paths)
+	}
+	child := view.Node(stages[1]).(*ast.StageNode)
+	if !child.ImageIsStage {
+		t.Errorf("Expected expanded child stage to be based on a stage")
+	}
+	if user := view.Node(stages[1].Instructions[0]).(*ast.UserInstructionNode).User; user != "env" {
+		t.Errorf("Inherited env mismatch: Expected env Got %s", user)
+	}
+	copied := view.Node(stages[1].Instructions[2]).(*ast.CopyInstructionNode)
+	if !reflect.DeepEqual([]string{"web"}, copied.Source) || copied.Destination != "/srv/web" {
+		t.Errorf("Build arg override mismatch: Got %v %s", copied.Source, copied.Destination)
+	}
+}
+
+func TestOriginalUntouched(t *testing.T) {
+	input := []string{
+		"ARG TAG=1.0",
+		"FROM app:$TAG",
+		"ENV DIR=/srv",
+		"WORKDIR $DIR",
+	}
+	root := testdata.Parse(t, input)
+	view, err := expand.New(root, expand.Options{})
+	if err != nil {
+		t.Fatalf("Expansion failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(input, root.ReconstructLossless()) {
+		t.Errorf("Original mismatch: Expected %v Got %v", input, root.ReconstructLossless())
+	}
+	stage := root.Stages()[0]
+	if stage.Image != "app:$TAG" || stage.Instructions[1].(*ast.WorkdirInstructionNode).Path != "$DIR" {
+		t.Errorf("Original nodes were modified")
+	}
+	expected := []string{"ARG TAG=1.0", "FROM app:1.0", "ENV DIR=/srv", "WORKDIR /srv"}
+	if actual := view.Root.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expanded mismatch: Expected %v Got %v", expected, actual)
+	}
+	scope := view.Scope(stage.Instructions[1])
+	if value, ok := scope.Lookup("DIR"); !ok || value != "/srv" {
+		t.Errorf("Scope mismatch: Expected /srv Got %q", value)
+	}
+	if _, ok := scope.Lookup("TAG"); ok {
+		t.Errorf("Global ARG must not be visible in the stage")
+	}
+}
+
+func TestExpansionError(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"WORKDIR ${DIR:?must be set}",
+	})
+	if _, err := expand.New(root, expand.Options{}); err == nil {
+		t.Errorf("Expected error for unset required variable")
+	}
+	if _, err := expand.New(root, expand.Options{BuildArgs: map[string]string{"DIR": "/srv"}}); err == nil {
+		t.Errorf("Build args must not be visible without declaring them")
+	}
+}
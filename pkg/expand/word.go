@@ -0,0 +1,286 @@
+package expand
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Lookup the value of a variable, ok is false if the variable is not set
+type Lookup func(name string) (value string, ok bool)
+
+var ErrUnterminated = errors.New("unterminated variable expansion")
+
+// Expand the variables in the word using the default escape character
+// Supported: $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:+alt}, ${VAR+alt}, ${VAR:?msg}, ${VAR?msg},
+// ${VAR#pattern}, ${VAR##pattern}, ${VAR%pattern}, ${VAR%%pattern}, ${VAR/pattern/replacement} and ${VAR//pattern/replacement}
+// Single quoted and escaped text is not expanded, quotes and escape characters are kept as they are
+func Word(word string, lookup Lookup) (string, error) {
+	return expandWord(word, '\\', lookup)
+}
+
+func expandWord(word string, escape byte, lookup Lookup) (string, error) {
+	var sb strings.Builder
+	inDouble := false
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case c == escape:
+			sb.WriteByte(c)
+			if i+1 < len(word) {
+				i++
+				sb.WriteByte(word[i])
+			}
+		case c == '\'' && !inDouble:
+			end := strings.IndexByte(word[i+1:], '\'')
+			if end == -1 {
+				sb.WriteString(word[i:])
+				return sb.String(), nil
+			}
+			sb.WriteString(word[i : i+end+2])
+			i += end + 1
+		case c == '"':
+			inDouble = !inDouble
+			sb.WriteByte(c)
+		case c == '$' && i+1 < len(word) && word[i+1] == '{':
+			end := closingBrace(word, i+2, escape)
+			if end == -1 {
+				return "", fmt.Errorf("%w: %s", ErrUnterminated, word[i:])
+			}
+			value, err := expandBraces(word[i+2:end], escape, lookup)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i = end
+		case c == '$' && i+1 < len(word) && isNameStart(word[i+1]):
+			end := i + 1
+			for end < len(word) && isNameChar(word[end]) {
+				end++
+			}
+			value, _ := lookup(word[i+1 : end])
+			sb.WriteString(value)
+			i = end - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// Index of the brace closing the expansion starting at start, nested expansions are skipped
+func closingBrace(word string, start int, escape byte) int {
+	depth := 0
+	for i := start; i < len(word); i++ {
+		switch {
+		case word[i] == escape:
+			i++
+		case word[i] == '$' && i+1 < len(word) && word[i+1] == '{':
+			depth++
+			i++
+		case word[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Expand the content of ${...}
+func expandBraces(content string, escape byte, lookup Lookup) (string, error) {
+	end := 0
+	for end < len(content) && isNameChar(content[end]) {
+		end++
+	}
+	name, operation := content[:end], content[end:]
+	if name == "" {
+		return "", fmt.Errorf("invalid variable name in ${%s}", content)
+	}
+	value, set := lookup(name)
+	if operation == "" {
+		return value, nil
+	}
+	// The operand may contain expansions itself
+	operand := func(skip int) (string, error) {
+		return expandWord(operation[skip:], escape, lookup)
+	}
+	switch {
+	case strings.HasPrefix(operation, ":-"):
+		if !set || value == "" {
+			return operand(2)
+		}
+		return value, nil
+	case strings.HasPrefix(operation, "-"):
+		if !set {
+			return operand(1)
+		}
+		return value, nil
+	case strings.HasPrefix(operation, ":+"):
+		if set && value != "" {
+			return operand(2)
+		}
+		return "", nil
+	case strings.HasPrefix(operation, "+"):
+		if set {
+			return operand(1)
+		}
+		return "", nil
+	case strings.HasPrefix(operation, ":?"), strings.HasPrefix(operation, "?"):
+		empty := strings.HasPrefix(operation, ":") && value == ""
+		if set && !empty {
+			return value, nil
+		}
+		message, err := operand(strings.IndexByte(operation, '?') + 1)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			message = "is not set"
+		}
+		return "", fmt.Errorf("%s: %s", name, message)
+	case strings.HasPrefix(operation, "##"), strings.HasPrefix(operation, "#"):
+		longest := strings.HasPrefix(operation, "##")
+		skip := 1
+		if longest {
+			skip = 2
+		}
+		pattern, err := operand(skip)
+		if err != nil {
+			return "", err
+		}
+		return trimPrefix(value, pattern, longest), nil
+	case strings.HasPrefix(operation, "%%"), strings.HasPrefix(operation, "%"):
+		longest := strings.HasPrefix(operation, "%%")
+		skip := 1
+		if longest {
+			skip = 2
+		}
+		pattern, err := operand(skip)
+		if err != nil {
+			return "", err
+		}
+		return trimSuffix(value, pattern, longest), nil
+	case strings.HasPrefix(operation, "/"):
+		all := strings.HasPrefix(operation, "//")
+		rest := strings.TrimPrefix(operation[1:], "/")
+		rawPattern, rawReplacement, _ := strings.Cut(rest, "/")
+		pattern, err := expandWord(rawPattern, escape, lookup)
+		if err != nil {
+			return "", err
+		}
+		replacement, err := expandWord(rawReplacement, escape, lookup)
+		if err != nil {
+			return "", err
+		}
+		return replace(value, pattern, replacement, all), nil
+	}
+	return "", fmt.Errorf("unsupported expansion ${%s}", content)
+}
+
+// Convert a shell pattern into an anchored regular expression
+func compilePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^(?s:")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString(")$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return re
+}
+
+func trimPrefix(value, pattern string, longest bool) string {
+	re := compilePattern(pattern)
+	for i := 0; i <= len(value); i++ {
+		length := i
+		if longest {
+			length = len(value) - i
+		}
+		if re.MatchString(value[:length]) {
+			return value[length:]
+		}
+	}
+	return value
+}
+
+func trimSuffix(value, pattern string, longest bool) string {
+	re := compilePattern(pattern)
+	for i := 0; i <= len(value); i++ {
+		start := len(value) - i
+		if longest {
+			start = i
+		}
+		if re.MatchString(value[start:]) {
+			return value[:start]
+		}
+	}
+	return value
+}
+
+// Replace the longest match at the first matching position
+func replace(value, pattern, replacement string, all bool) string {
+	if pattern == "" {
+		return value
+	}
+	re := compilePattern(pattern)
+	var sb strings.Builder
+	for start := 0; start < len(value); {
+		matched := -1
+		for end := len(value); end > start; end-- {
+			if re.MatchString(value[start:end]) {
+				matched = end
+				break
+			}
+		}
+		if matched == -1 {
+			sb.WriteByte(value[start])
+			start++
+			continue
+		}
+		sb.WriteString(replacement)
+		if !all {
+			sb.WriteString(value[matched:])
+			return sb.String()
+		}
+		start = matched
+	}
+	return sb.String()
+}
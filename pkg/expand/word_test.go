@@ -0,0 +1,92 @@
+package expand_test
+
+import (
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/expand"
+)
+
+func lookupFrom(vars map[string]string) expand.Lookup {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestWord(t *testing.T) {
+	vars := lookupFrom(map[string]string{
+		"NAME":  "app",
+		"EMPTY": "",
+		"PATH":  "/usr/local/bin/tool.tar.gz",
+		"TEXT":  "a-b-a-b",
+	})
+	testCases := map[string]string{
+		"$NAME":                    "app",
+		"${NAME}":                  "app",
+		"/opt/$NAME/bin":           "/opt/app/bin",
+		"${NAME}_suffix":           "app_suffix",
+		"$NAME_suffix":             "",
+		"$MISSING":                 "",
+		"${MISSING:-default}":      "default",
+		"${EMPTY:-default}":        "default",
+		"${EMPTY-default}":         "",
+		"${MISSING-default}":       "default",
+		"${NAME:-default}":         "app",
+		"${MISSING:-${NAME}}":      "app",
+		"${NAME:+alt}":             "alt",
+		"${EMPTY:+alt}":            "",
+		"${EMPTY+alt}":             "alt",
+		"${MISSING:+alt}":          "",
+		"${PATH#*/}":               "usr/local/bin/tool.tar.gz",
+		"${PATH##*/}":              "tool.tar.gz",
+		"${PATH%.*}":               "/usr/local/bin/tool.tar",
+		"${PATH%%.*}":              "/usr/local/bin/tool",
+		"${TEXT/a/x}":              "x-b-a-b",
+		"${TEXT//a/x}":             "x-b-x-b",
+		"${TEXT/[ab]-/}":           "b-a-b",
+		"'$NAME'":                  "'$NAME'",
+		"\"$NAME\"":                "\"app\"",
+		"\\$NAME":                  "\\$NAME",
+		"$":                        "$",
+		"cost: 5$":                 "cost: 5$",
+		"${NAME}-${MISSING:-v1.0}": "app-v1.0",
+	}
+	for input, expected := range testCases {
+		actual, err := expand.Word(input, vars)
+		if err != nil {
+			t.Errorf("Expansion of %q failed: %s", input, err.Error())
+			continue
+		}
+		if actual != expected {
+			t.Errorf("Expansion mismatch for %q: Expected %q Got %q", input, expected, actual)
+		}
+	}
+}
+
+func TestWordErrors(t *testing.T) {
+	vars := lookupFrom(map[string]string{"EMPTY": ""})
+	for _, input := range []string{"${UNTERMINATED", "${MISSING:?required}", "${EMPTY:?}", "${}", "${EMPTY@Q}"} {
+		if _, err := expand.Word(input, vars); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+	if _, err := expand.Word("${EMPTY?}", vars); err != nil {
+		t.Errorf("Unexpected error for set variable: %s", err.Error())
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	testCases := map[string]string{
+		"plain":              "plain",
+		"\"hello world\"":    "hello world",
+		"'single $quoted'":   "single $quoted",
+		"a\\ b":              "a b",
+		"\"say \\\"hi\\\"\"": "say \"hi\"",
+		"\"keep\\n\"":        "keep\\n",
+	}
+	for input, expected := range testCases {
+		if actual := expand.Unquote(input, '\\'); actual != expected {
+			t.Errorf("Unquote mismatch for %q: Expected %q Got %q", input, expected, actual)
+		}
+	}
+}
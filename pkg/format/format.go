@@ -0,0 +1,217 @@
+// Format package
+package format
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+)
+
+// Rules applied when formatting
+type Options struct {
+	UppercaseKeywords bool   // Write instruction keywords in upper case
+	UppercaseAs       bool   // Write the AS keyword of FROM in upper case
+	LineWidth         int    // RUN instructions with lines longer than this are split at && (0 disables wrapping)
+	Indent            string // Indentation of continuation lines created by the formatter
+	AlignPairs        bool   // Put every pair of a multi pair ENV or LABEL on its own line aligned with the first pair
+	StageSeparation   int    // Number of blank lines in front of every stage (negative keeps the blank lines as they are)
+}
+
+// Options used by the fmt command
+func DefaultOptions() Options {
+	return Options{
+		UppercaseKeywords: true,
+		UppercaseAs:       true,
+		LineWidth:         80,
+		Indent:            "    ",
+		AlignPairs:        true,
+		StageSeparation:   1,
+	}
+}
+
+// Lex, parse and format the input
+func Source(input []string, opts Options) ([]string, error) {
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		return nil, err
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return Format(root, opts), nil
+}
+
+// Format the stage and all subsequent stages
+// Unmodified nodes are formatted based on their original source, modified nodes based on their reconstruction
+func Format(root *ast.StageNode, opts Options) []string {
+	f := formatter{root: root, opts: opts, escape: root.Escape()}
+	// Parser directives look like comments but must not be attached to the first stage
+	formatted := f.head(root)
+	directives := len(formatted)
+	for stage := root; stage != nil; stage = stage.Subsequent {
+		if stage != root {
+			formatted = f.separate(formatted, directives)
+			formatted = append(formatted, f.head(stage)...)
+		}
+		for _, instruction := range stage.Instructions {
+			formatted = append(formatted, f.instruction(instruction)...)
+		}
+	}
+	if opts.StageSeparation >= 0 {
+		formatted = trimTrailingEmpty(formatted)
+	}
+	return formatted
+}
+
+type formatter struct {
+	root   *ast.StageNode
+	opts   Options
+	escape byte
+}
+
+var asKeyword = regexp.MustCompile(`(?i)(\s)as(\s|$)`)
+
+func (f formatter) head(stage *ast.StageNode) []string {
+	lines := f.root.ReconstructNode(stage)
+	if stage.Image == "" {
+		// Only parser directives
+		return lines
+	}
+	lines, first := f.uppercaseKeyword(lines)
+	if f.opts.UppercaseAs {
+		for i := first; i < len(lines); i++ {
+			lines[i] = asKeyword.ReplaceAllString(lines[i], "${1}AS${2}")
+		}
+	}
+	return lines
+}
+
+func (f formatter) instruction(node ast.InstructionNode) []string {
+	lines := f.root.ReconstructNode(node)
+	switch n := node.(type) {
+	case *ast.CommentInstructionNode, *ast.EmptyLineNode, *ast.UnknownInstructionNode:
+		return lines
+	case *ast.RunInstructionNode:
+		lines, first := f.uppercaseKeyword(lines)
+		if len(n.Heredocs) != 0 {
+			return lines
+		}
+		return f.wrapRun(lines, first)
+	case *ast.EnvInstructionNode, *ast.LabelInstructionNode:
+		lines, first := f.uppercaseKeyword(lines)
+		return f.alignPairs(lines, first)
+	case *ast.OnbuildInstructionNode:
+		lines, first := f.uppercaseKeyword(lines)
+		if f.opts.UppercaseKeywords {
+			lines[first] = uppercaseWord(lines[first], len(strings.Fields(lines[first])[0]))
+		}
+		return lines
+	default:
+		lines, _ := f.uppercaseKeyword(lines)
+		return lines
+	}
+}
+
+// Returns the lines and the index of the line containing the keyword
+// Modified nodes emit the comments in between continuation lines in front of the instruction
+func (f formatter) uppercaseKeyword(lines []string) ([]string, int) {
+	lines = append([]string{}, lines...)
+	first := 0
+	for first < len(lines)-1 && strings.HasPrefix(lines[first], "#") {
+		first++
+	}
+	if f.opts.UppercaseKeywords {
+		lines[first] = uppercaseWord(strings.TrimLeft(lines[first], " \t"), 0)
+	}
+	return lines, first
+}
+
+// Split long RUN chains at && into continuation lines
+func (f formatter) wrapRun(lines []string, first int) []string {
+	if f.opts.LineWidth <= 0 || !exceeds(lines[first:], f.opts.LineWidth) {
+		return lines
+	}
+	words := splitWords(merge(lines[first:], f.escape), f.escape)
+	prefix := []string{}
+	for len(words) > 1 && (len(prefix) == 0 || strings.HasPrefix(words[0], "--")) {
+		prefix = append(prefix, words[0])
+		words = words[1:]
+	}
+	// Exec form cannot be split
+	if len(words) == 0 || strings.HasPrefix(words[0], "[") {
+		return lines
+	}
+	chain := splitChain(strings.Join(words, " "), f.escape)
+	if len(chain) < 2 {
+		return lines
+	}
+	wrapped := append(lines[:first:first], continuationComments(lines[first:])...)
+	for i, c := range chain {
+		line := f.opts.Indent + "&& " + c
+		if i == 0 {
+			line = strings.Join(append(prefix, c), " ")
+		}
+		if i != len(chain)-1 {
+			line += " " + string(f.escape)
+		}
+		wrapped = append(wrapped, line)
+	}
+	return wrapped
+}
+
+// Put every key value pair on its own line
+// The legacy syntax (ENV KEY value) only supports a single pair and is kept as is
+func (f formatter) alignPairs(lines []string, first int) []string {
+	if !f.opts.AlignPairs {
+		return lines
+	}
+	words := splitWords(merge(lines[first:], f.escape), f.escape)
+	if len(words) < 3 {
+		return lines
+	}
+	for _, w := range words[1:] {
+		if !strings.Contains(w, "=") {
+			return lines
+		}
+	}
+	aligned := append(lines[:first:first], continuationComments(lines[first:])...)
+	indent := strings.Repeat(" ", len(words[0])+1)
+	for i, pair := range words[1:] {
+		line := indent + pair
+		if i == 0 {
+			line = words[0] + " " + pair
+		}
+		if i != len(words)-2 {
+			line += " " + string(f.escape)
+		}
+		aligned = append(aligned, line)
+	}
+	return aligned
+}
+
+// Replace the blank lines in front of a stage with the configured amount
+// Comments directly in front of the FROM instruction stay attached to it
+func (f formatter) separate(formatted []string, directives int) []string {
+	if f.opts.StageSeparation < 0 {
+		return formatted
+	}
+	end := len(formatted)
+	for end > directives && strings.HasPrefix(strings.TrimSpace(formatted[end-1]), "#") {
+		end--
+	}
+	attached := append([]string{}, formatted[end:]...)
+	formatted = trimTrailingEmpty(formatted[:end])
+	if len(formatted) == 0 {
+		return attached
+	}
+	for range f.opts.StageSeparation {
+		formatted = append(formatted, "")
+	}
+	return append(formatted, attached...)
+}
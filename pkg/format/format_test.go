@@ -0,0 +1,139 @@
+package format_test
+
+import (
+	"reflect"
+	"testing"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/format"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
+)
+
+type TestCase struct {
+	Input    []string
+	Expected []string
+}
+
+func TestFormat(t *testing.T) {
+	testCases := []TestCase{
+		// Keywords and AS casing
+		{
+			Input:    []string{"from alpine as Build", "  run echo hi", "onbuild copy . /app", "Workdir /app"},
+			Expected: []string{"FROM alpine AS Build", "RUN echo hi", "ONBUILD COPY . /app", "WORKDIR /app"},
+		},
+		// Long RUN chains
+		{
+			Input: []string{
+				"FROM alpine",
+				"RUN --network=none apt-get update && apt-get install -y curl git && echo \"a && b\" && rm -rf /var/lib/apt/lists/*",
+			},
+			Expected: []string{
+				"FROM alpine",
+				"RUN --network=none apt-get update \\",
+				"    && apt-get install -y curl git \\",
+				"    && echo \"a && b\" \\",
+				"    && rm -rf /var/lib/apt/lists/*",
+			},
+		},
+		// Short or exec form RUN instructions are kept
+		{
+			Input:    []string{"FROM alpine", "RUN a && b", "RUN [\"sh\", \"-c\", \"apt-get update && apt-get install -y curl git && rm -rf /var/lib/apt/lists\"]"},
+			Expected: []string{"FROM alpine", "RUN a && b", "RUN [\"sh\", \"-c\", \"apt-get update && apt-get install -y curl git && rm -rf /var/lib/apt/lists\"]"},
+		},
+		// Continuation comments are moved in front of rewrapped instructions
+		{
+			Input: []string{
+				"FROM alpine",
+				"RUN apt-get update && apt-get install -y --no-install-recommends curl git ca-certificates \\",
+				"# tools",
+				"    && rm -rf /var/lib/apt/lists/*",
+			},
+			Expected: []string{
+				"FROM alpine",
+				"# tools",
+				"RUN apt-get update \\",
+				"    && apt-get install -y --no-install-recommends curl git ca-certificates \\",
+				"    && rm -rf /var/lib/apt/lists/*",
+			},
+		},
+		// ENV and LABEL pairs
+		{
+			Input: []string{"FROM alpine", "env A=1 LONG_NAME=\"a b\"", "LABEL a=b \\", "  c=d", "ENV KEY some value", "ENV SINGLE=1"},
+			Expected: []string{
+				"FROM alpine",
+				"ENV A=1 \\",
+				"    LONG_NAME=\"a b\"",
+				"LABEL a=b \\",
+				"      c=d",
+				"ENV KEY some value",
+				"ENV SINGLE=1",
+			},
+		},
+		// Blank lines between stages
+		{
+			Input:    []string{"# syntax=docker/dockerfile:1", "ARG A", "FROM alpine AS a", "RUN a", "", "", "", "# final stage", "FROM a", "", "RUN b", "", ""},
+			Expected: []string{"# syntax=docker/dockerfile:1", "ARG A", "", "FROM alpine AS a", "RUN a", "", "# final stage", "FROM a", "", "RUN b"},
+		},
+		// Escape directive
+		{
+			Input:    []string{"# escape=`", "FROM alpine", "ENV A=1 B=2"},
+			Expected: []string{"# escape=`", "", "FROM alpine", "ENV A=1 `", "    B=2"},
+		},
+	}
+	for _, c := range testCases {
+		actual, err := format.Source(c.Input, format.DefaultOptions())
+		if err != nil {
+			t.Fatalf("Formatting failed: %s", err.Error())
+		}
+		if !reflect.DeepEqual(c.Expected, actual) {
+			t.Errorf("Format mismatch: Expected %q Got %q", c.Expected, actual)
+		}
+		// Formatting has to be idempotent
+		again, err := format.Source(actual, format.DefaultOptions())
+		if err != nil {
+			t.Fatalf("Formatting failed: %s", err.Error())
+		}
+		if !reflect.DeepEqual(actual, again) {
+			t.Errorf("Format not idempotent: Expected %q Got %q", actual, again)
+		}
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	input := []string{"from alpine as a", "env A=1 B=2", "run a && b", "from a", "run c"}
+	opts := format.Options{LineWidth: 5, Indent: "  ", StageSeparation: -1}
+	expected := []string{"from alpine as a", "env A=1 B=2", "run a \\", "  && b", "from a", "run c"}
+	actual, err := format.Source(input, opts)
+	if err != nil {
+		t.Fatalf("Formatting failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Format mismatch: Expected %q Got %q", expected, actual)
+	}
+}
+
+func TestFormatModified(t *testing.T) {
+	l := lexer.NewFromInput([]string{"from alpine", "env B=2 A=1"})
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	root.Subsequent.Instructions[0].(*ast.EnvInstructionNode).Pairs["C"] = "3"
+	expected := []string{"FROM alpine", "ENV B=2 \\", "    A=1 \\", "    C=3"}
+	if actual := format.Format(root, format.DefaultOptions()); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Format mismatch: Expected %q Got %q", expected, actual)
+	}
+}
+
+func BenchmarkFormat(b *testing.B) {
+	for range b.N {
+		format.Source(testdata.SampleDockerfile, format.DefaultOptions())
+	}
+}
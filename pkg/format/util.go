@@ -0,0 +1,121 @@
+package format
+
+import (
+	"strings"
+)
+
+// Upper case the first word starting at or after the offset
+func uppercaseWord(line string, offset int) string {
+	start := offset
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+	end := start
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return line[:start] + strings.ToUpper(line[start:end]) + line[end:]
+}
+
+func exceeds(lines []string, width int) bool {
+	for _, line := range lines {
+		if len(line) > width {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge the physical lines of an instruction the same way the lexer does
+func merge(lines []string, escape byte) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		in := strings.TrimSpace(line)
+		if i != 0 && strings.HasPrefix(in, "#") {
+			continue
+		}
+		if len(in) > 0 && in[len(in)-1] == escape {
+			in = in[:len(in)-1]
+		}
+		sb.WriteString(in)
+	}
+	return sb.String()
+}
+
+// Comments in between the continuation lines of an instruction
+func continuationComments(lines []string) []string {
+	comments := []string{}
+	for _, line := range lines[1:] {
+		if in := strings.TrimSpace(line); strings.HasPrefix(in, "#") {
+			comments = append(comments, in)
+		}
+	}
+	return comments
+}
+
+// Split at the separator if it is not quoted or escaped
+// Parts are trimmed and empty parts are dropped
+func splitUnquoted(input string, escape byte, isSeparator func(rest string) int) []string {
+	parts := []string{}
+	var quote byte
+	start := 0
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == escape:
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			if n := isSeparator(input[i:]); n > 0 {
+				parts = append(parts, input[start:i])
+				start = i + n
+				i += n - 1
+			}
+		}
+	}
+	parts = append(parts, input[start:])
+	res := []string{}
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); len(p) != 0 {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// Split into words separated by unquoted whitespace
+func splitWords(input string, escape byte) []string {
+	return splitUnquoted(input, escape, func(rest string) int {
+		if rest[0] == ' ' || rest[0] == '\t' {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Split a shell command at unquoted &&
+func splitChain(input string, escape byte) []string {
+	return splitUnquoted(input, escape, func(rest string) int {
+		if strings.HasPrefix(rest, "&&") {
+			return 2
+		}
+		return 0
+	})
+}
+
+func trimTrailingEmpty(lines []string) []string {
+	end := len(lines)
+	for end > 0 && len(strings.TrimSpace(lines[end-1])) == 0 {
+		end--
+	}
+	return lines[:end]
+}
@@ -0,0 +1,234 @@
+// Package containing the dependency graph of the stages of a Dockerfile
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+)
+
+// Reason for a dependency between two stages
+type Cause int
+
+const (
+	FromStage Cause = iota // FROM <stage>
+	CopyFrom               // COPY --from=<stage>
+	MountFrom              // RUN --mount=from=<stage>
+)
+
+func (c Cause) String() string {
+	switch c {
+	case FromStage:
+		return "FROM"
+	case CopyFrom:
+		return "COPY --from"
+	case MountFrom:
+		return "RUN --mount=from"
+	}
+	return "unknown"
+}
+
+// Dependent requires Dependency to be built first
+type Edge struct {
+	Dependent  *ast.StageNode
+	Dependency *ast.StageNode
+	Cause      Cause
+	Node       ast.Node // Node causing the dependency, the dependent stage itself for FROM
+}
+
+// Directed graph of the stages, edges point from a stage to the stages it depends on
+type Graph struct {
+	Stages []*ast.StageNode // Stages in the order of the Dockerfile
+	Edges  []Edge
+}
+
+// Build the graph of all stages following the root stage
+// Dependencies on images are not part of the graph
+func Build(root *ast.StageNode) *Graph {
+	g := &Graph{Stages: root.Stages(), Edges: []Edge{}}
+	for _, stage := range g.Stages {
+		for _, d := range stage.Dependencies() {
+			dependency := root.Resolve(d)
+			if dependency == nil {
+				continue
+			}
+			g.Edges = append(g.Edges, Edge{Dependent: stage, Dependency: dependency, Cause: causeOf(d.Node), Node: d.Node})
+		}
+	}
+	return g
+}
+
+func causeOf(node ast.Node) Cause {
+	switch node.(type) {
+	case *ast.CopyInstructionNode:
+		return CopyFrom
+	case *ast.RunInstructionNode:
+		return MountFrom
+	}
+	return FromStage
+}
+
+// Edges to the stages the stage depends on
+func (g *Graph) DependenciesOf(stage *ast.StageNode) []Edge {
+	res := []Edge{}
+	for _, e := range g.Edges {
+		if e.Dependent == stage {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Edges from the stages depending on the stage
+func (g *Graph) DependentsOf(stage *ast.StageNode) []Edge {
+	res := []Edge{}
+	for _, e := range g.Edges {
+		if e.Dependency == stage {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Stages that cannot be built because they depend on each other
+// Every cycle is returned once, stages of a cycle are in the order of the Dockerfile
+func (g *Graph) Cycles() [][]*ast.StageNode {
+	cycles := [][]*ast.StageNode{}
+	for _, component := range g.components() {
+		if len(component) == 1 && !g.dependsOn(component[0], component[0]) {
+			continue
+		}
+		slices.SortFunc(component, func(a, b *ast.StageNode) int { return g.indexOf(a) - g.indexOf(b) })
+		cycles = append(cycles, component)
+	}
+	slices.SortFunc(cycles, func(a, b []*ast.StageNode) int { return g.indexOf(a[0]) - g.indexOf(b[0]) })
+	return cycles
+}
+
+// Error returned if the graph contains cycles
+type CycleError struct {
+	Cycles [][]*ast.StageNode
+}
+
+func (e *CycleError) Error() string {
+	descriptions := make([]string, len(e.Cycles))
+	for i, cycle := range e.Cycles {
+		names := make([]string, len(cycle))
+		for j, stage := range cycle {
+			names[j] = stageName(stage)
+		}
+		descriptions[i] = strings.Join(names, " -> ")
+	}
+	return fmt.Sprintf("stages depend on each other: %s", strings.Join(descriptions, ", "))
+}
+
+func stageName(stage *ast.StageNode) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return stage.Image
+}
+
+// Order in which the stages have to be built so every stage is built after its dependencies
+// Independent stages keep the order of the Dockerfile
+// Returns a *CycleError if the stages depend on each other
+func (g *Graph) TopologicalOrder() ([]*ast.StageNode, error) {
+	if cycles := g.Cycles(); len(cycles) != 0 {
+		return nil, &CycleError{Cycles: cycles}
+	}
+	pending := make(map[*ast.StageNode]int, len(g.Stages))
+	for _, e := range g.uniqueEdges() {
+		pending[e.Dependent]++
+	}
+	order := make([]*ast.StageNode, 0, len(g.Stages))
+	done := make(map[*ast.StageNode]bool, len(g.Stages))
+	for len(order) != len(g.Stages) {
+		// The first stage without pending dependencies keeps the order stable
+		for _, stage := range g.Stages {
+			if done[stage] || pending[stage] != 0 {
+				continue
+			}
+			done[stage] = true
+			order = append(order, stage)
+			for _, e := range g.uniqueEdges() {
+				if e.Dependency == stage {
+					pending[e.Dependent]--
+				}
+			}
+			break
+		}
+	}
+	return order, nil
+}
+
+// Edges without duplicates between the same stages
+func (g *Graph) uniqueEdges() []Edge {
+	type pair struct{ dependent, dependency *ast.StageNode }
+	seen := make(map[pair]bool)
+	res := []Edge{}
+	for _, e := range g.Edges {
+		p := pair{e.Dependent, e.Dependency}
+		if !seen[p] {
+			seen[p] = true
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (g *Graph) dependsOn(dependent, dependency *ast.StageNode) bool {
+	return slices.ContainsFunc(g.Edges, func(e Edge) bool { return e.Dependent == dependent && e.Dependency == dependency })
+}
+
+func (g *Graph) indexOf(stage *ast.StageNode) int {
+	return slices.Index(g.Stages, stage)
+}
+
+// Strongly connected components using tarjan's algorithm
+func (g *Graph) components() [][]*ast.StageNode {
+	index := 0
+	indices := make(map[*ast.StageNode]int)
+	lowlink := make(map[*ast.StageNode]int)
+	onStack := make(map[*ast.StageNode]bool)
+	stack := []*ast.StageNode{}
+	components := [][]*ast.StageNode{}
+
+	var connect func(stage *ast.StageNode)
+	connect = func(stage *ast.StageNode) {
+		indices[stage] = index
+		lowlink[stage] = index
+		index++
+		stack = append(stack, stage)
+		onStack[stage] = true
+		for _, e := range g.DependenciesOf(stage) {
+			if _, visited := indices[e.Dependency]; !visited {
+				connect(e.Dependency)
+				lowlink[stage] = min(lowlink[stage], lowlink[e.Dependency])
+			} else if onStack[e.Dependency] {
+				lowlink[stage] = min(lowlink[stage], indices[e.Dependency])
+			}
+		}
+		if lowlink[stage] != indices[stage] {
+			return
+		}
+		component := []*ast.StageNode{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == stage {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, stage := range g.Stages {
+		if _, visited := indices[stage]; !visited {
+			connect(stage)
+		}
+	}
+	return components
+}
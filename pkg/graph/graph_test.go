@@ -0,0 +1,98 @@
+package graph_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/graph"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func names(stages []*ast.StageNode) []string {
+	res := make([]string, len(stages))
+	for i, s := range stages {
+		res[i] = s.Name
+	}
+	return res
+}
+
+func TestBuild(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS base",
+		"FROM golang AS tools",
+		"FROM base AS build",
+		"RUN --mount=type=bind,from=tools,target=/tools make",
+		"COPY --from=1 /a /a",
+		"FROM scratch AS final",
+		"COPY --from=build /out /out",
+		"COPY --from=nginx /etc/nginx /etc/nginx",
+	})
+	g := graph.Build(root)
+	stages := root.Stages()
+	expected := []graph.Edge{
+		{Dependent: stages[2], Dependency: stages[0], Cause: graph.FromStage, Node: stages[2]},
+		{Dependent: stages[2], Dependency: stages[1], Cause: graph.MountFrom, Node: stages[2].Instructions[0]},
+		{Dependent: stages[2], Dependency: stages[1], Cause: graph.CopyFrom, Node: stages[2].Instructions[1]},
+		{Dependent: stages[3], Dependency: stages[2], Cause: graph.CopyFrom, Node: stages[3].Instructions[0]},
+	}
+	if !reflect.DeepEqual(expected, g.Edges) {
+		t.Errorf("Edge mismatch: Expected %v Got %v", expected, g.Edges)
+	}
+	if len(g.DependenciesOf(stages[2])) != 3 || len(g.DependentsOf(stages[2])) != 1 {
+		t.Errorf("Edge count mismatch for build stage")
+	}
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		t.Fatalf("Ordering failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual([]string{"base", "tools", "build", "final"}, names(order)) {
+		t.Errorf("Order mismatch: Got %v", names(order))
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	// COPY and RUN may refer to later stages
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS a",
+		"COPY --from=c /x /x",
+		"FROM alpine AS b",
+		"FROM alpine AS c",
+		"COPY --from=b /y /y",
+	})
+	order, err := graph.Build(root).TopologicalOrder()
+	if err != nil {
+		t.Fatalf("Ordering failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual([]string{"b", "c", "a"}, names(order)) {
+		t.Errorf("Order mismatch: Got %v", names(order))
+	}
+}
+
+func TestCycles(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS a",
+		"COPY --from=b /x /x",
+		"FROM alpine AS b",
+		"COPY --from=a /y /y",
+		"FROM alpine AS c",
+		"COPY --from=c /z /z",
+		"FROM a AS d",
+	})
+	g := graph.Build(root)
+	cycles := g.Cycles()
+	if len(cycles) != 2 || !reflect.DeepEqual([]string{"a", "b"}, names(cycles[0])) || !reflect.DeepEqual([]string{"c"}, names(cycles[1])) {
+		t.Errorf("Cycle mismatch: Got %v", cycles)
+	}
+	_, err := g.TopologicalOrder()
+	var cycleErr *graph.CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("Expected cycle error Got %v", err)
+	}
+	expected := "stages depend on each other: a -> b, c"
+	if err.Error() != expected {
+		t.Errorf("Error mismatch: Expected %s Got %s", expected, err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+)
+
+// Stage with the name (case insensitive) like docker build --target
+// An empty target selects the last stage, which is what docker builds by default
+func (g *Graph) Target(target string) (*ast.StageNode, error) {
+	if target == "" && len(g.Stages) != 0 {
+		return g.Stages[len(g.Stages)-1], nil
+	}
+	for _, stage := range g.Stages {
+		if stage.Name != "" && strings.EqualFold(stage.Name, target) {
+			return stage, nil
+		}
+	}
+	return nil, fmt.Errorf("target stage %q not found", target)
+}
+
+// Stages required to build the target including the target itself in the order of the Dockerfile
+func (g *Graph) Required(target string) ([]*ast.StageNode, error) {
+	stage, err := g.Target(target)
+	if err != nil {
+		return nil, err
+	}
+	required := map[*ast.StageNode]bool{stage: true}
+	queue := []*ast.StageNode{stage}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, e := range g.DependenciesOf(current) {
+			if !required[e.Dependency] {
+				required[e.Dependency] = true
+				queue = append(queue, e.Dependency)
+			}
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(g.Stages), func(s *ast.StageNode) bool { return !required[s] }), nil
+}
+
+// Copy of the tree only containing the stages required to build the target
+// The root stage (parser directives and global ARGs) is always kept
+// Numeric stage references are updated to the reduced tree, the original tree is not modified
+func Prune(root *ast.StageNode, target string) (*ast.StageNode, error) {
+	pruned := root.Clone()
+	g := Build(pruned)
+	required, err := g.Required(target)
+	if err != nil {
+		return nil, err
+	}
+	unused := []int{}
+	for i, stage := range g.Stages {
+		if !slices.Contains(required, stage) {
+			unused = append(unused, i)
+		}
+	}
+	if err := pruned.RemoveStages(unused...); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
@@ -0,0 +1,108 @@
+package graph_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/graph"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestRequired(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine AS base",
+		"FROM base AS test",
+		"FROM golang AS tools",
+		"FROM base AS build",
+		"RUN --mount=from=tools,target=/tools make",
+		"FROM scratch AS final",
+		"COPY --from=build /out /out",
+	})
+	g := graph.Build(root)
+	testCases := map[string][]string{
+		"final": {"base", "tools", "build", "final"},
+		"":      {"base", "tools", "build", "final"},
+		"TEST":  {"base", "test"},
+		"tools": {"tools"},
+	}
+	for target, expected := range testCases {
+		required, err := g.Required(target)
+		if err != nil {
+			t.Fatalf("Target %s failed: %s", target, err.Error())
+		}
+		if !reflect.DeepEqual(expected, names(required)) {
+			t.Errorf("Required stages mismatch for %q: Expected %v Got %v", target, expected, names(required))
+		}
+	}
+	if _, err := g.Required("missing"); err == nil {
+		t.Errorf("Expected error for unknown target")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	input := []string{
+		"# syntax=docker/dockerfile:1",
+		"ARG VERSION=1",
+		"FROM alpine AS base",
+		"FROM base AS test",
+		"RUN make test",
+		"FROM golang AS tools",
+		"FROM scratch AS final",
+		"COPY --from=2 /tools /tools",
+		"COPY --from=base /etc /etc",
+	}
+	root := testdata.Parse(t, input)
+	pruned, err := graph.Prune(root, "final")
+	if err != nil {
+		t.Fatalf("Pruning failed: %s", err.Error())
+	}
+	expected := []string{
+		"# syntax=docker/dockerfile:1",
+		"ARG VERSION=1",
+		"FROM alpine AS base",
+		"FROM golang AS tools",
+		"FROM scratch AS final",
+		"COPY --from=1 /tools /tools",
+		"COPY --from=base /etc /etc",
+	}
+	if actual := pruned.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Pruned reconstruction mismatch: Expected %v Got %v", expected, actual)
+	}
+	if actual := root.ReconstructLossless(); !reflect.DeepEqual(input, actual) {
+		t.Errorf("Original was modified: Expected %v Got %v", input, actual)
+	}
+}
+
+func TestPruneMountReference(t *testing.T) {
+	input := []string{
+		"FROM alpine AS a",
+		"FROM alpine AS b",
+		"FROM alpine AS c",
+		"RUN --mount=from=1,target=/b ls /b",
+		"COPY --from=1 /b /b",
+	}
+	root := testdata.Parse(t, input)
+	pruned, err := graph.Prune(root, "c")
+	if err != nil {
+		t.Fatalf("Pruning failed: %s", err.Error())
+	}
+	expected := []string{
+		"FROM alpine AS b",
+		"FROM alpine AS c",
+		"RUN --mount=from=0,target=/b ls /b",
+		"COPY --from=0 /b /b",
+	}
+	if actual := pruned.ReconstructLossless(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Pruned reconstruction mismatch: Expected %q Got %q", expected, actual)
+	}
+	g := graph.Build(pruned)
+	for _, e := range g.Edges {
+		if e.Dependent == e.Dependency {
+			t.Errorf("Unexpected self reference of stage %s caused by %s", e.Dependent.Name, e.Node.Reconstruct()[0])
+		}
+	}
+	if len(g.Edges) != 2 {
+		t.Errorf("Edge count mismatch: Expected %d Got %d", 2, len(g.Edges))
+	}
+}
@@ -0,0 +1,131 @@
+package lexer
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
+)
+
+// Instructions that support heredocs
+var heredocInstructions = []string{"RUN", "COPY", "ADD"}
+
+// Consume the heredoc bodies started by the passed line
+// Returns the index of the last consumed input line
+func collectHeredocs(input []string, index int, line string, escape byte, info *lineInfo) int {
+	for _, heredoc := range findHeredocs(line, escape) {
+		body := []string{}
+		terminated := false
+		for index+1 < len(input) {
+			index++
+			raw := input[index]
+			info.end = token.Position{Line: index + 1, Column: len(raw) + 1}
+			candidate := raw
+			if heredoc.StripTabs {
+				candidate = strings.TrimLeft(raw, "\t")
+			}
+			if candidate == heredoc.Name {
+				terminated = true
+				break
+			}
+			body = append(body, raw)
+		}
+		if len(body) != 0 {
+			heredoc.Body = strings.Join(body, "\n") + "\n"
+		}
+		info.heredocs = append(info.heredocs, heredoc)
+		info.unterminated = info.unterminated || !terminated
+	}
+	return index
+}
+
+// Find all heredoc markers (<<EOF, <<-EOF, <<"EOF") in an instruction line
+// Returns the heredocs without body in the order they appear in
+func findHeredocs(line string, escape byte) []token.Heredoc {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return nil
+	}
+	instruction := strings.ToUpper(words[0])
+	words = words[1:]
+	if instruction == "ONBUILD" && len(words) != 0 {
+		instruction = strings.ToUpper(words[0])
+		words = words[1:]
+	}
+	if !slices.Contains(heredocInstructions, instruction) {
+		return nil
+	}
+	// Heredocs are not supported in exec form
+	for _, word := range words {
+		if strings.HasPrefix(word, "--") {
+			continue
+		}
+		if strings.HasPrefix(word, "[") {
+			return nil
+		}
+		break
+	}
+
+	heredocs := []token.Heredoc{}
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == escape && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(line[i:], "<<<"):
+			// Here-strings are not heredocs
+			i += 2
+		case strings.HasPrefix(line[i:], "<<"):
+			heredoc, length := parseHeredocMarker(line[i+2:])
+			if length != 0 {
+				heredocs = append(heredocs, heredoc)
+				i += 1 + length
+			} else {
+				i++
+			}
+		}
+	}
+	return heredocs
+}
+
+// Parse the part of a heredoc marker following the <<
+// Returns the heredoc and the number of consumed bytes (0 if this is not a valid marker)
+func parseHeredocMarker(input string) (token.Heredoc, int) {
+	heredoc := token.Heredoc{Expand: true}
+	i := 0
+	if strings.HasPrefix(input, "-") {
+		heredoc.StripTabs = true
+		i++
+	}
+	for i < len(input) && (input[i] == ' ' || input[i] == '\t') {
+		i++
+	}
+	var name strings.Builder
+	for i < len(input) && !strings.ContainsRune(" \t;|&<>()", rune(input[i])) {
+		if input[i] == '\'' || input[i] == '"' {
+			end := strings.IndexByte(input[i+1:], input[i])
+			if end == -1 {
+				return heredoc, 0
+			}
+			// Quoting any part of the delimiter disables expansion
+			name.WriteString(input[i+1 : i+1+end])
+			heredoc.Expand = false
+			i += end + 2
+			continue
+		}
+		name.WriteByte(input[i])
+		i++
+	}
+	if name.Len() == 0 {
+		return heredoc, 0
+	}
+	heredoc.Name = name.String()
+	return heredoc, i
+}
@@ -3,17 +3,25 @@ package lexer
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
 )
 
 // Lexer
 type Lexer struct {
+	input        []string // physical lines as provided
 	lines        []string
+	info         []lineInfo // maps merged lines back to the physical lines of the input
 	currentLine  int
 	currentIndex int
+	diagnostics  diagnostic.List
+	recover      bool
+	escape       byte // escape character as declared by the escape parser directive
+	directives   int  // number of leading lines that are parser directives
 }
 
 // Create new lexer based on the a file
@@ -23,17 +31,39 @@ func NewFromFile(path string) (Lexer, error) {
 	if err != nil {
 		return Lexer{}, err
 	}
-	return Lexer{mergeLines(lines), 0, 0}, nil
+	return newLexer(lines), nil
+}
+
+// Create new lexer based on the content of the reader
+// Errors if the reader fails
+func NewFromReader(r io.Reader) (Lexer, error) {
+	lines, err := util.ReadLines(r)
+	if err != nil {
+		return Lexer{}, err
+	}
+	return newLexer(lines), nil
 }
 
 // Create new lexer based on the input provided
 func NewFromInput(input []string) Lexer {
-	return Lexer{mergeLines(input), 0, 0}
+	return newLexer(input)
+}
+
+func newLexer(input []string) Lexer {
+	escape, directives := detectDirectives(input)
+	merged, info := mergeLines(input, escape)
+	return Lexer{input: input, lines: merged, info: info, escape: escape, directives: directives}
+}
+
+// Keep lexing after encountering an illegal instruction
+// The illegal instruction is returned as ILLEGAL token containing the raw text of the instruction
+func (l *Lexer) SetRecover(recover bool) {
+	l.recover = recover
 }
 
 // Lex lines provided when initializing lexer
 // Technically this is both a lexer and a tokenizer in one
-// Returns tokens
+// Returns tokens, the error contains the diagnostics with error severity
 func (l *Lexer) Lex() ([]token.Token, error) {
 	tokens := []token.Token{}
 	for l.currentLine < len(l.lines) {
@@ -42,15 +72,30 @@ func (l *Lexer) Lex() ([]token.Token, error) {
 		case token.EOF:
 			break
 		case token.ILLEGAL:
-			return tokens, fmt.Errorf("Illegal instruction encountered (line: %d) see above for details", l.currentLine)
+			if !l.recover {
+				return tokens, l.diagnostics.Err()
+			}
+			tokens = append(tokens, token.Token{
+				Kind:    token.ILLEGAL,
+				Content: l.lines[l.currentLine],
+				Start:   l.positionOf(l.currentLine, 0),
+				End:     l.endOf(l.currentLine),
+				Raw:     l.rawOf(l.currentLine),
+			})
 		default:
 			t := l.buildToken(instruction)
+			t.Start = l.positionOf(l.currentLine, 0)
+			t.End = l.endOf(l.currentLine)
+			t.Raw = l.rawOf(l.currentLine)
+			if l.info[l.currentLine].unterminated {
+				l.diagnostics = append(l.diagnostics, diagnostic.FromToken(t, diagnostic.Error, diagnostic.UnterminatedHeredoc, "Heredoc is not terminated before the end of the file"))
+			}
 			tokens = append(tokens, t)
 		}
 		l.currentLine += 1
 		l.currentIndex = 0
 	}
-	return tokens, nil
+	return tokens, l.diagnostics.Err()
 }
 
 // Advance index to end of instruction and return token kind
@@ -72,15 +117,31 @@ func (l *Lexer) getCurrentInstruction() int {
 	if ok {
 		return instruction
 	}
-	fmt.Printf("Illegal statement: %s", currentLine)
+	l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.IllegalInstruction,
+		Message:  fmt.Sprintf("Illegal instruction %s", cmd),
+		Start:    l.positionOf(l.currentLine, 0),
+		End:      l.endOf(l.currentLine),
+	})
 	return token.ILLEGAL
 }
 
-// Advance index to end of content and start of comment
+// Diagnostics collected while lexing
+func (l Lexer) Diagnostics() diagnostic.List {
+	return l.diagnostics
+}
+
+// Advance index to the comment symbol
 // If no comment exist -> advance to end of content
 func (l *Lexer) advanceToStartOfComment() {
 	stack := util.Stack[rune]{}
 	for l.currentIndex < len(l.lines[l.currentLine]) {
+		// Escaped characters can neither start a quote nor a comment
+		if l.expectCurrentCharacter(rune(l.escape)) {
+			l.currentIndex = min(l.currentIndex+2, len(l.lines[l.currentLine]))
+			continue
+		}
 		if l.expectCurrentCharacter('"') || l.expectCurrentCharacter('\'') || l.expectCurrentCharacter('`') || (l.expectCurrentCharacter('$') && l.expectNextCharacter('{')) {
 			// Handle case of ${a#b} -> This does not count as a comment
 			if l.expectCurrentCharacter('$') {
@@ -91,10 +152,10 @@ func (l *Lexer) advanceToStartOfComment() {
 			} else {
 				stack.Push(l.getCurrentCharacter())
 			}
+		} else if l.expectCurrentCharacter('}') && stack.TopEquals('{') {
+			stack.Pop()
 		}
 		if l.expectCurrentCharacter('#') && stack.Size() == 0 {
-			// Remove comment symbol
-			l.currentIndex = min(l.currentIndex+1, len(l.lines[l.currentLine]))
 			return
 		}
 		l.currentIndex++
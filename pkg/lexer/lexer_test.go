@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
 )
@@ -30,19 +31,15 @@ func compareTokens(expected, actual token.Token) string {
 		return fmt.Sprintf("Token param count mismatch: Expected %d Got %d", len(expected.Params), len(actual.Params))
 	}
 
-	if expected.Content != expected.Content {
+	if expected.Content != actual.Content {
 		return fmt.Sprintf("Token content mismatch: Expected %s Got %s", expected.Content, actual.Content)
 	}
 	if expected.InlineComment != actual.InlineComment {
 		return fmt.Sprintf("Token comment mismatch: Expected %s Got %s", expected.InlineComment, actual.InlineComment)
 	}
 
-	if expected.HereDocRedirection != actual.HereDocRedirection {
-		return fmt.Sprintf("Token heredoc redirection mismatch: Expected %v Got %v", expected.HereDocRedirection, actual.HereDocRedirection)
-	}
-
-	if !reflect.DeepEqual(expected.MultiLineContent, actual.MultiLineContent) {
-		return fmt.Sprintf("Token multiline content mismatch: Expected %v Got %v", expected.MultiLineContent, actual.MultiLineContent)
+	if !reflect.DeepEqual(expected.Heredocs, actual.Heredocs) {
+		return fmt.Sprintf("Token heredoc mismatch: Expected %+v Got %+v", expected.Heredocs, actual.Heredocs)
 	}
 
 	return ""
@@ -68,7 +65,7 @@ func TestInstructionParse(t *testing.T) {
 					Params: map[string][]string{
 						"from": {"build"},
 					},
-					Content: "test:latest",
+					Content: "/hello /",
 				},
 			},
 		},
@@ -134,7 +131,7 @@ func TestInstructionParse(t *testing.T) {
 				{
 					Kind:    token.COMMENT,
 					Params:  map[string][]string{},
-					Content: "test",
+					Content: " test",
 				},
 			},
 		},
@@ -144,8 +141,8 @@ func TestInstructionParse(t *testing.T) {
 				{
 					Kind:          token.RUN,
 					Params:        map[string][]string{},
-					Content:       "echo a",
-					InlineComment: " test",
+					Content:       "echo a # test",
+					InlineComment: "",
 				},
 			},
 		},
@@ -166,7 +163,7 @@ func TestInstructionParse(t *testing.T) {
 				{
 					Kind:    token.RUN,
 					Params:  map[string][]string{},
-					Content: "RUN [\"apt\",\"--yes\",\"install\",\"vim\"]",
+					Content: "[\"apt\",\"--yes\",\"install\",\"vim\"]",
 				},
 			},
 		},
@@ -176,7 +173,7 @@ func TestInstructionParse(t *testing.T) {
 				{
 					Kind:          token.RUN,
 					Params:        map[string][]string{},
-					Content:       "echo a #test",
+					Content:       "echo 'a # test'",
 					InlineComment: "",
 				},
 			},
@@ -187,8 +184,8 @@ func TestInstructionParse(t *testing.T) {
 				{
 					Kind:          token.RUN,
 					Params:        map[string][]string{},
-					Content:       "echo a # test",
-					InlineComment: "another test",
+					Content:       "echo 'a # test' #another test",
+					InlineComment: "",
 				},
 			},
 		},
@@ -199,22 +196,71 @@ func TestInstructionParse(t *testing.T) {
 				"apt-get install -y vim",
 				"EOT"},
 			ExpectedOutput: []token.Token{{
-				Kind:               token.RUN,
-				Params:             map[string][]string{},
-				Content:            "",
-				MultiLineContent:   []string{"EOT bash", "set -ex", "apt-get update", "apt-get install -y vim", "EOT"},
-				HereDocRedirection: false,
+				Kind:    token.RUN,
+				Params:  map[string][]string{},
+				Content: "<<EOT bash",
+				Heredocs: []token.Heredoc{
+					{Name: "EOT", Body: "set -ex\napt-get update\napt-get install -y vim\n", Expand: true},
+				},
 			},
 			},
 		},
 		{
 			Input: []string{"COPY --from=build <<- 'EOF' greeting.txt", "hello world", "EOF"},
 			ExpectedOutput: []token.Token{{
-				Kind:               token.COPY,
-				Params:             map[string][]string{"from": {"build"}},
-				Content:            "",
-				MultiLineContent:   []string{" 'EOF' greeting.txt", "hello world", "EOF"},
-				HereDocRedirection: true,
+				Kind:    token.COPY,
+				Params:  map[string][]string{"from": {"build"}},
+				Content: "<<- 'EOF' greeting.txt",
+				Heredocs: []token.Heredoc{
+					{Name: "EOF", Body: "hello world\n", Expand: false, StripTabs: true},
+				},
+			},
+			},
+		},
+		{
+			Input: []string{"RUN <<FILE1 cat > file1 && <<\"FILE2\" cat > file2", "  line 1", "FILE1", "$line 2", "FILE2", "USER root"},
+			ExpectedOutput: []token.Token{{
+				Kind:    token.RUN,
+				Params:  map[string][]string{},
+				Content: "<<FILE1 cat > file1 && <<\"FILE2\" cat > file2",
+				Heredocs: []token.Heredoc{
+					{Name: "FILE1", Body: "  line 1\n", Expand: true},
+					{Name: "FILE2", Body: "$line 2\n", Expand: false},
+				},
+			}, {
+				Kind:    token.USER,
+				Params:  map[string][]string{},
+				Content: "root",
+			},
+			},
+		},
+		{
+			Input: []string{"RUN python3 <<-EOF \\", "  && echo done", "\tprint('hi') \\", "\tEOF", "ADD <<EOF /dest", "EOF"},
+			ExpectedOutput: []token.Token{{
+				Kind:    token.RUN,
+				Params:  map[string][]string{},
+				Content: "python3 <<-EOF && echo done",
+				Heredocs: []token.Heredoc{
+					{Name: "EOF", Body: "\tprint('hi') \\\n", Expand: true, StripTabs: true},
+				},
+			}, {
+				Kind:     token.ADD,
+				Params:   map[string][]string{},
+				Content:  "<<EOF /dest",
+				Heredocs: []token.Heredoc{{Name: "EOF", Expand: true}},
+			},
+			},
+		},
+		{
+			Input: []string{"RUN echo \"<<EOF\" <<< here", "USER root"},
+			ExpectedOutput: []token.Token{{
+				Kind:    token.RUN,
+				Params:  map[string][]string{},
+				Content: "echo \"<<EOF\" <<< here",
+			}, {
+				Kind:    token.USER,
+				Params:  map[string][]string{},
+				Content: "root",
 			},
 			},
 		},
@@ -232,6 +278,10 @@ func TestInstructionParse(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to lex: %s", err.Error())
 		}
+		if len(got) != len(v.ExpectedOutput) {
+			t.Errorf("Token count mismatch: Expected %d Got %d (%s)", len(v.ExpectedOutput), len(got), v.Input)
+			continue
+		}
 		for i := range got {
 			err := compareTokens(v.ExpectedOutput[i], got[i])
 			if err != "" {
@@ -241,6 +291,160 @@ func TestInstructionParse(t *testing.T) {
 	}
 }
 
+func TestEscapeDirective(t *testing.T) {
+	input := []string{
+		"# escape=`",
+		"FROM mcr.microsoft.com/windows/servercore",
+		"RUN echo \"a # b\" `",
+		"  C:\\temp\\ # comment",
+	}
+	expected := []token.Token{
+		{Kind: token.PARSER_DIRECTIVE, Content: " escape=`"},
+		{Kind: token.FROM, Params: map[string][]string{}, Content: "mcr.microsoft.com/windows/servercore"},
+		{Kind: token.RUN, Params: map[string][]string{}, Content: "echo \"a # b\" C:\\temp\\ # comment"},
+	}
+	l := lexer.NewFromInput(input)
+	got, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Failed to lex: %s", err.Error())
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Token count mismatch: Expected %d Got %d", len(expected), len(got))
+	}
+	for i := range got {
+		if err := compareTokens(expected[i], got[i]); err != "" {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUnterminatedHeredoc(t *testing.T) {
+	l := lexer.NewFromInput([]string{"RUN <<EOF", "echo hi"})
+	tokens, err := l.Lex()
+	if err == nil {
+		t.Fatalf("Expected lexing to fail")
+	}
+	if len(tokens) != 1 || l.Diagnostics()[0].Code != diagnostic.UnterminatedHeredoc {
+		t.Errorf("Unterminated heredoc mismatch: Got %v (%v)", tokens, l.Diagnostics())
+	}
+}
+
+func TestFlagOrder(t *testing.T) {
+	l := lexer.NewFromInput([]string{"COPY --link --exclude=*.md --from=build --exclude=*.txt /foo /bar"})
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	expected := []string{"--link", "--exclude=*.md", "--from=build", "--exclude=*.txt"}
+	if !reflect.DeepEqual(expected, tokens[0].Flags) {
+		t.Errorf("Flag mismatch: Expected %+q Got %+q", expected, tokens[0].Flags)
+	}
+}
+
+func TestIncompleteFlags(t *testing.T) {
+	for _, line := range []string{"COPY --", "HEALTHCHECK --", "COPY -- a b", "RUN --=x echo", "ADD --link --"} {
+		l := lexer.NewFromInput([]string{"FROM alpine", line})
+		_, err := l.Lex()
+		if err == nil {
+			t.Errorf("Expected lexing of %q to fail", line)
+		}
+		if diagnostics := l.Diagnostics(); len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.InvalidFlag {
+			t.Errorf("Diagnostic mismatch for %q: Got %v", line, diagnostics)
+		}
+	}
+	testCases := map[string][]string{
+		"COPY --link":            {"--link"},
+		"COPY --from=build":      {"--from=build"},
+		"COPY a--b c":            {},
+		"RUN [\"--help\"]":       {},
+		"COPY  --chmod=644  a b": {"--chmod=644"},
+	}
+	for line, expected := range testCases {
+		l := lexer.NewFromInput([]string{line})
+		tokens, err := l.Lex()
+		if err != nil {
+			t.Errorf("Lexing %q failed: %s", line, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(expected, tokens[0].Flags) {
+			t.Errorf("Flag mismatch for %q: Expected %+q Got %+q", line, expected, tokens[0].Flags)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := []string{
+		"FROM alpine AS base",
+		"",
+		"  RUN apt-get update && \\",
+		"    apt-get install -y vim",
+		"COPY <<EOF /hello",
+		"hello",
+		"EOF",
+	}
+	expected := [][2]token.Position{
+		{{Line: 1, Column: 1}, {Line: 1, Column: 20}},
+		{{Line: 2, Column: 1}, {Line: 2, Column: 1}},
+		{{Line: 3, Column: 3}, {Line: 4, Column: 27}},
+		{{Line: 5, Column: 1}, {Line: 7, Column: 4}},
+	}
+	l := lexer.NewFromInput(input)
+	got, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Failed to lex: %s", err.Error())
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Token count mismatch: Expected %d Got %d", len(expected), len(got))
+	}
+	for i := range got {
+		if got[i].Start != expected[i][0] || got[i].End != expected[i][1] {
+			t.Errorf("Token position mismatch (token %d): Expected %v-%v Got %v-%v", i, expected[i][0], expected[i][1], got[i].Start, got[i].End)
+		}
+	}
+}
+
+func TestIllegalInstruction(t *testing.T) {
+	l := lexer.NewFromInput([]string{"FROM alpine", "FORM alpine"})
+	tokens, err := l.Lex()
+	if err == nil {
+		t.Fatalf("Expected lexing to fail")
+	}
+	if len(tokens) != 1 {
+		t.Errorf("Token count mismatch: Expected %d Got %d", 1, len(tokens))
+	}
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.IllegalInstruction {
+		t.Fatalf("Diagnostic mismatch: Got %v", diagnostics)
+	}
+	if diagnostics[0].Start != (token.Position{Line: 2, Column: 1}) || diagnostics[0].End != (token.Position{Line: 2, Column: 12}) {
+		t.Errorf("Diagnostic position mismatch: Got %v-%v", diagnostics[0].Start, diagnostics[0].End)
+	}
+}
+
+func TestIllegalInstructionRecovery(t *testing.T) {
+	l := lexer.NewFromInput([]string{"FROM alpine", "FORM alpine", "RUN echo a"})
+	l.SetRecover(true)
+	tokens, err := l.Lex()
+	if err == nil {
+		t.Errorf("Expected error to be reported")
+	}
+	expectedKinds := []int{token.FROM, token.ILLEGAL, token.RUN}
+	if len(tokens) != len(expectedKinds) {
+		t.Fatalf("Token count mismatch: Expected %d Got %d", len(expectedKinds), len(tokens))
+	}
+	for i := range tokens {
+		if tokens[i].Kind != expectedKinds[i] {
+			t.Errorf("Token kind mismatch: Expected %d Got %d", expectedKinds[i], tokens[i].Kind)
+		}
+	}
+	if tokens[1].Content != "FORM alpine" {
+		t.Errorf("Illegal token content mismatch: Expected %s Got %s", "FORM alpine", tokens[1].Content)
+	}
+	if len(l.Diagnostics()) != 1 {
+		t.Errorf("Diagnostic count mismatch: Expected %d Got %d", 1, len(l.Diagnostics()))
+	}
+}
+
 func BenchmarkLexer(b *testing.B) {
 	for range b.N {
 		// Lexer creation performs action on startup -> run this in the loop
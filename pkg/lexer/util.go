@@ -1,8 +1,12 @@
 package lexer
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+	"unicode"
 
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
 )
@@ -36,181 +40,196 @@ func (l Lexer) getCurrentCharacter() rune {
 	return rune(l.lines[l.currentLine][l.currentIndex])
 }
 
+// Advance over a single --key[=value] flag, flags without a value are set to true
+// Returns false and keeps the position if the next word is not a flag
 func (l *Lexer) advanceParam() (string, string, bool) {
-	// TODO: clean this up
-	key := ""
-	value := ""
-	ok := false
-	endIndex := len(l.lines[l.currentLine]) - 1
-	currentWordStartIndex := 0
-	seenCharacters := false
-	if l.currentIndex == endIndex {
-		return key, value, ok
+	line := l.lines[l.currentLine]
+	start := l.currentIndex
+	for start < len(line) && line[start] == ' ' {
+		start++
 	}
-	startIndex := l.currentIndex
-	for l.currentIndex < endIndex {
-		// Cover edge case where parameters in array struct like this were parsed as instruction parameters
-		// There may be a cleaner solution for this
-		if l.expectCurrentCharacter('[') && !ok {
-			break
-		}
-		if l.expectCurrentCharacter(' ') && !ok {
-			if !seenCharacters {
-				l.currentIndex++
-				continue
-			}
-			break
-		}
-		seenCharacters = true
-		if l.expectCurrentCharacter('-') && l.expectNextCharacter('-') {
-			ok = true
-			l.currentIndex += 2
-			currentWordStartIndex = l.currentIndex
-			l.currentIndex++
-			continue
-		}
-		if ok {
-			if len(key) == 0 {
-				if l.expectCurrentCharacter('=') {
-					key = l.lines[l.currentLine][currentWordStartIndex:l.currentIndex]
-					currentWordStartIndex = l.currentIndex + 1
-					l.currentIndex++
-					continue
-				}
-				// Support params with no passed value
-				if l.expectCurrentCharacter(' ') {
-					endIndex = l.currentIndex
-					value = "true" // these are assignments without = -> flags
-					key = l.lines[l.currentLine][currentWordStartIndex:l.currentIndex]
-					break
-				}
-
-			} else {
-				if l.expectCurrentCharacter(' ') {
-					endIndex = l.currentIndex
-					value = l.lines[l.currentLine][currentWordStartIndex:l.currentIndex]
-					break
-				}
-			}
-		}
-		l.currentIndex++
+	if !strings.HasPrefix(line[start:], "--") {
+		return "", "", false
 	}
-	if !ok {
-		l.currentIndex = startIndex
+	end := start
+	for end < len(line) && line[end] != ' ' {
+		end++
 	}
-	return key, value, ok
+	l.currentIndex = end
+	key, value, hasValue := strings.Cut(line[start+2:end], "=")
+	if !hasValue {
+		value = "true"
+	}
+	return key, value, true
 }
 
+// Instructions whose operand is kept as written as docker only treats lines starting with # as comments
+// The shell decides what is a comment in commands, the word splitting of ENV, LABEL and ARG keeps # as part of the value
+var verbatimKinds = []int{token.RUN, token.CMD, token.ENTRYPOINT, token.HEALTHCHECK, token.ENV, token.LABEL, token.ARG}
+
 func (l *Lexer) buildToken(kind int) token.Token {
 	if kind == token.COMMENT {
-		if k, _ := util.ParseAssign(l.lines[l.currentLine][l.currentIndex:]); len(k) != 0 {
+		if l.currentLine < l.directives {
 			kind = token.PARSER_DIRECTIVE
 		}
 		return token.Token{Kind: kind, Content: l.lines[l.currentLine][l.currentIndex:]}
 	}
 	params := make(map[string][]string)
+	flags := []string{}
 	for {
+		flagStart := l.currentIndex
 		key, value, ok := l.advanceParam()
 		if !ok {
 			break
 		}
+		flag := strings.TrimSpace(l.lines[l.currentLine][flagStart:l.currentIndex])
+		if key == "" {
+			l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+				Severity: diagnostic.Error,
+				Code:     diagnostic.InvalidFlag,
+				Message:  fmt.Sprintf("Flag %s has no name", flag),
+				Start:    l.positionOf(l.currentLine, flagStart),
+				End:      l.positionOf(l.currentLine, l.currentIndex),
+			})
+			continue
+		}
 		params[key] = append(params[key], value)
+		flags = append(flags, flag)
 	}
-	if kind == token.RUN || kind == token.COPY {
-		if l.containsHeredoc() {
-			return l.buildHereDocToken(kind, params)
+	startIndex := l.currentIndex
+	comment := ""
+	if slices.Contains(verbatimKinds, kind) {
+		l.currentIndex = len(l.lines[l.currentLine])
+	} else {
+		l.advanceToStartOfComment()
+		if l.currentIndex < len(l.lines[l.currentLine]) {
+			// Remove comment symbol
+			comment = l.lines[l.currentLine][l.currentIndex+1:]
 		}
 	}
-	startIndex := l.currentIndex
-	l.advanceToStartOfComment()
 	return token.Token{
 		Kind:          kind,
 		Params:        params,
-		Content:       l.lines[l.currentLine][startIndex:l.currentIndex],
-		InlineComment: l.lines[l.currentLine][l.currentIndex:],
+		Flags:         flags,
+		Content:       strings.TrimSpace(l.lines[l.currentLine][startIndex:l.currentIndex]),
+		InlineComment: comment,
+		Comments:      l.info[l.currentLine].comments,
+		Heredocs:      l.info[l.currentLine].heredocs,
 	}
 }
 
-func (l *Lexer) buildHereDocToken(kind int, params map[string][]string) token.Token {
-	// Get identifier and go until end
-	heredocContent := []string{}
-	encounteredRedirection := strings.HasPrefix(l.lines[l.currentLine][l.currentIndex:], "<<-")
+// A segment maps a part of a merged line back to the physical line it originates from
+type segment struct {
+	offset int // Offset of the segment start in the merged line
+	line   int // Physical line (1-based)
+	column int // Column of the segment start in the physical line (1-based)
+}
 
-	l.currentIndex += 2         // advance <<
-	if encounteredRedirection { //advance -
-		l.currentIndex++
-	}
+// Information about a merged line
+type lineInfo struct {
+	segments     []segment
+	comments     []string // comment lines in between continuation lines
+	heredocs     []token.Heredoc
+	unterminated bool           // a heredoc was not terminated before the end of the input
+	end          token.Position // directly after the last character of the line including heredoc bodies
+}
 
-	heredocContent = append(heredocContent, l.lines[l.currentLine][l.currentIndex:])
-	heredocStartIndex := l.currentIndex
-	hasSeenCharacter := false
-	// Parse delim
-	for l.currentIndex < len(l.lines[l.currentLine]) {
-		if l.expectCurrentCharacter(' ') {
-			if hasSeenCharacter {
-				break
-			}
-			l.currentIndex++
-			heredocStartIndex++
-			continue
+// Map an offset in a merged line back to the position in the original input
+func (l Lexer) positionOf(line, offset int) token.Position {
+	segments := l.info[line].segments
+	current := segments[0]
+	for _, s := range segments[1:] {
+		if s.offset > offset {
+			break
 		}
-		hasSeenCharacter = true
-		l.currentIndex++
+		current = s
 	}
-	delim := l.lines[l.currentLine][heredocStartIndex:l.currentIndex]
-	delim = strings.ReplaceAll(strings.ReplaceAll(delim, "'", ""), "\"", "") // Delim definition may contain quotes...this is the easiest way to handle them for now
+	return token.Position{Line: current.line, Column: current.column + offset - current.offset}
+}
 
-	l.currentLine++
+// Position directly after the last character of a merged line
+func (l Lexer) endOf(line int) token.Position {
+	return l.info[line].end
+}
 
-	for l.currentLine < len(l.lines) {
-		heredocContent = append(heredocContent, l.lines[l.currentLine])
-		if strings.HasPrefix(l.lines[l.currentLine], delim) {
-			break
-		}
-		l.currentLine++
-	}
+// Physical lines a merged line was built from including continuation comments and heredoc bodies
+func (l Lexer) rawOf(line int) []string {
+	return l.input[l.info[line].segments[0].line-1 : l.info[line].end.Line]
+}
 
-	return token.Token{
-		Kind:               kind,
-		Params:             params,
-		MultiLineContent:   heredocContent,
-		HereDocRedirection: encounteredRedirection,
+// Keys of the parser directives docker knows, any other # key=value line is a comment
+var directiveKeys = []string{"syntax", "escape", "check"}
+
+// Parse a line as parser directive
+// Returns false if the line is not a valid parser directive
+func parseDirective(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "#") {
+		return "", "", false
 	}
+	key, value := util.ParseAssign(trimmed[1:])
+	key = strings.ToLower(strings.TrimSpace(key))
+	if !slices.Contains(directiveKeys, key) {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(value), true
 }
 
-func (l *Lexer) containsHeredoc() bool {
-	startIndex := l.currentIndex
-	for l.currentIndex < len(l.lines[l.currentLine]) {
-		if l.expectCurrentCharacter('<') && l.expectNextCharacter('<') {
-			return true
-		}
-		if !l.expectCurrentCharacter(' ') {
+// Parser directives are only valid before the first comment, empty line or instruction
+// Returns the escape character and the number of leading directive lines
+func detectDirectives(input []string) (byte, int) {
+	escape := byte('\\')
+	count := 0
+	for _, line := range input {
+		key, value, ok := parseDirective(line)
+		if !ok {
 			break
 		}
-		l.currentIndex++
+		if key == "escape" && (value == "`" || value == "\\") {
+			escape = value[0]
+		}
+		count++
 	}
-	l.currentIndex = startIndex
-	return false
+	return escape, count
 }
 
-func mergeLines(input []string) []string {
+// Merge lines continued with the escape character into a single line
+// Heredoc bodies are kept verbatim and attached to the line that started them
+func mergeLines(input []string, escape byte) ([]string, []lineInfo) {
 	target := []string{}
+	infos := []lineInfo{}
 	buffer := ""
+	info := lineInfo{}
 
-	for i := range input {
+	for i := 0; i < len(input); i++ {
 		in := strings.TrimSpace(input[i])
-		buffer = buffer + in
-		if strings.HasSuffix(in, "\\") {
-			buffer = strings.TrimSuffix(buffer, "\\")
+		// Comments in between continuation lines are not part of the instruction but kept as trivia
+		if strings.HasPrefix(in, "#") && len(info.segments) != 0 {
+			info.comments = append(info.comments, in[1:])
 			continue
 		}
-		// swallow mid instruction comments
-		// TODO: parse this properly
-		if strings.HasPrefix(in, "#") && len(buffer) > len(in) {
+		column := len(input[i]) - len(strings.TrimLeftFunc(input[i], unicode.IsSpace)) + 1
+		info.segments = append(info.segments, segment{offset: len(buffer), line: i + 1, column: column})
+		info.end = token.Position{Line: i + 1, Column: column + len(in)}
+		buffer = buffer + in
+		// Comments cannot be continued
+		isComment := strings.HasPrefix(in, "#")
+		if !isComment && len(in) > 0 && in[len(in)-1] == escape {
+			buffer = buffer[:len(buffer)-1]
 			continue
 		}
+		if !isComment {
+			i = collectHeredocs(input, i, buffer, escape, &info)
+		}
 		target = append(target, buffer)
+		infos = append(infos, info)
 		buffer = ""
+		info = lineInfo{}
+	}
+	// Input ended with a continued line
+	if len(info.segments) != 0 {
+		target = append(target, buffer)
+		infos = append(infos, info)
 	}
-	return target
+	return target, infos
 }
@@ -8,8 +8,70 @@ import (
 func TestMergeLine(t *testing.T) {
 	input := []string{"do a \\", "do B", "do C"}
 	expected := []string{"do a do B", "do C"}
-	actual := mergeLines(input)
+	actual, _ := mergeLines(input, '\\')
 	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("Merged lines mismatch: Expected %+q Got %+q", expected, actual)
 	}
 }
+
+func TestMergeLineSegments(t *testing.T) {
+	input := []string{"RUN a \\", "  b"}
+	expected := []segment{{offset: 0, line: 1, column: 1}, {offset: 6, line: 2, column: 3}}
+	_, info := mergeLines(input, '\\')
+	if len(info) != 1 || !reflect.DeepEqual(expected, info[0].segments) {
+		t.Errorf("Merged line segments mismatch: Expected %v Got %v", expected, info)
+	}
+}
+
+func TestMergeLineEscapeDirective(t *testing.T) {
+	input := []string{"# escape=`", "RUN dir c:\\ `", "  /w", "# comment \\", "RUN a"}
+	escape, directives := detectDirectives(input)
+	if escape != '`' || directives != 1 {
+		t.Fatalf("Directive mismatch: Expected %c (%d) Got %c (%d)", '`', 1, escape, directives)
+	}
+	expected := []string{"# escape=`", "RUN dir c:\\ /w", "# comment \\", "RUN a"}
+	actual, _ := mergeLines(input, escape)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Merged lines mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestDirectivesOnlyAtStart(t *testing.T) {
+	input := []string{"# syntax=docker/dockerfile:1", "#Escape = `", "", "# escape=\\"}
+	escape, directives := detectDirectives(input)
+	if escape != '`' || directives != 2 {
+		t.Errorf("Directive mismatch: Expected %c (%d) Got %c (%d)", '`', 2, escape, directives)
+	}
+}
+
+func TestUnknownDirectives(t *testing.T) {
+	testCases := map[string]struct {
+		Input      []string
+		Escape     byte
+		Directives int
+	}{
+		"unknown first":      {[]string{"# foo=bar", "# escape=`"}, '\\', 0},
+		"unknown after":      {[]string{"# check=skip=all", "# foo=bar", "# escape=`"}, '\\', 1},
+		"known":              {[]string{"# check=error=true", "# Syntax=docker/dockerfile:1", "# escape=`"}, '`', 3},
+		"key with space":     {[]string{"# escape char=`"}, '\\', 0},
+		"comment with value": {[]string{"# TODO=later", "FROM alpine"}, '\\', 0},
+	}
+	for name, testCase := range testCases {
+		escape, directives := detectDirectives(testCase.Input)
+		if escape != testCase.Escape || directives != testCase.Directives {
+			t.Errorf("Directive mismatch for %s: Expected %c (%d) Got %c (%d)", name, testCase.Escape, testCase.Directives, escape, directives)
+		}
+	}
+}
+
+func TestMergeLineContinuationComments(t *testing.T) {
+	input := []string{"RUN apt-get update && \\", "  # install vim", "  apt-get install -y vim", "# standalone"}
+	expected := []string{"RUN apt-get update && apt-get install -y vim", "# standalone"}
+	actual, info := mergeLines(input, '\\')
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Merged lines mismatch: Expected %+q Got %+q", expected, actual)
+	}
+	if !reflect.DeepEqual([]string{" install vim"}, info[0].comments) {
+		t.Errorf("Continuation comment mismatch: Expected %+q Got %+q", []string{" install vim"}, info[0].comments)
+	}
+}
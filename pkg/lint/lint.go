@@ -0,0 +1,182 @@
+// Package checking Dockerfiles for common mistakes
+package lint
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
+)
+
+// Comments starting with this prefix suppress the listed rules for the following instruction (e.g. # dfp-ignore: DL3007,DL3006)
+const IgnorePrefix = "dfp-ignore:"
+
+// Problem found by a rule
+type Finding struct {
+	Node    ast.Node // Node the problem was found in, the finding spans the whole node or has no position if nil
+	Message string
+}
+
+// A check operating on the whole tree
+type Rule interface {
+	Code() string // Unique code used for configuration and suppression, e.g. DL3007
+	Description() string
+	DefaultSeverity() diagnostic.Severity
+	Check(root *ast.StageNode) []Finding
+}
+
+type funcRule struct {
+	code        string
+	description string
+	severity    diagnostic.Severity
+	check       func(root *ast.StageNode) []Finding
+}
+
+func (r *funcRule) Code() string                         { return r.code }
+func (r *funcRule) Description() string                  { return r.description }
+func (r *funcRule) DefaultSeverity() diagnostic.Severity { return r.severity }
+func (r *funcRule) Check(root *ast.StageNode) []Finding  { return r.check(root) }
+
+// Create a rule from a check function
+func NewRule(code, description string, severity diagnostic.Severity, check func(root *ast.StageNode) []Finding) Rule {
+	return &funcRule{code: code, description: description, severity: severity, check: check}
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]Rule{}
+)
+
+// Add the rule to the rules used by Lint
+// Registering a code twice is an error
+func Register(rule Rule) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[rule.Code()]; ok {
+		return fmt.Errorf("rule %s is already registered", rule.Code())
+	}
+	registry[rule.Code()] = rule
+	return nil
+}
+
+// Registered rule with the code
+func Lookup(code string) (Rule, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	rule, ok := registry[code]
+	return rule, ok
+}
+
+// All registered rules sorted by code
+func Rules() []Rule {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	res := []Rule{}
+	for _, code := range slices.Sorted(maps.Keys(registry)) {
+		res = append(res, registry[code])
+	}
+	return res
+}
+
+// Configuration of a lint run
+type Config struct {
+	Severities map[string]diagnostic.Severity // Overrides the default severity of the rule with the code
+	Disabled   []string                       // Codes of the rules that are not run
+}
+
+// Run all registered rules that are not disabled
+// Findings suppressed by comments are dropped, the result is sorted by position
+func Lint(root *ast.StageNode, cfg Config) diagnostic.List {
+	ignored := ignoredCodes(root)
+	res := diagnostic.List{}
+	for _, rule := range Rules() {
+		if slices.Contains(cfg.Disabled, rule.Code()) {
+			continue
+		}
+		severity, ok := cfg.Severities[rule.Code()]
+		if !ok {
+			severity = rule.DefaultSeverity()
+		}
+		for _, finding := range rule.Check(root) {
+			if slices.Contains(ignored[finding.Node], rule.Code()) {
+				continue
+			}
+			var start, stop token.Position
+			if finding.Node != nil {
+				start, stop = finding.Node.Pos(), end(finding.Node)
+			}
+			res = append(res, diagnostic.Diagnostic{
+				Severity: severity,
+				Code:     rule.Code(),
+				Message:  finding.Message,
+				Start:    start,
+				End:      stop,
+			})
+		}
+	}
+	slices.SortStableFunc(res, func(a, b diagnostic.Diagnostic) int {
+		if a.Start.Line != b.Start.Line {
+			return a.Start.Line - b.Start.Line
+		}
+		return a.Start.Column - b.Start.Column
+	})
+	return res
+}
+
+// Findings on a stage only span the FROM instruction instead of the whole stage
+func end(node ast.Node) token.Position {
+	raw := node.Info().Raw
+	if _, ok := node.(*ast.StageNode); !ok || len(raw) == 0 {
+		return node.End()
+	}
+	return token.Position{Line: node.Pos().Line + len(raw) - 1, Column: len(raw[len(raw)-1]) + 1}
+}
+
+// Codes suppressed for each node
+// A suppression comment applies to the next instruction, comments in between the continuation lines apply to their instruction
+func ignoredCodes(root *ast.StageNode) map[ast.Node][]string {
+	res := map[ast.Node][]string{}
+	pending := []string{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case nil, *ast.EmptyLineNode:
+		case *ast.CommentInstructionNode:
+			pending = append(pending, parseIgnore(node.Text)...)
+		default:
+			// The root stage has no FROM and can therefore not be suppressed
+			if stage, ok := node.(*ast.StageNode); ok && stage == root {
+				return true
+			}
+			for _, comment := range node.Info().Comments {
+				pending = append(pending, parseIgnore(comment)...)
+			}
+			if len(pending) != 0 {
+				res[node] = pending
+				pending = []string{}
+			}
+		}
+		return true
+	})
+	return res
+}
+
+// Codes listed by a suppression comment
+func parseIgnore(comment string) []string {
+	comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "#"))
+	codes, ok := strings.CutPrefix(comment, IgnorePrefix)
+	if !ok {
+		return nil
+	}
+	res := []string{}
+	for _, code := range strings.Split(codes, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			res = append(res, code)
+		}
+	}
+	return res
+}
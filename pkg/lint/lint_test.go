@@ -0,0 +1,105 @@
+package lint_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+// Codes of the findings prefixed with their line
+func findings(list diagnostic.List) []string {
+	res := []string{}
+	for _, d := range list {
+		res = append(res, fmt.Sprintf("%s@%d", d.Code, d.Start.Line))
+	}
+	return res
+}
+
+func TestSuppression(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"# dfp-ignore: DL3007, DL3002",
+		"FROM alpine:latest",
+		"MAINTAINER someone",
+		"# dfp-ignore: DL4000",
+		"MAINTAINER someone",
+		"RUN echo \\",
+		"# dfp-ignore: DL3020",
+		"  done",
+	})
+	expected := []string{"DL4000@3"}
+	if actual := findings(lint.Lint(root, lint.Config{})); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Findings mismatch: Expected %v Got %v", expected, actual)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	root := testdata.Parse(t, []string{
+		"FROM alpine",
+		"USER app",
+		"WORKDIR app",
+	})
+	list := lint.Lint(root, lint.Config{
+		Severities: map[string]diagnostic.Severity{lint.AbsoluteWorkdir: diagnostic.Info},
+		Disabled:   []string{lint.UntaggedImage},
+	})
+	if len(list) != 1 || list[0].Code != lint.AbsoluteWorkdir || list[0].Severity != diagnostic.Info {
+		t.Errorf("Findings mismatch: Got %v", list)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// The rule only reports stages named testrule to not interfere with other tests
+	rule := lint.NewRule("TEST001", "Test rule", diagnostic.Info, func(root *ast.StageNode) []lint.Finding {
+		res := []lint.Finding{}
+		for _, stage := range root.Stages() {
+			if stage.Name == "testrule" {
+				res = append(res, lint.Finding{Node: stage, Message: "found"})
+			}
+		}
+		return res
+	})
+	if _, ok := lint.Lookup("TEST001"); !ok {
+		if err := lint.Register(rule); err != nil {
+			t.Fatalf("Registering failed: %s", err.Error())
+		}
+	}
+	if err := lint.Register(rule); err == nil {
+		t.Errorf("Expected error when registering a code twice")
+	}
+	if _, ok := lint.Lookup("TEST001"); !ok {
+		t.Errorf("Registered rule not found")
+	}
+	root := testdata.Parse(t, []string{"FROM alpine:3.20 AS testrule", "USER app"})
+	list := lint.Lint(root, lint.Config{})
+	if len(list) != 1 || list[0].Code != "TEST001" || list[0].Message != "found" {
+		t.Errorf("Findings mismatch: Got %v", list)
+	}
+}
+
+func TestFindingWithoutNode(t *testing.T) {
+	// The rule only reports if a stage is named nilrule to not interfere with other tests
+	rule := lint.NewRule("TEST002", "Test rule without node", diagnostic.Info, func(root *ast.StageNode) []lint.Finding {
+		for _, stage := range root.Stages() {
+			if stage.Name == "nilrule" {
+				return []lint.Finding{{Message: "whole file"}}
+			}
+		}
+		return nil
+	})
+	if _, ok := lint.Lookup("TEST002"); !ok {
+		if err := lint.Register(rule); err != nil {
+			t.Fatalf("Registering failed: %s", err.Error())
+		}
+	}
+	root := testdata.Parse(t, []string{"FROM alpine:3.20 AS nilrule", "USER app"})
+	list := lint.Lint(root, lint.Config{})
+	if len(list) != 1 || list[0].Code != "TEST002" || list[0].Start.Line != 0 || list[0].End.Line != 0 {
+		t.Errorf("Findings mismatch: Got %v", list)
+	}
+}
@@ -0,0 +1,181 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/config"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+)
+
+// Codes of the built-in rules, they follow the numbering of hadolint
+const (
+	UntaggedImage        = "DL3006"
+	LatestImage          = "DL3007"
+	RootUser             = "DL3002"
+	AbsoluteWorkdir      = "DL3000"
+	CopyInsteadOfAdd     = "DL3020"
+	ExecFormEntrypoint   = "DL3025"
+	MaintainerDeprecated = "DL4000"
+	MultipleCmd          = "DL4003"
+	MultipleEntrypoint   = "DL4004"
+)
+
+func init() {
+	for _, rule := range []Rule{
+		NewRule(UntaggedImage, "Always tag the version of the base image explicitly", diagnostic.Warning, checkUntaggedImage),
+		NewRule(LatestImage, "Using latest is prone to errors if the image will ever update", diagnostic.Warning, checkLatestImage),
+		NewRule(RootUser, "The final stage should switch to a user other than root", diagnostic.Warning, checkRootUser),
+		NewRule(AbsoluteWorkdir, "Use absolute WORKDIR paths", diagnostic.Error, checkAbsoluteWorkdir),
+		NewRule(CopyInsteadOfAdd, "Use COPY instead of ADD for files and folders", diagnostic.Error, checkCopyInsteadOfAdd),
+		NewRule(ExecFormEntrypoint, "Use the exec form for ENTRYPOINT", diagnostic.Warning, checkExecFormEntrypoint),
+		NewRule(MaintainerDeprecated, "MAINTAINER is deprecated, use a LABEL instead", diagnostic.Error, checkMaintainer),
+		NewRule(MultipleCmd, "Only the last CMD of a stage takes effect", diagnostic.Warning, checkMultiple[*ast.CmdInstructionNode]("CMD")),
+		NewRule(MultipleEntrypoint, "Only the last ENTRYPOINT of a stage takes effect", diagnostic.Error, checkMultiple[*ast.EntrypointInstructionNode]("ENTRYPOINT")),
+	} {
+		if err := Register(rule); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Stages based on an image that can be pulled, images containing variables cannot be judged without their value
+func imageStages(root *ast.StageNode) []*ast.StageNode {
+	res := []*ast.StageNode{}
+	for _, stage := range root.Stages() {
+		if stage.ImageIsStage || strings.EqualFold(stage.Image, "scratch") || strings.Contains(stage.Image, "$") {
+			continue
+		}
+		res = append(res, stage)
+	}
+	return res
+}
+
+func checkUntaggedImage(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	for _, stage := range imageStages(root) {
+		if stage.Reference.IsUntagged() {
+			res = append(res, Finding{Node: stage, Message: fmt.Sprintf("Image %s is not tagged, pin a version", stage.Image)})
+		}
+	}
+	return res
+}
+
+func checkLatestImage(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	for _, stage := range imageStages(root) {
+		if stage.Reference.Tag == "latest" && stage.Reference.Digest == "" {
+			res = append(res, Finding{Node: stage, Message: fmt.Sprintf("Image %s uses the latest tag, pin a version", stage.Image)})
+		}
+	}
+	return res
+}
+
+func checkRootUser(root *ast.StageNode) []Finding {
+	stages := root.Stages()
+	if len(stages) == 0 {
+		return nil
+	}
+	final := stages[len(stages)-1]
+	var node ast.Node = final
+	for _, instruction := range final.Instructions {
+		if user, ok := instruction.(*ast.UserInstructionNode); ok {
+			node = user
+		}
+	}
+	// The user may be inherited from the stage the final stage is based on
+	user, _, _ := strings.Cut(config.Resolve(root, final).User, ":")
+	switch user {
+	case "":
+		return []Finding{{Node: node, Message: "The final stage does not set a USER, the container runs as root"}}
+	case "root", "0":
+		return []Finding{{Node: node, Message: "The last USER of the final stage is root"}}
+	}
+	return nil
+}
+
+func checkAbsoluteWorkdir(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		workdir, ok := n.(*ast.WorkdirInstructionNode)
+		if !ok {
+			return true
+		}
+		path := strings.Trim(workdir.Path, "\"'")
+		// Variables may contain an absolute path, windows paths start with a drive letter
+		windows := len(path) >= 2 && path[1] == ':'
+		if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "$") && !windows {
+			res = append(res, Finding{Node: workdir, Message: fmt.Sprintf("WORKDIR %s is relative, use an absolute path", workdir.Path)})
+		}
+		return true
+	})
+	return res
+}
+
+// ADD is only required for remote sources and archives that should be extracted
+func checkCopyInsteadOfAdd(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	archives := []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".tar.zst", ".gz", ".bz2", ".xz"}
+	ast.Inspect(root, func(n ast.Node) bool {
+		add, ok := n.(*ast.AddInstructionNode)
+		if !ok || len(add.Heredocs) != 0 || add.CheckSum != "" || add.KeepGitDir {
+			return true
+		}
+		for _, source := range add.Source {
+			if strings.Contains(source, "://") || strings.HasPrefix(source, "git@") || strings.Contains(source, "$") {
+				return true
+			}
+			for _, extension := range archives {
+				if strings.HasSuffix(strings.ToLower(source), extension) {
+					return true
+				}
+			}
+		}
+		res = append(res, Finding{Node: add, Message: "ADD only copies local files, use COPY instead"})
+		return true
+	})
+	return res
+}
+
+// The exec form is required for the process to receive signals
+func checkExecFormEntrypoint(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if entrypoint, ok := n.(*ast.EntrypointInstructionNode); ok && entrypoint.ShellForm {
+			res = append(res, Finding{Node: entrypoint, Message: "ENTRYPOINT uses the shell form, signals will not reach the process"})
+		}
+		return true
+	})
+	return res
+}
+
+func checkMaintainer(root *ast.StageNode) []Finding {
+	res := []Finding{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if maintainer, ok := n.(*ast.MaintainerInstructionNode); ok {
+			res = append(res, Finding{Node: maintainer, Message: "MAINTAINER is deprecated, use LABEL org.opencontainers.image.authors instead"})
+		}
+		return true
+	})
+	return res
+}
+
+// Report every instruction of the type that is overridden by a later one in the same stage
+func checkMultiple[T ast.InstructionNode](keyword string) func(root *ast.StageNode) []Finding {
+	return func(root *ast.StageNode) []Finding {
+		res := []Finding{}
+		for _, stage := range root.Stages() {
+			found := []ast.Node{}
+			for _, instruction := range stage.Instructions {
+				if _, ok := instruction.(T); ok {
+					found = append(found, instruction)
+				}
+			}
+			for i := 0; i < len(found)-1; i++ {
+				res = append(res, Finding{Node: found[i], Message: fmt.Sprintf("%s is overridden by a later %s in the same stage", keyword, keyword)})
+			}
+		}
+		return res
+	}
+}
@@ -0,0 +1,76 @@
+package lint_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lint"
+
+	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
+)
+
+func TestRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name:     "untagged and latest images",
+			input:    []string{"FROM alpine AS a", "FROM nginx:latest AS b", "FROM a", "FROM scratch", "FROM alpine@sha256:abc", "USER app"},
+			expected: []string{"DL3006@1", "DL3007@2"},
+		},
+		{
+			name:     "variables in the image are skipped",
+			input:    []string{"ARG BASE=alpine", "FROM $BASE", "USER app"},
+			expected: []string{},
+		},
+		{
+			name:     "missing user in final stage",
+			input:    []string{"FROM alpine:3 AS build", "USER app", "FROM alpine:3", "RUN make"},
+			expected: []string{"DL3002@3"},
+		},
+		{
+			name:     "root user and inherited user",
+			input:    []string{"FROM alpine:3 AS base", "USER app", "FROM base", "USER root:root"},
+			expected: []string{"DL3002@4"},
+		},
+		{
+			name:     "user inherited from a stage",
+			input:    []string{"FROM alpine:3 AS base", "USER app", "FROM base"},
+			expected: []string{},
+		},
+		{
+			name:     "add where copy suffices",
+			input:    []string{"FROM alpine:3", "ADD app /app", "ADD https://example.com/a /a", "ADD rootfs.tar.gz /", "USER app"},
+			expected: []string{"DL3020@2"},
+		},
+		{
+			name:     "relative workdir",
+			input:    []string{"FROM alpine:3", "WORKDIR app", "WORKDIR /srv", "WORKDIR $HOME", "USER app"},
+			expected: []string{"DL3000@2"},
+		},
+		{
+			name:     "multiple cmd and entrypoint",
+			input:    []string{"FROM alpine:3", "CMD [\"a\"]", "ENTRYPOINT [\"b\"]", "CMD [\"c\"]", "ENTRYPOINT [\"d\"]", "USER app"},
+			expected: []string{"DL4003@2", "DL4004@3"},
+		},
+		{
+			name:     "shell form entrypoint",
+			input:    []string{"FROM alpine:3", "ENTRYPOINT /app --serve", "USER app", "FROM alpine:3", "ENTRYPOINT \\", "  [\"/app\"]", "USER app"},
+			expected: []string{"DL3025@2"},
+		},
+		{
+			name:     "maintainer",
+			input:    []string{"FROM alpine:3", "MAINTAINER someone", "USER app"},
+			expected: []string{"DL4000@2"},
+		},
+	}
+	for _, tc := range testCases {
+		root := testdata.Parse(t, tc.input)
+		list := lint.Lint(root, lint.Config{})
+		if actual := findings(list); !reflect.DeepEqual(tc.expected, actual) {
+			t.Errorf("%s: Findings mismatch: Expected %v Got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/expand"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
 
@@ -19,18 +21,20 @@ type Parser struct {
 	tokens            []token.Token
 	currentTokenIndex int
 	rootNode          *ast.StageNode
+	diagnostics       diagnostic.List
+	escape            byte // escape character as declared by the escape parser directive
 }
 
 // Create new parser
 func NewParser(tokens []token.Token) Parser {
-	return Parser{tokens: tokens, currentTokenIndex: 0, rootNode: &ast.StageNode{Identifier: ast.GenerateStageNodeID(), ParserMetadata: make(map[string]string)}}
+	return Parser{tokens: tokens, currentTokenIndex: 0, rootNode: &ast.StageNode{Identifier: ast.GenerateStageNodeID(), ParserMetadata: make(map[string]string)}, escape: '\\'}
 }
 
 // Parse the token provided during init
 // Return the root stage node of the ast
-func (p *Parser) Parse() *ast.StageNode {
+// The error contains the diagnostics with error severity, the ast is returned regardless
+func (p *Parser) Parse() (*ast.StageNode, error) {
 	localRoot := p.rootNode
-	namedStageLookup := make(map[string]*ast.StageNode)
 	for {
 		if p.currentTokenIndex == len(p.tokens) {
 			break
@@ -39,169 +43,281 @@ func (p *Parser) Parse() *ast.StageNode {
 		switch t.Kind {
 		case token.FROM:
 			node := p.parseFrom(t)
+			node.StartPos = t.Start
+			node.EndPos = t.End
+			node.Comments = t.Comments
+			node.Raw = t.Raw
 			localRoot.Subsequent = node
-			if node.Name != "" {
-				namedStageLookup[node.Identifier] = node
-			}
 			localRoot = node
 		case token.ADD:
 			node := p.parseAdd(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.ARG:
 			node := p.parseArg(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.CMD:
 			node := p.parseCmd(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.COPY:
 			node := p.parseCopy(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
-			if node.(*ast.CopyInstructionNode).From != "" {
-				// Check if from actually is a stage -> can also be image
-				if val, ok := namedStageLookup[node.(*ast.CopyInstructionNode).From]; ok {
-					if !slices.Contains(val.ReferencedByIds, localRoot.Identifier) {
-						val.ReferencedByIds = append(val.ReferencedByIds, localRoot.Identifier)
-					}
-				}
-			}
+			appendInstruction(localRoot, node, t)
 		case token.ENTRYPOINT:
 			node := p.parseEntryPoint(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.ENV:
 			node := p.parseEnv(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.EXPOSE:
 			node := p.parseExpose(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.HEALTHCHECK:
 			node := p.parseHealthCheck(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.LABEL:
 			node := p.parseLabel(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.MAINTAINER:
 			node := p.parseMaintainer(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.ONBUILD:
 			node := p.parseOnBuild(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.RUN:
 			node := p.parseRun(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.SHELL:
 			node := p.parseShell(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.STOPSIGNAL:
 			node := p.parseStop(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.USER:
 			node := p.parseUser(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.WORKDIR:
 			node := p.parseWorkdir(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.VOLUME:
 			node := p.parseVolume(t)
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		case token.PARSER_DIRECTIVE:
 			key, value := util.ParseAssign(t.Content)
+			key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
 			localRoot.ParserMetadata[key] = value
+			if key == "escape" && (value == "`" || value == "\\") {
+				p.escape = value[0]
+			}
+			localRoot.Raw = append(localRoot.Raw, t.Raw...)
 		case token.COMMENT:
 			node := &ast.CommentInstructionNode{Text: t.Content}
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
+		case token.ILLEGAL:
+			// The lexer already reported this instruction -> keep it in place without reporting again
+			node := &ast.UnknownInstructionNode{Text: t.Content}
+			appendInstruction(localRoot, node, t)
 		case token.EMPTY_LINE:
 			node := &ast.EmptyLineNode{}
-			localRoot.Instructions = append(localRoot.Instructions, node)
+			appendInstruction(localRoot, node, t)
 		default:
-			fmt.Printf("Not implemented kind %d", t.Kind)
+			p.report(t, diagnostic.Error, diagnostic.UnknownToken, fmt.Sprintf("Token kind %d is not supported by the parser", t.Kind))
 		}
 		p.currentTokenIndex += 1
 	}
-	return p.rootNode
+	// References can only be resolved once all stages are known (e.g. COPY --from=<index>)
+	p.rootNode.RelinkReferences()
+	ast.Snapshot(p.rootNode)
+	return p.rootNode, p.diagnostics.Err()
 }
 
-func (p Parser) parseFrom(t token.Token) *ast.StageNode {
-	if !(strings.Contains(t.Content, " AS ") || strings.Contains(t.Content, " as ")) {
-		return &ast.StageNode{
-			Identifier:     ast.GenerateStageNodeID(),
-			Image:          t.Content,
-			ParserMetadata: make(map[string]string),
-		}
+// Diagnostics collected while parsing
+func (p Parser) Diagnostics() diagnostic.List {
+	return p.diagnostics
+}
+
+func (p *Parser) report(t token.Token, severity diagnostic.Severity, code, message string) {
+	p.diagnostics = append(p.diagnostics, diagnostic.FromToken(t, severity, code, message))
+}
+
+func convertHeredocs(heredocs []token.Heredoc) []ast.Heredoc {
+	if len(heredocs) == 0 {
+		return nil
+	}
+	res := make([]ast.Heredoc, len(heredocs))
+	for i, h := range heredocs {
+		res[i] = ast.Heredoc{Name: h.Name, Body: h.Body, Expand: h.Expand, StripTabs: h.StripTabs}
+	}
+	return res
+}
+
+// Split the paths of COPY and ADD into sources and destination
+func (p *Parser) splitPaths(t token.Token) ([]string, string) {
+	paths := CleanSlice(parsePossibleArray(t.Content))
+	if len(paths) < 2 {
+		p.report(t, diagnostic.Error, diagnostic.MissingArgument, fmt.Sprintf("%s requires at least one source and a destination", token.KindName(t.Kind)))
 	}
-	content := parsePossibleArray(t.Content)
-	image := content[0]
-	// as := content[1]
-	name := strings.Join(content[2:], " ")
-	return &ast.StageNode{
+	if len(paths) == 0 {
+		return []string{}, ""
+	}
+	return paths[:len(paths)-1], paths[len(paths)-1]
+}
+
+// Append instruction to the stage and extend the source range covered by the stage
+func appendInstruction(stage *ast.StageNode, node ast.InstructionNode, t token.Token) {
+	node.Info().StartPos = t.Start
+	node.Info().EndPos = t.End
+	node.Info().Comments = t.Comments
+	node.Info().Raw = t.Raw
+	stage.Instructions = append(stage.Instructions, node)
+	// Root stage has no FROM instruction marking its start
+	if stage.StartPos == (token.Position{}) {
+		stage.StartPos = t.Start
+	}
+	stage.EndPos = t.End
+}
+
+func (p *Parser) parseFrom(t token.Token) *ast.StageNode {
+	node := &ast.StageNode{
 		Identifier:     ast.GenerateStageNodeID(),
-		Name:           name,
-		Image:          image,
+		Platform:       util.GetFromParamsWithDefault(t.Params, "platform", []string{""})[0],
 		ParserMetadata: make(map[string]string),
 	}
+	content := strings.Fields(t.Content)
+	if len(content) == 0 {
+		p.report(t, diagnostic.Error, diagnostic.MissingArgument, "FROM requires an image")
+		return node
+	}
+	node.Image = content[0]
+	node.Reference = ast.ParseReference(node.Image)
+	if len(content) > 2 && strings.EqualFold(content[1], "as") {
+		node.Name = strings.Join(content[2:], " ")
+	}
+	return node
+}
+
+// Flags supported by COPY and ADD, see https://docs.docker.com/reference/dockerfile/#add
+var (
+	addFlags  = []string{"keep-git-dir", "checksum", "chown", "chmod", "link", "exclude"}
+	copyFlags = []string{"from", "chown", "chmod", "link", "parents", "exclude"}
+	// Flags of HEALTHCHECK in the order they are reconstructed
+	healthcheckFlags = []string{"interval", "timeout", "start-period", "start-interval", "retries"}
+)
+
+// Flags of the token that are not part of the known flags as written
+func (p *Parser) unknownFlags(t token.Token, known []string) []string {
+	var unknown []string
+	for _, flag := range t.Flags {
+		name, _, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if slices.Contains(known, name) {
+			continue
+		}
+		p.report(t, diagnostic.Warning, diagnostic.UnknownFlag, fmt.Sprintf("Unknown flag %s for %s", flag, token.KindName(t.Kind)))
+		unknown = append(unknown, flag)
+	}
+	return unknown
+}
+
+// Pairs of ENV and LABEL in the order they were written and whether the legacy KEY value form was used
+// Words without = are reported as docker rejects them
+func (p *Parser) parseKeyValues(t token.Token) (map[string]string, []string, bool) {
+	name := token.KindName(t.Kind)
+	assigns, legacy := util.ParseKeyValues(t.Content, p.escape)
+	if len(assigns) == 0 {
+		p.report(t, diagnostic.Error, diagnostic.MissingArgument, fmt.Sprintf("%s requires at least one argument", name))
+	}
+	for _, a := range assigns {
+		if a.HasValue {
+			continue
+		}
+		if legacy {
+			p.report(t, diagnostic.Error, diagnostic.MissingArgument, fmt.Sprintf("%s %s requires a value", name, a.Key))
+		} else {
+			p.report(t, diagnostic.Error, diagnostic.InvalidAssignment, fmt.Sprintf("Missing = in %q, %s must be of the form KEY=value", a.Key, name))
+		}
+	}
+	// LABEL keys may be quoted like their values (e.g. "com.example.vendor"=ACME), the key is stored unquoted
+	if t.Kind == token.LABEL {
+		for i := range assigns {
+			assigns[i].Key = expand.Unquote(assigns[i].Key, p.escape)
+		}
+	}
+	pairs, order := collectAssigns(assigns)
+	return pairs, order, legacy
 }
 
-func (p Parser) parseAdd(t token.Token) ast.InstructionNode {
-	paths := parsePossibleArray(t.Content)
-	cleanedPaths := CleanSlice(paths)
+func (p *Parser) parseAdd(t token.Token) ast.InstructionNode {
+	source, destination := p.splitPaths(t)
 	return &ast.AddInstructionNode{
-		Source:      cleanedPaths[0 : len(cleanedPaths)-1],
-		Destination: cleanedPaths[len(cleanedPaths)-1],
-		KeepGitDir:  util.GetFromParamsWithDefault(t.Params, "keep-git-dir", []string{"false"})[0] == "true",
-		CheckSum:    util.GetFromParamsWithDefault(t.Params, "checksum", []string{""})[0],
-		Chown:       util.GetFromParamsWithDefault(t.Params, "chown", []string{""})[0],
-		Chmod:       util.GetFromParamsWithDefault(t.Params, "chmod", []string{""})[0],
-		Link:        util.GetFromParamsWithDefault(t.Params, "link", []string{"false"})[0] == "true",
-		Exclude:     util.GetFromParamsWithDefault(t.Params, "exclude", []string{""})[0],
+		Source:       source,
+		Destination:  destination,
+		KeepGitDir:   util.GetFromParamsWithDefault(t.Params, "keep-git-dir", []string{"false"})[0] == "true",
+		CheckSum:     util.GetFromParamsWithDefault(t.Params, "checksum", []string{""})[0],
+		Chown:        util.GetFromParamsWithDefault(t.Params, "chown", []string{""})[0],
+		Chmod:        util.GetFromParamsWithDefault(t.Params, "chmod", []string{""})[0],
+		Link:         util.GetFromParamsWithDefault(t.Params, "link", []string{"false"})[0] == "true",
+		Exclude:      t.Params["exclude"],
+		UnknownFlags: p.unknownFlags(t, addFlags),
+		Heredocs:     convertHeredocs(t.Heredocs),
 	}
 }
 
-func (p Parser) parseArg(t token.Token) ast.InstructionNode {
-	pairs := util.ParseAssigns(t.Content)
-	if len(pairs) == 0 {
-		pairs[t.Content] = ""
+func (p *Parser) parseArg(t token.Token) ast.InstructionNode {
+	assigns := util.ParseNameValues(t.Content, p.escape)
+	if len(assigns) == 0 {
+		p.report(t, diagnostic.Error, diagnostic.MissingArgument, "ARG requires at least one argument")
 	}
+	pairs, order := collectAssigns(assigns)
 	return &ast.ArgInstructionNode{
 		Pairs: pairs,
+		Order: order,
 	}
 }
 
-func (p Parser) parseCmd(t token.Token) ast.InstructionNode {
+func (p *Parser) parseCmd(t token.Token) ast.InstructionNode {
+	cmd, shellForm := parseCommand(t.Content)
 	return &ast.CmdInstructionNode{
-		Cmd: parsePossibleArray(t.Content),
+		Cmd:          cmd,
+		ShellForm:    shellForm,
+		ShellCommand: shellCommand(t.Content, shellForm),
 	}
 }
 
-func (p Parser) parseCopy(t token.Token) ast.InstructionNode {
-	if len(t.MultiLineContent) != 0 {
-		fmt.Print("Heredoc copy statements are not parsed in the current version")
-		return &ast.CopyInstructionNode{IsHereDoc: true}
-	}
-	paths := parsePossibleArray(t.Content)
-	cleanedPaths := CleanSlice(paths)
+func (p *Parser) parseCopy(t token.Token) ast.InstructionNode {
+	source, destination := p.splitPaths(t)
 
 	return &ast.CopyInstructionNode{
-		Source:      cleanedPaths[0 : len(cleanedPaths)-1],
-		Destination: cleanedPaths[len(cleanedPaths)-1],
-		KeepGitDir:  util.GetFromParamsWithDefault(t.Params, "keep-git-dir", []string{"false"})[0] == "true",
-		Chown:       util.GetFromParamsWithDefault(t.Params, "chown", []string{""})[0],
-		Link:        util.GetFromParamsWithDefault(t.Params, "link", []string{"false"})[0] == "true",
-		From:        util.GetFromParamsWithDefault(t.Params, "from", []string{""})[0],
+		Source:       source,
+		Destination:  destination,
+		Chown:        util.GetFromParamsWithDefault(t.Params, "chown", []string{""})[0],
+		Chmod:        util.GetFromParamsWithDefault(t.Params, "chmod", []string{""})[0],
+		Link:         util.GetFromParamsWithDefault(t.Params, "link", []string{"false"})[0] == "true",
+		Parents:      util.GetFromParamsWithDefault(t.Params, "parents", []string{"false"})[0] == "true",
+		From:         util.GetFromParamsWithDefault(t.Params, "from", []string{""})[0],
+		Exclude:      t.Params["exclude"],
+		UnknownFlags: p.unknownFlags(t, copyFlags),
+		IsHereDoc:    len(t.Heredocs) != 0,
+		Heredocs:     convertHeredocs(t.Heredocs),
 	}
 }
 
-func (p Parser) parseEntryPoint(t token.Token) ast.InstructionNode {
+func (p *Parser) parseEntryPoint(t token.Token) ast.InstructionNode {
+	exec, shellForm := parseCommand(t.Content)
 	return &ast.EntrypointInstructionNode{
-		Exec: parsePossibleArray(t.Content),
+		Exec:         exec,
+		ShellForm:    shellForm,
+		ShellCommand: shellCommand(t.Content, shellForm),
 	}
 }
 
-func (p Parser) parseEnv(t token.Token) ast.InstructionNode {
+func (p *Parser) parseEnv(t token.Token) ast.InstructionNode {
+	pairs, order, legacy := p.parseKeyValues(t)
 	return &ast.EnvInstructionNode{
-		Pairs: util.ParseAssigns(t.Content),
+		Pairs:  pairs,
+		Order:  order,
+		Legacy: legacy,
 	}
 }
 
-func (p Parser) parseExpose(t token.Token) ast.InstructionNode {
+func (p *Parser) parseExpose(t token.Token) ast.InstructionNode {
 	ports := []ast.PortInfo{}
 
 	parts := strings.Split(t.Content, " ")
@@ -209,13 +325,13 @@ func (p Parser) parseExpose(t token.Token) ast.InstructionNode {
 		if len(part) == 0 {
 			continue
 		}
-		isTcp := true
+		protocol := "tcp"
 		v := strings.Split(part, "/")
-		// protocol is present
+		// protocol is present, like docker it is lowercased
 		if len(v) > 1 {
-			isTcp = v[1] == "tcp"
+			protocol = strings.ToLower(v[1])
 		}
-		ports = append(ports, ast.PortInfo{Port: v[0], IsTCP: isTcp})
+		ports = append(ports, ast.PortInfo{Port: v[0], Protocol: protocol})
 	}
 
 	return &ast.ExposeInstructionNode{
@@ -223,89 +339,133 @@ func (p Parser) parseExpose(t token.Token) ast.InstructionNode {
 	}
 }
 
-func (p Parser) parseHealthCheck(t token.Token) ast.InstructionNode {
-	if t.Content == "NONE" {
+func (p *Parser) parseHealthCheck(t token.Token) ast.InstructionNode {
+	if strings.EqualFold(t.Content, "NONE") {
 		return &ast.HealthcheckInstructionNode{CancelStatement: true}
 	}
-	retries, _ := strconv.Atoi(util.GetFromParamsWithDefault(t.Params, "retries", []string{"3"})[0])
+	retries, _ := strconv.Atoi(util.GetFromParamsWithDefault(t.Params, "retries", []string{strconv.Itoa(ast.DefaultHealthcheckRetries)})[0])
+	var setFlags []string
+	for _, flag := range healthcheckFlags {
+		if _, ok := t.Params[flag]; ok {
+			setFlags = append(setFlags, flag)
+		}
+	}
+	content := strings.TrimSpace(t.Content)
+	if keyword, rest, _ := strings.Cut(content, " "); strings.EqualFold(keyword, "CMD") {
+		content = rest
+	}
+	cmd, shellForm := parseCommand(content)
 	return &ast.HealthcheckInstructionNode{
 		CancelStatement: false,
-		Interval:        util.GetFromParamsWithDefault(t.Params, "interval", []string{"30s"})[0],
-		Timeout:         util.GetFromParamsWithDefault(t.Params, "timeout", []string{"30s"})[0],
-		StartPeriod:     util.GetFromParamsWithDefault(t.Params, "start-period", []string{"0s"})[0],
-		StartInterval:   util.GetFromParamsWithDefault(t.Params, "start-interval", []string{"5s"})[0],
+		Interval:        util.GetFromParamsWithDefault(t.Params, "interval", []string{ast.DefaultHealthcheckInterval})[0],
+		Timeout:         util.GetFromParamsWithDefault(t.Params, "timeout", []string{ast.DefaultHealthcheckTimeout})[0],
+		StartPeriod:     util.GetFromParamsWithDefault(t.Params, "start-period", []string{ast.DefaultHealthcheckStartPeriod})[0],
+		StartInterval:   util.GetFromParamsWithDefault(t.Params, "start-interval", []string{ast.DefaultHealthcheckStartInterval})[0],
 		Retries:         retries,
-		Cmd:             parsePossibleArray(t.Content),
+		Cmd:             cmd,
+		ShellForm:       shellForm,
+		ShellCommand:    shellCommand(content, shellForm),
+		SetFlags:        setFlags,
 	}
 }
 
-func (p Parser) parseLabel(t token.Token) ast.InstructionNode {
+func (p *Parser) parseLabel(t token.Token) ast.InstructionNode {
+	pairs, order, legacy := p.parseKeyValues(t)
 	return &ast.LabelInstructionNode{
-		Pairs: util.ParseAssigns(t.Content),
+		Pairs:  pairs,
+		Order:  order,
+		Legacy: legacy,
 	}
 }
 
-func (p Parser) parseMaintainer(t token.Token) ast.InstructionNode {
+func (p *Parser) parseMaintainer(t token.Token) ast.InstructionNode {
 	return &ast.MaintainerInstructionNode{
 		Name: t.Content,
 	}
 }
 
-func (p Parser) parseOnBuild(t token.Token) ast.InstructionNode {
+func (p *Parser) parseOnBuild(t token.Token) ast.InstructionNode {
 	// Easiest way to do this is by simply running the instruction through the entire lexer -> parser process
-	l := lexer.NewFromInput([]string{t.Content})
+	// Heredoc bodies have to be passed along as they are not part of the content
+	input := []string{t.Content}
+	for _, h := range t.Heredocs {
+		if len(h.Body) != 0 {
+			input = append(input, strings.Split(strings.TrimSuffix(h.Body, "\n"), "\n")...)
+		}
+		input = append(input, h.Name)
+	}
+	l := lexer.NewFromInput(input)
 	tokens, err := l.Lex()
 	if err != nil {
+		p.report(t, diagnostic.Error, diagnostic.InvalidOnbuild, fmt.Sprintf("Trigger of ONBUILD could not be lexed: %s", l.Diagnostics()[0].Message))
 		return &ast.OnbuildInstructionNode{
 			Trigger: &ast.UnknownInstructionNode{Text: t.Content},
 		}
 	}
 	tmpP := NewParser(tokens)
-	parsed := tmpP.Parse().Instructions[0]
+	root, _ := tmpP.Parse()
+	// The nested parser only knows positions relative to the ONBUILD content
+	for _, d := range tmpP.Diagnostics() {
+		p.report(t, d.Severity, d.Code, d.Message)
+	}
+	if len(root.Instructions) == 0 || root.Subsequent != nil {
+		p.report(t, diagnostic.Error, diagnostic.InvalidOnbuild, "ONBUILD requires a single instruction other than FROM as trigger")
+		return &ast.OnbuildInstructionNode{
+			Trigger: &ast.UnknownInstructionNode{Text: t.Content},
+		}
+	}
+	parsed := root.Instructions[0]
+	// The trigger was parsed on its own -> its positions are relative to the ONBUILD content
+	parsed.Info().StartPos = t.Start
+	parsed.Info().EndPos = t.End
+	// The original source of the trigger is part of the ONBUILD instruction
+	parsed.Info().Raw = nil
 	return &ast.OnbuildInstructionNode{
 		Trigger: parsed,
 	}
 }
 
-func (p Parser) parseRun(t token.Token) ast.InstructionNode {
-	var content []string
-	// We do nothing with heredoc except add it directly
-	if len(t.MultiLineContent) != 0 {
-		content = t.MultiLineContent
-	} else {
-		content = parsePossibleArray(t.Content)
+func (p *Parser) parseRun(t token.Token) ast.InstructionNode {
+	cmd, shellForm := parseCommand(t.Content)
+	mounts := util.GetFromParamsWithDefault(t.Params, "mount", []string{})
+	for _, mount := range mounts {
+		if _, err := ast.ParseMount(mount); err != nil {
+			p.report(t, diagnostic.Error, diagnostic.InvalidMount, fmt.Sprintf("Invalid mount %q: %s", mount, err.Error()))
+		}
 	}
 	return &ast.RunInstructionNode{
-		Cmd:       content,
-		ShellForm: false,
-		IsHeredoc: len(t.MultiLineContent) > 0,
-		Device:    util.GetFromParamsWithDefault(t.Params, "device", []string{""})[0],
-		Security:  util.GetFromParamsWithDefault(t.Params, "security", []string{""})[0], // technically the default here is sandbox...but currently this parameter only exists in labs
-		Network:   util.GetFromParamsWithDefault(t.Params, "network", []string{""})[0],
-		Mount:     util.GetFromParamsWithDefault(t.Params, "mount", []string{}),
+		Cmd:          cmd,
+		ShellForm:    shellForm,
+		ShellCommand: shellCommand(t.Content, shellForm),
+		IsHeredoc:    len(t.Heredocs) > 0,
+		Heredocs:     convertHeredocs(t.Heredocs),
+		Device:       util.GetFromParamsWithDefault(t.Params, "device", []string{""})[0],
+		Security:     util.GetFromParamsWithDefault(t.Params, "security", []string{""})[0], // technically the default here is sandbox...but currently this parameter only exists in labs
+		Network:      util.GetFromParamsWithDefault(t.Params, "network", []string{""})[0],
+		Mount:        mounts,
 	}
 }
 
-func (p Parser) parseShell(t token.Token) ast.InstructionNode {
+func (p *Parser) parseShell(t token.Token) ast.InstructionNode {
 	return &ast.ShellInstructionNode{
 		Shell: parsePossibleArray(t.Content),
 	}
 }
 
-func (p Parser) parseStop(t token.Token) ast.InstructionNode {
+func (p *Parser) parseStop(t token.Token) ast.InstructionNode {
 	return &ast.StopsignalInstructionNode{
 		Signal: t.Content,
 	}
 }
 
-func (p Parser) parseUser(t token.Token) ast.InstructionNode {
+func (p *Parser) parseUser(t token.Token) ast.InstructionNode {
 	return &ast.UserInstructionNode{User: t.Content}
 }
 
-func (p Parser) parseVolume(t token.Token) ast.InstructionNode {
+func (p *Parser) parseVolume(t token.Token) ast.InstructionNode {
 	return &ast.VolumeInstructionNode{Mounts: parsePossibleArray(t.Content)}
 }
 
-func (p Parser) parseWorkdir(t token.Token) ast.InstructionNode {
+func (p *Parser) parseWorkdir(t token.Token) ast.InstructionNode {
 	return &ast.WorkdirInstructionNode{Path: strings.TrimSpace(t.Content)}
 }
@@ -7,6 +7,7 @@ import (
 
 	testdata "github.com/coffeemakingtoaster/dockerfile-parser/internal/pkg/test_data"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/ast"
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/diagnostic"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/lexer"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/parser"
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/token"
@@ -77,8 +78,8 @@ func compareAddInstructionNode(expected, actual *ast.AddInstructionNode) string
 	if expected.Chown != actual.Chown {
 		return fmt.Sprintf("ADD instruction chown param mismatch: Expected %s Got %s", expected.Chown, actual.Chown)
 	}
-	if expected.Exclude != actual.Exclude {
-		return fmt.Sprintf("ADD instruction exclude param mismatch: Expected %s Got %s", expected.Exclude, actual.Exclude)
+	if !reflect.DeepEqual(expected.Exclude, actual.Exclude) {
+		return fmt.Sprintf("ADD instruction exclude param mismatch: Expected %v Got %v", expected.Exclude, actual.Exclude)
 	}
 	if expected.Destination != actual.Destination {
 		return fmt.Sprintf("ADD instruction destination mismatch: Expected %s Got %s", expected.Destination, actual.Destination)
@@ -93,12 +94,18 @@ func compareCopyInstructionNode(expected, actual *ast.CopyInstructionNode) strin
 	if expected.Link != actual.Link {
 		return fmt.Sprintf("COPY instruction link param mismatch: Expected %v Got %v", expected.Link, actual.Link)
 	}
-	if expected.KeepGitDir != actual.KeepGitDir {
-		return fmt.Sprintf("COPY instruction keep git dir param mismatch: Expected %v Got %v", expected.KeepGitDir, actual.KeepGitDir)
-	}
 	if expected.Chown != actual.Chown {
 		return fmt.Sprintf("COPY instruction chown param mismatch: Expected %s Got %s", expected.Chown, actual.Chown)
 	}
+	if expected.Chmod != actual.Chmod {
+		return fmt.Sprintf("COPY instruction chmod param mismatch: Expected %s Got %s", expected.Chmod, actual.Chmod)
+	}
+	if expected.Parents != actual.Parents {
+		return fmt.Sprintf("COPY instruction parents param mismatch: Expected %v Got %v", expected.Parents, actual.Parents)
+	}
+	if !reflect.DeepEqual(expected.Exclude, actual.Exclude) {
+		return fmt.Sprintf("COPY instruction exclude param mismatch: Expected %v Got %v", expected.Exclude, actual.Exclude)
+	}
 	if expected.Destination != actual.Destination {
 		return fmt.Sprintf("COPY instruction destination mismatch: Expected %s Got %s", expected.Destination, actual.Destination)
 	}
@@ -123,6 +130,9 @@ func compareInstructionNode(expected, actual ast.InstructionNode) string {
 		if !reflect.DeepEqual(expected.(*ast.CmdInstructionNode).Cmd, ac.Cmd) {
 			return fmt.Sprintf("CMD instruction command mismatch: Expected %v Got %v", expected.(*ast.CmdInstructionNode).Cmd, ac.Cmd)
 		}
+		if expected.(*ast.CmdInstructionNode).ShellCommand != ac.ShellCommand {
+			return fmt.Sprintf("CMD instruction shell command mismatch: Expected %v Got %v", expected.(*ast.CmdInstructionNode).ShellCommand, ac.ShellCommand)
+		}
 	case *ast.CopyInstructionNode:
 		return compareCopyInstructionNode(expected.(*ast.CopyInstructionNode), ac)
 	case *ast.CommentInstructionNode:
@@ -133,6 +143,9 @@ func compareInstructionNode(expected, actual ast.InstructionNode) string {
 		if !reflect.DeepEqual(expected.(*ast.EntrypointInstructionNode).Exec, ac.Exec) {
 			return fmt.Sprintf("ENTRYPOINT instruction command mismatch: Expected %v Got %v", expected.(*ast.EntrypointInstructionNode).Exec, ac.Exec)
 		}
+		if expected.(*ast.EntrypointInstructionNode).ShellCommand != ac.ShellCommand {
+			return fmt.Sprintf("ENTRYPOINT instruction shell command mismatch: Expected %v Got %v", expected.(*ast.EntrypointInstructionNode).ShellCommand, ac.ShellCommand)
+		}
 	case *ast.EnvInstructionNode:
 		if !reflect.DeepEqual(expected.(*ast.EnvInstructionNode).Pairs, ac.Pairs) {
 			return fmt.Sprintf("ENV instruction command mismatch: Expected %v Got %v", expected.(*ast.EnvInstructionNode).Pairs, ac.Pairs)
@@ -150,7 +163,7 @@ func compareInstructionNode(expected, actual ast.InstructionNode) string {
 			return fmt.Sprintf("LABEL instruction mismatch: Expected %v Got %v", expected, ac)
 		}
 	case *ast.MaintainerInstructionNode:
-		if *expected.(*ast.MaintainerInstructionNode) != *ac {
+		if !reflect.DeepEqual(expected.(*ast.MaintainerInstructionNode), ac) {
 			return fmt.Sprintf("MAINTAINER instruction mismatch: Expected %v Got %v", expected, ac)
 		}
 	case *ast.RunInstructionNode:
@@ -247,10 +260,11 @@ func TestFromParsing(t *testing.T) {
 				},
 			},
 			Expected: &ast.StageNode{
-				Name:           "base",
-				Image:          "alpine:latest",
-				Identifier:     "base-identifier",
-				ParserMetadata: map[string]string{"syntax": "docker/dockerfile:1"},
+				Name:            "base",
+				Image:           "alpine:latest",
+				Identifier:      "base-identifier",
+				ReferencedByIds: []string{"next-identifier"},
+				ParserMetadata:  map[string]string{"syntax": "docker/dockerfile:1"},
 				Subsequent: &ast.StageNode{
 					Name:       "padding",
 					Image:      "alpine:padding",
@@ -271,16 +285,25 @@ func TestFromParsing(t *testing.T) {
 	}
 	for _, c := range testCases {
 		p := parser.NewParser(c.Input)
-		actual := p.Parse()
+		actual, err := p.Parse()
+		if err != nil {
+			t.Fatalf("Parsing failed: %s", err.Error())
+		}
 		curr := actual.Subsequent
 		// overwrite generated ids with predictable ids
+		ids := make(map[string]string)
 		for curr != nil {
-			curr.Identifier = fmt.Sprintf("%s-identifier", curr.Name)
+			ids[curr.Identifier] = fmt.Sprintf("%s-identifier", curr.Name)
+			curr.Identifier = ids[curr.Identifier]
 			curr = curr.Subsequent
 		}
+		for curr = actual.Subsequent; curr != nil; curr = curr.Subsequent {
+			for i, id := range curr.ReferencedByIds {
+				curr.ReferencedByIds[i] = ids[id]
+			}
+		}
 		// Pass first in because there is no need to compare the rootnode
-		err := compareStageNodes(*c.Expected, *actual.Subsequent)
-		if err != "" {
+		if err := compareStageNodes(*c.Expected, *actual.Subsequent); err != "" {
 			t.Error(err)
 		}
 	}
@@ -303,7 +326,7 @@ func TestInstructionParsing(t *testing.T) {
 				Chown:       "",
 				Chmod:       "",
 				Link:        false,
-				Exclude:     "",
+				Exclude:     nil,
 			}},
 		},
 		{
@@ -336,7 +359,8 @@ func TestInstructionParsing(t *testing.T) {
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.CmdInstructionNode{
-				Cmd: []string{"echo", "hello", "testing"},
+				ShellForm:    true,
+				ShellCommand: "echo hello testing",
 			}},
 		},
 		{
@@ -349,7 +373,6 @@ func TestInstructionParsing(t *testing.T) {
 			Expected: []ast.InstructionNode{&ast.CopyInstructionNode{
 				Source:      []string{"./source1", "./source2"},
 				Destination: "../../dest",
-				KeepGitDir:  false,
 				Chown:       "",
 				Link:        false,
 			}},
@@ -364,7 +387,6 @@ func TestInstructionParsing(t *testing.T) {
 			Expected: []ast.InstructionNode{&ast.CopyInstructionNode{
 				Source:      []string{"./source1", "./source2"},
 				Destination: "../../dest",
-				KeepGitDir:  false,
 				Chown:       "",
 				Link:        false,
 			}},
@@ -378,7 +400,8 @@ func TestInstructionParsing(t *testing.T) {
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.EntrypointInstructionNode{
-				Exec: []string{"cp", "./source1", "./source2", "../../dest"},
+				ShellForm:    true,
+				ShellCommand: "cp ./source1 ./source2 ../../dest",
 			}},
 		},
 		{
@@ -415,8 +438,8 @@ func TestInstructionParsing(t *testing.T) {
 			},
 			Expected: []ast.InstructionNode{&ast.ExposeInstructionNode{
 				Ports: []ast.PortInfo{{
-					Port:  "3100",
-					IsTCP: false,
+					Port:     "3100",
+					Protocol: "udp",
 				}},
 			},
 			},
@@ -430,8 +453,8 @@ func TestInstructionParsing(t *testing.T) {
 			},
 			Expected: []ast.InstructionNode{&ast.ExposeInstructionNode{
 				Ports: []ast.PortInfo{{
-					Port:  "5000",
-					IsTCP: true,
+					Port:     "5000",
+					Protocol: "tcp",
 				}},
 			},
 			},
@@ -446,12 +469,12 @@ func TestInstructionParsing(t *testing.T) {
 			Expected: []ast.InstructionNode{&ast.ExposeInstructionNode{
 				Ports: []ast.PortInfo{
 					{
-						Port:  "5000",
-						IsTCP: true,
+						Port:     "5000",
+						Protocol: "tcp",
 					},
 					{
-						Port:  "3000",
-						IsTCP: false,
+						Port:     "3000",
+						Protocol: "udp",
 					},
 				},
 			},
@@ -465,7 +488,8 @@ func TestInstructionParsing(t *testing.T) {
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.HealthcheckInstructionNode{
-				Cmd:             []string{"cp", "test1", "test2"},
+				ShellForm:       true,
+				ShellCommand:    "cp test1 test2",
 				CancelStatement: false,
 				Interval:        "30s",
 				Timeout:         "30s",
@@ -485,6 +509,17 @@ func TestInstructionParsing(t *testing.T) {
 				CancelStatement: true,
 			}},
 		},
+		{
+			Input: []token.Token{
+				{
+					Kind:    token.HEALTHCHECK,
+					Content: "none",
+				},
+			},
+			Expected: []ast.InstructionNode{&ast.HealthcheckInstructionNode{
+				CancelStatement: true,
+			}},
+		},
 		{
 			Input: []token.Token{
 				{
@@ -494,6 +529,7 @@ func TestInstructionParsing(t *testing.T) {
 			},
 			Expected: []ast.InstructionNode{&ast.LabelInstructionNode{
 				Pairs: map[string]string{"A": "B"},
+				Order: []string{"A"},
 			}},
 		},
 		{
@@ -518,12 +554,12 @@ func TestInstructionParsing(t *testing.T) {
 				Trigger: &ast.ExposeInstructionNode{
 					Ports: []ast.PortInfo{
 						{
-							Port:  "5000",
-							IsTCP: true,
+							Port:     "5000",
+							Protocol: "tcp",
 						},
 						{
-							Port:  "3000",
-							IsTCP: false,
+							Port:     "3000",
+							Protocol: "udp",
 						},
 					},
 				}}},
@@ -536,13 +572,13 @@ func TestInstructionParsing(t *testing.T) {
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.RunInstructionNode{
-				Cmd:       []string{"cp", "./a", "./b"},
-				ShellForm: false,
-				IsHeredoc: false,
-				Mount:     []string{},
-				Network:   "",
-				Security:  "",
-				Device:    "",
+				ShellForm:    true,
+				ShellCommand: "cp ./a ./b",
+				IsHeredoc:    false,
+				Mount:        []string{},
+				Network:      "",
+				Security:     "",
+				Device:       "",
 			}},
 		},
 		{
@@ -553,39 +589,43 @@ func TestInstructionParsing(t *testing.T) {
 					Params: map[string][]string{
 						"security": {"sandbox"},
 						"device":   {"gpu"},
-						"mount":    {"test1", "test2"},
+						"mount":    {"type=cache,target=/test1", "type=tmpfs,target=/test2"},
 						"network":  {"nono"},
 					},
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.RunInstructionNode{
-				Cmd:       []string{"cp", "./a", "./b"},
-				ShellForm: false,
-				IsHeredoc: false,
-				Mount:     []string{"test1", "test2"},
-				Network:   "nono",
-				Security:  "sandbox",
-				Device:    "gpu",
+				ShellForm:    true,
+				ShellCommand: "cp ./a ./b",
+				IsHeredoc:    false,
+				Mount:        []string{"type=cache,target=/test1", "type=tmpfs,target=/test2"},
+				Network:      "nono",
+				Security:     "sandbox",
+				Device:       "gpu",
 			}},
 		},
 
 		{
 			Input: []token.Token{
 				{
-					Kind:               token.RUN,
-					Content:            "",
-					MultiLineContent:   []string{"EOT bash", "set -ex", "apt-get update", "apt-get install -y vim", "EOT"},
-					HereDocRedirection: false,
+					Kind:    token.RUN,
+					Content: "<<EOT bash",
+					Heredocs: []token.Heredoc{
+						{Name: "EOT", Body: "set -ex\napt-get update\napt-get install -y vim\n", Expand: true},
+					},
 				},
 			},
 			Expected: []ast.InstructionNode{&ast.RunInstructionNode{
-				Cmd:       []string{"EOT bash", "set -ex", "apt-get update", "apt-get install -y vim", "EOT"},
-				ShellForm: false,
-				IsHeredoc: true,
-				Mount:     []string{},
-				Network:   "",
-				Security:  "",
-				Device:    "",
+				ShellForm:    true,
+				ShellCommand: "<<EOT bash",
+				IsHeredoc:    true,
+				Heredocs: []ast.Heredoc{
+					{Name: "EOT", Body: "set -ex\napt-get update\napt-get install -y vim\n", Expand: true},
+				},
+				Mount:    []string{},
+				Network:  "",
+				Security: "",
+				Device:   "",
 			}},
 		},
 		{
@@ -674,7 +714,11 @@ func TestInstructionParsing(t *testing.T) {
 	}
 	for _, c := range testCases {
 		p := parser.NewParser(c.Input)
-		instructions := p.Parse().Instructions
+		root, err := p.Parse()
+		if err != nil {
+			t.Fatalf("Parsing failed: %s", err.Error())
+		}
+		instructions := root.Instructions
 		if len(instructions) != len(c.Expected) {
 			t.Errorf("Instruction count mismatch: Expected %d Got %d", len(c.Expected), len(instructions))
 		}
@@ -687,6 +731,163 @@ func TestInstructionParsing(t *testing.T) {
 	}
 }
 
+func TestNodePositions(t *testing.T) {
+	input := []string{
+		"ARG VERSION=1",
+		"FROM alpine AS base",
+		"RUN echo a \\",
+		"  echo b",
+		"ONBUILD USER root",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+
+	expectations := []struct {
+		Node  ast.Node
+		Start token.Position
+		End   token.Position
+	}{
+		{root, token.Position{Line: 1, Column: 1}, token.Position{Line: 1, Column: 14}},
+		{root.Instructions[0], token.Position{Line: 1, Column: 1}, token.Position{Line: 1, Column: 14}},
+		{root.Subsequent, token.Position{Line: 2, Column: 1}, token.Position{Line: 5, Column: 18}},
+		{root.Subsequent.Instructions[0], token.Position{Line: 3, Column: 1}, token.Position{Line: 4, Column: 9}},
+		{root.Subsequent.Instructions[1], token.Position{Line: 5, Column: 1}, token.Position{Line: 5, Column: 18}},
+		{root.Subsequent.Instructions[1].(*ast.OnbuildInstructionNode).Trigger, token.Position{Line: 5, Column: 1}, token.Position{Line: 5, Column: 18}},
+	}
+	for _, e := range expectations {
+		if e.Node.Pos() != e.Start || e.Node.End() != e.End {
+			t.Errorf("Node position mismatch (%s): Expected %v-%v Got %v-%v", e.Node.Instruction(), e.Start, e.End, e.Node.Pos(), e.Node.End())
+		}
+	}
+}
+
+func TestHeredocParsing(t *testing.T) {
+	input := []string{
+		"FROM alpine",
+		"COPY --chown=app <<-\"A\" <<B /dest/",
+		"\tfile $a",
+		"\tA",
+		"file b",
+		"B",
+		"ONBUILD RUN <<EOF",
+		"echo hi",
+		"EOF",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	copyNode := root.Subsequent.Instructions[0].(*ast.CopyInstructionNode)
+	expectedHeredocs := []ast.Heredoc{
+		{Name: "A", Body: "\tfile $a\n", Expand: false, StripTabs: true},
+		{Name: "B", Body: "file b\n", Expand: true},
+	}
+	if !reflect.DeepEqual(expectedHeredocs, copyNode.Heredocs) {
+		t.Errorf("COPY heredoc mismatch: Expected %+v Got %+v", expectedHeredocs, copyNode.Heredocs)
+	}
+	if copyNode.Heredocs[0].Content() != "file $a\n" {
+		t.Errorf("Heredoc content mismatch: Expected %q Got %q", "file $a\n", copyNode.Heredocs[0].Content())
+	}
+	if !reflect.DeepEqual(copyNode.Source, []string{"<<-\"A\"", "<<B"}) || copyNode.Destination != "/dest/" || !copyNode.IsHereDoc {
+		t.Errorf("COPY paths mismatch: Got %v -> %s", copyNode.Source, copyNode.Destination)
+	}
+	trigger := root.Subsequent.Instructions[1].(*ast.OnbuildInstructionNode).Trigger.(*ast.RunInstructionNode)
+	if len(trigger.Heredocs) != 1 || trigger.Heredocs[0].Body != "echo hi\n" {
+		t.Errorf("ONBUILD heredoc mismatch: Got %+v", trigger.Heredocs)
+	}
+	expectedReconstruct := []string{"FROM alpine", "COPY --chown=app <<-\"A\" <<B /dest/", "\tfile $a", "A", "file b", "B", "ONBUILD RUN <<EOF", "echo hi", "EOF"}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expectedReconstruct, actual) {
+		t.Errorf("Heredoc reconstruct mismatch: Expected %+q Got %+q", expectedReconstruct, actual)
+	}
+}
+
+func TestContinuationCommentParsing(t *testing.T) {
+	input := []string{
+		"FROM alpine AS base",
+		"RUN apt-get update && \\",
+		"  # install vim",
+		"  apt-get install -y vim",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	run := root.Subsequent.Instructions[0]
+	if !reflect.DeepEqual([]string{" install vim"}, run.Info().Comments) {
+		t.Errorf("Continuation comment mismatch: Got %+q", run.Info().Comments)
+	}
+	expected := []string{"FROM alpine AS base", "# install vim", "RUN apt-get update && apt-get install -y vim"}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	input := []token.Token{
+		baseImageLine,
+		{
+			Kind:    token.ADD,
+			Content: "./only-destination",
+			Start:   token.Position{Line: 2, Column: 1},
+			End:     token.Position{Line: 2, Column: 23},
+		},
+		{
+			Kind:    token.ONBUILD,
+			Content: "FROM alpine",
+		},
+	}
+	p := parser.NewParser(input)
+	root, err := p.Parse()
+	if err == nil {
+		t.Fatalf("Expected parsing to fail")
+	}
+	if root == nil || len(root.Subsequent.Instructions) != 2 {
+		t.Fatalf("Expected ast to be returned despite errors")
+	}
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Diagnostic count mismatch: Expected %d Got %d (%v)", 2, len(diagnostics), diagnostics)
+	}
+	if diagnostics[0].Code != diagnostic.MissingArgument || diagnostics[0].Start != input[1].Start {
+		t.Errorf("Diagnostic mismatch: Got %v", diagnostics[0])
+	}
+	if diagnostics[1].Code != diagnostic.InvalidOnbuild {
+		t.Errorf("Diagnostic mismatch: Got %v", diagnostics[1])
+	}
+}
+
+func TestIllegalTokenParsing(t *testing.T) {
+	p := parser.NewParser([]token.Token{baseImageLine, {Kind: token.ILLEGAL, Content: "FORM alpine"}, {Kind: token.USER, Content: "root"}})
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	expected := []ast.InstructionNode{&ast.UnknownInstructionNode{Text: "FORM alpine"}, &ast.UserInstructionNode{User: "root"}}
+	if !reflect.DeepEqual(expected, root.Subsequent.Instructions) {
+		t.Errorf("Instruction mismatch: Expected %v Got %v", expected, root.Subsequent.Instructions)
+	}
+}
+
 func BenchmarkParser(b *testing.B) {
 	// Create these once
 	l := lexer.NewFromInput(testdata.SampleDockerfile)
@@ -699,3 +900,316 @@ func BenchmarkParser(b *testing.B) {
 		p.Parse()
 	}
 }
+
+func TestStageReferences(t *testing.T) {
+	input := []string{
+		"FROM alpine AS Base",
+		"FROM base AS build",
+		"RUN --mount=type=cache,from=0,target=/cache make",
+		"FROM scratch",
+		"COPY --from=BUILD /out /out",
+		"COPY --from=nginx:latest /etc/nginx /etc/nginx",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	stages := root.Stages()
+	expected := [][]string{{stages[1].Identifier}, {stages[2].Identifier}, nil}
+	for i, stage := range stages {
+		if !reflect.DeepEqual(expected[i], stage.ReferencedByIds) {
+			t.Errorf("Stage %d reference ids mismatch: Expected %v Got %v", i, expected[i], stage.ReferencedByIds)
+		}
+	}
+}
+
+func TestFromPlatformParsing(t *testing.T) {
+	input := []string{
+		"FROM --platform=$BUILDPLATFORM golang:1.22 As build",
+		"FROM Build",
+		"FROM ghcr.io/org/app@sha256:abc",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	stages := root.Stages()
+	if stages[0].Platform != "$BUILDPLATFORM" || stages[0].Image != "golang:1.22" || stages[0].Name != "build" {
+		t.Errorf("FROM mismatch: Got platform %s image %s name %s", stages[0].Platform, stages[0].Image, stages[0].Name)
+	}
+	expectedRef := ast.Reference{Registry: "docker.io", Repository: "library/golang", Tag: "1.22"}
+	if stages[0].Reference != expectedRef || stages[0].ImageIsStage {
+		t.Errorf("Reference mismatch: Expected %+v Got %+v", expectedRef, stages[0].Reference)
+	}
+	if !stages[1].ImageIsStage || stages[2].ImageIsStage {
+		t.Errorf("Stage image mismatch: Expected only the second stage to use a stage as image")
+	}
+	if stages[2].Reference.Digest != "sha256:abc" {
+		t.Errorf("Digest mismatch: Expected %s Got %s", "sha256:abc", stages[2].Reference.Digest)
+	}
+	expected := []string{"FROM --platform=$BUILDPLATFORM golang:1.22 AS build", "FROM Build", "FROM ghcr.io/org/app@sha256:abc"}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %v Got %v", expected, actual)
+	}
+}
+
+func TestCopyAddFlagParsing(t *testing.T) {
+	input := []string{
+		"FROM alpine",
+		"COPY --chmod=755 --parents --exclude=*.md --from=build --exclude=*.txt --keep-git-dir --frm=typo ./src /dest",
+		"ADD --checksum=sha256:abc --link --exclude=.git --exclude=docs --unpack=true https://example.com/a.tar /",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	copyNode := root.Subsequent.Instructions[0].(*ast.CopyInstructionNode)
+	if copyNode.Chmod != "755" || !copyNode.Parents || copyNode.From != "build" {
+		t.Errorf("COPY flag mismatch: Got chmod %s parents %v from %s", copyNode.Chmod, copyNode.Parents, copyNode.From)
+	}
+	if !reflect.DeepEqual([]string{"*.md", "*.txt"}, copyNode.Exclude) || !reflect.DeepEqual([]string{"--keep-git-dir", "--frm=typo"}, copyNode.UnknownFlags) {
+		t.Errorf("COPY repeated flag mismatch: Got exclude %v unknown %v", copyNode.Exclude, copyNode.UnknownFlags)
+	}
+	addNode := root.Subsequent.Instructions[1].(*ast.AddInstructionNode)
+	if addNode.CheckSum != "sha256:abc" || !addNode.Link || !reflect.DeepEqual([]string{".git", "docs"}, addNode.Exclude) || !reflect.DeepEqual([]string{"--unpack=true"}, addNode.UnknownFlags) {
+		t.Errorf("ADD flag mismatch: Got checksum %s exclude %v unknown %v", addNode.CheckSum, addNode.Exclude, addNode.UnknownFlags)
+	}
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 3 || diagnostics[0].Code != diagnostic.UnknownFlag || diagnostics[0].Severity != diagnostic.Warning || diagnostics[1].Start.Line != 2 || diagnostics[2].Start.Line != 3 {
+		t.Errorf("Diagnostic mismatch: Got %v", diagnostics)
+	}
+	expected := []string{
+		"FROM alpine",
+		"COPY --chmod=755 --parents --from=build --exclude=*.md --exclude=*.txt --keep-git-dir --frm=typo ./src /dest",
+		"ADD --checksum=sha256:abc --link --exclude=.git --exclude=docs --unpack=true https://example.com/a.tar /",
+	}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestCommandFormParsing(t *testing.T) {
+	input := []string{
+		"FROM alpine",
+		"RUN [\"sh\", \"-c\", \"echo \\\"a, b\\\"\"]",
+		"RUN [ -f a ] && cat a",
+		"CMD echo hi",
+		"ENTRYPOINT [\"/app\"]",
+		"HEALTHCHECK --interval=5s CMD curl -f http://localhost",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	instructions := root.Subsequent.Instructions
+	exec := instructions[0].(*ast.RunInstructionNode)
+	if exec.ShellForm || !reflect.DeepEqual([]string{"sh", "-c", "echo \"a, b\""}, exec.Cmd) {
+		t.Errorf("Exec form RUN mismatch: Got %q (shell form %v)", exec.Cmd, exec.ShellForm)
+	}
+	if shell := instructions[1].(*ast.RunInstructionNode); !shell.ShellForm || shell.ShellCommand != "[ -f a ] && cat a" {
+		t.Errorf("Shell form RUN mismatch: Got %q (shell form %v)", shell.ShellCommand, shell.ShellForm)
+	}
+	if cmd := instructions[2].(*ast.CmdInstructionNode); !cmd.ShellForm || cmd.ShellCommand != "echo hi" {
+		t.Errorf("CMD mismatch: Got %q (shell form %v)", cmd.ShellCommand, cmd.ShellForm)
+	}
+	if entrypoint := instructions[3].(*ast.EntrypointInstructionNode); entrypoint.ShellForm || !reflect.DeepEqual([]string{"/app"}, entrypoint.Exec) {
+		t.Errorf("ENTRYPOINT mismatch: Got %q (shell form %v)", entrypoint.Exec, entrypoint.ShellForm)
+	}
+	if healthcheck := instructions[4].(*ast.HealthcheckInstructionNode); !healthcheck.ShellForm || healthcheck.ShellCommand != "curl -f http://localhost" {
+		t.Errorf("HEALTHCHECK mismatch: Got %q (shell form %v)", healthcheck.ShellCommand, healthcheck.ShellForm)
+	}
+	expected := []string{
+		"FROM alpine",
+		"RUN [\"sh\",\"-c\",\"echo \\\"a, b\\\"\"]",
+		"RUN [ -f a ] && cat a",
+		"CMD echo hi",
+		"ENTRYPOINT [\"/app\"]",
+		"HEALTHCHECK --interval=5s CMD curl -f http://localhost",
+	}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestShellFormHash(t *testing.T) {
+	input := []string{
+		"FROM alpine",
+		"CMD echo a#b",
+		"RUN curl https://x/file#sha=1 && ls # list",
+		"ENTRYPOINT exec /app #flag",
+		"HEALTHCHECK CMD test -f /a#b",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	instructions := root.Subsequent.Instructions
+	if cmd := instructions[0].(*ast.CmdInstructionNode); cmd.ShellCommand != "echo a#b" {
+		t.Errorf("CMD mismatch: Expected %q Got %q", "echo a#b", cmd.ShellCommand)
+	}
+	if run := instructions[1].(*ast.RunInstructionNode); run.ShellCommand != "curl https://x/file#sha=1 && ls # list" {
+		t.Errorf("RUN mismatch: Expected %q Got %q", "curl https://x/file#sha=1 && ls # list", run.ShellCommand)
+	}
+	expected := []string{
+		"FROM alpine",
+		"CMD echo a#b",
+		"RUN curl https://x/file#sha=1 && ls # list",
+		"ENTRYPOINT exec /app #flag",
+		"HEALTHCHECK CMD test -f /a#b",
+	}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestKeyValueParsing(t *testing.T) {
+	input := []string{
+		"# escape=`",
+		"FROM alpine",
+		"ENV Z=1 A=\"x y\" B='it`s' C=a` b",
+		"ENV KEY some value with spaces",
+		"LABEL version=1 \"com.example.vendor\"=ACME 'my key'=`\"a` b`\"",
+		"ARG B A=1",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	instructions := root.Subsequent.Instructions
+	env := instructions[0].(*ast.EnvInstructionNode)
+	expectedPairs := map[string]string{"Z": "1", "A": "\"x y\"", "B": "'it`s'", "C": "a` b"}
+	if env.Legacy || !reflect.DeepEqual(expectedPairs, env.Pairs) || !reflect.DeepEqual([]string{"Z", "A", "B", "C"}, env.Order) {
+		t.Errorf("ENV mismatch: Got %v %v (legacy %v)", env.Pairs, env.Order, env.Legacy)
+	}
+	legacy := instructions[1].(*ast.EnvInstructionNode)
+	if !legacy.Legacy || !reflect.DeepEqual(map[string]string{"KEY": "some value with spaces"}, legacy.Pairs) {
+		t.Errorf("Legacy ENV mismatch: Got %v (legacy %v)", legacy.Pairs, legacy.Legacy)
+	}
+	label := instructions[2].(*ast.LabelInstructionNode)
+	if !reflect.DeepEqual([]string{"version", "com.example.vendor", "my key"}, label.Keys()) || label.Pairs["my key"] != "`\"a` b`\"" {
+		t.Errorf("LABEL mismatch: Got %q %q", label.Keys(), label.Pairs)
+	}
+	arg := instructions[3].(*ast.ArgInstructionNode)
+	if !reflect.DeepEqual(map[string]string{"B": "", "A": "1"}, arg.Pairs) || !reflect.DeepEqual([]string{"B", "A"}, arg.Keys()) {
+		t.Errorf("ARG mismatch: Got %v %v", arg.Pairs, arg.Keys())
+	}
+
+	env.Pairs["D"] = "4"
+	legacy.Pairs["KEY"] = "other value"
+	expected := []string{
+		"# escape=`",
+		"FROM alpine",
+		"ENV Z=1 A=\"x y\" B='it`s' C=a` b D=4",
+		"ENV KEY other value",
+		"LABEL version=1 com.example.vendor=ACME \"my key\"=`\"a` b`\"",
+		"ARG B= A=1",
+	}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", expected, actual)
+	}
+}
+
+func TestKeyValueHash(t *testing.T) {
+	input := []string{
+		"ARG REF=main#1",
+		"FROM alpine",
+		"ENV URL=http://x/#y LEGACY=\"# quoted\"",
+		"LABEL a=b#c",
+	}
+	l := lexer.NewFromInput(input)
+	tokens, err := l.Lex()
+	if err != nil {
+		t.Fatalf("Lexing failed: %s", err.Error())
+	}
+	p := parser.NewParser(tokens)
+	root, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parsing failed: %s", err.Error())
+	}
+	if arg := root.Instructions[0].(*ast.ArgInstructionNode); arg.Pairs["REF"] != "main#1" {
+		t.Errorf("ARG mismatch: Got %q", arg.Pairs)
+	}
+	expectedEnv := map[string]string{"URL": "http://x/#y", "LEGACY": "\"# quoted\""}
+	if env := root.Subsequent.Instructions[0].(*ast.EnvInstructionNode); !reflect.DeepEqual(expectedEnv, env.Pairs) {
+		t.Errorf("ENV mismatch: Expected %q Got %q", expectedEnv, env.Pairs)
+	}
+	if label := root.Subsequent.Instructions[1].(*ast.LabelInstructionNode); label.Pairs["a"] != "b#c" {
+		t.Errorf("LABEL mismatch: Got %q", label.Pairs)
+	}
+	if actual := root.Reconstruct(); !reflect.DeepEqual(input, actual) {
+		t.Errorf("Reconstruct mismatch: Expected %+q Got %+q", input, actual)
+	}
+}
+
+func TestKeyValueDiagnostics(t *testing.T) {
+	testCases := map[string]string{
+		"ENV A=1 B":   diagnostic.InvalidAssignment,
+		"LABEL A=1 B": diagnostic.InvalidAssignment,
+		"ENV KEY":     diagnostic.MissingArgument,
+		"LABEL KEY":   diagnostic.MissingArgument,
+	}
+	for line, code := range testCases {
+		l := lexer.NewFromInput([]string{"FROM alpine", line})
+		tokens, err := l.Lex()
+		if err != nil {
+			t.Fatalf("Lexing failed: %s", err.Error())
+		}
+		p := parser.NewParser(tokens)
+		if _, err := p.Parse(); err == nil {
+			t.Errorf("Expected parsing of %q to fail", line)
+		}
+		if diagnostics := p.Diagnostics(); len(diagnostics) != 1 || diagnostics[0].Code != code {
+			t.Errorf("Diagnostic mismatch for %q: Expected %s Got %v", line, code, diagnostics)
+		}
+	}
+}
+
+func TestMalformedArrayInstructions(t *testing.T) {
+	for _, line := range []string{"VOLUME [a,]", "VOLUME [,]", "VOLUME [", "SHELL [a,]", "COPY [,]", "ADD [a,]", "COPY ["} {
+		l := lexer.NewFromInput([]string{"FROM alpine", line})
+		tokens, err := l.Lex()
+		if err != nil {
+			t.Fatalf("Lexing %q failed: %s", line, err.Error())
+		}
+		p := parser.NewParser(tokens)
+		if root, _ := p.Parse(); root == nil || len(root.Subsequent.Instructions) != 1 {
+			t.Errorf("Expected %q to be parsed into a single instruction", line)
+		}
+	}
+}
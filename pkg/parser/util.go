@@ -1,43 +1,73 @@
 package parser
 
 import (
+	"encoding/json"
 	"strings"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
 )
 
+// Pairs and the order of their keys, a key assigned more than once keeps its first position and its last value
+func collectAssigns(assigns []util.Assign) (map[string]string, []string) {
+	pairs := make(map[string]string, len(assigns))
+	order := []string{}
+	for _, a := range assigns {
+		if _, ok := pairs[a.Key]; !ok {
+			order = append(order, a.Key)
+		}
+		pairs[a.Key] = a.Value
+	}
+	return pairs, order
+}
+
 func parsePossibleArray(input string) []string {
 	cleanInput := strings.Trim(input, " ")
 	if len(cleanInput) == 0 {
 		return []string{}
 	}
-	if cleanInput[0] == '[' {
-		return parseConfirmedArray(cleanInput)
+	if array, ok := parseJSONArray(cleanInput); ok {
+		return array
+	}
+	// Be lenient about a missing closing bracket, anything else that is not valid JSON is a list of words
+	if array, ok := parseJSONArray(cleanInput + "]"); ok {
+		return array
 	}
 	return strings.Split(cleanInput, " ")
 }
 
-func parseConfirmedArray(input string) []string {
-	// Format of ["abc", "def"]
+// Command as written if the shell form is used
+func shellCommand(input string, shellForm bool) string {
+	if !shellForm {
+		return ""
+	}
+	return strings.TrimSpace(input)
+}
+
+// Array of strings in the format of ["abc", "def"]
+// Like docker anything that is not a valid JSON array of strings is not considered an array
+func parseJSONArray(input string) ([]string, bool) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "[") {
+		return nil, false
+	}
 	res := []string{}
-	wordStart := 0
-	input = strings.Trim(input, "[")
-	input = strings.Trim(input, "]")
-	if len(input) == 0 {
-		return res
+	if err := json.Unmarshal([]byte(input), &res); err != nil {
+		return nil, false
 	}
-	for i := range input {
-		if input[i] == ',' {
-			cur := input[wordStart:i]
-			cur = strings.Trim(cur, " ")
-			cur = strings.Trim(cur, "\"")
-			res = append(res, cur)
-			wordStart = i + 1
-		}
+	return res, true
+}
+
+// Exec form command of RUN, CMD, ENTRYPOINT and HEALTHCHECK and whether the shell form is used
+// The shell form is not split into words, it is kept as written by shellCommand
+func parseCommand(input string) ([]string, bool) {
+	cleanInput := strings.Trim(input, " ")
+	if len(cleanInput) == 0 {
+		return []string{}, false
+	}
+	if array, ok := parseJSONArray(cleanInput); ok {
+		return array, false
 	}
-	cur := input[wordStart : len(input)-1]
-	cur = strings.Trim(cur, " ")
-	cur = strings.Trim(cur, "\"")
-	res = append(res, cur)
-	return res
+	return nil, true
 }
 func CleanSlice(input []string) []string {
 	result := []string{}
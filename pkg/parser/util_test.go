@@ -67,6 +67,51 @@ func TestPaddedArrayParsing(t *testing.T) {
 	}
 }
 
+func TestEscapedArrayParsing(t *testing.T) {
+	input := `["sh", "-c", "echo \"a, b\" \\"]`
+	expected := []string{"sh", "-c", `echo "a, b" \`}
+	actual := parsePossibleArray(input)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Array mismatch: Expected %q Got %q", expected, actual)
+	}
+}
+
+func TestMalformedArrayParsing(t *testing.T) {
+	testCases := map[string][]string{
+		"[a,]":                   {"[a,]"},
+		"[,]":                    {"[,]"},
+		"[":                      {},
+		"[\"a\", \"b\"":          {"a", "b"},
+		"[\"a\",\"b\"] trailing": {"[\"a\",\"b\"]", "trailing"},
+	}
+	for input, expected := range testCases {
+		if actual := parsePossibleArray(input); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Array mismatch for %q: Expected %q Got %q", input, expected, actual)
+		}
+	}
+}
+
+func TestCommandParsing(t *testing.T) {
+	testCases := map[string]struct {
+		Cmd       []string
+		ShellForm bool
+	}{
+		"[\"echo\", \"hi\"]": {[]string{"echo", "hi"}, false},
+		"echo hi":            {nil, true},
+		"[ -f a ] && cat a":  {nil, true},
+		"[\"echo\", 1]":      {nil, true},
+		"[a,]":               {nil, true},
+		"[":                  {nil, true},
+		"":                   {[]string{}, false},
+	}
+	for input, expected := range testCases {
+		cmd, shellForm := parseCommand(input)
+		if !reflect.DeepEqual(expected.Cmd, cmd) || expected.ShellForm != shellForm {
+			t.Errorf("Command mismatch for %q: Expected %q (shell form %v) Got %q (shell form %v)", input, expected.Cmd, expected.ShellForm, cmd, shellForm)
+		}
+	}
+}
+
 func TestCleanSlice(t *testing.T) {
 	input := []string{"a", " ", "", "\t", "b", " "}
 	expected := []string{"a", "b"}
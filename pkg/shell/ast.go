@@ -0,0 +1,240 @@
+// Package parsing POSIX shell commands as used in the shell form of RUN
+package shell
+
+import "strings"
+
+// Every node knows the byte offsets of the source it was parsed from
+type Node interface {
+	Pos() int // Offset of the first byte
+	End() int // Offset directly after the last byte
+}
+
+type span struct {
+	pos, end int
+}
+
+func (s span) Pos() int { return s.pos }
+func (s span) End() int { return s.end }
+
+// Parsed shell source
+type Script struct {
+	span
+	Stmts []*Stmt
+}
+
+// A command with its redirections, terminated by ;, & or a newline
+type Stmt struct {
+	span
+	Cmd        Command // nil if the statement only consists of redirections
+	Redirs     []*Redirect
+	Negated    bool // ! pipeline
+	Background bool // terminated by &
+}
+
+// Command of a statement
+type Command interface {
+	Node
+	commandNode()
+}
+
+func (*CallExpr) commandNode()    {}
+func (*BinaryCmd) commandNode()   {}
+func (*Subshell) commandNode()    {}
+func (*Block) commandNode()       {}
+func (*IfClause) commandNode()    {}
+func (*ForClause) commandNode()   {}
+func (*WhileClause) commandNode() {}
+func (*CaseClause) commandNode()  {}
+
+// Simple command like FOO=bar apt-get install -y curl
+type CallExpr struct {
+	span
+	Assigns []*Assign
+	Args    []*Word // Empty if the command only consists of assignments
+}
+
+// Literal name of the called program or an empty string if it is not literal
+func (c *CallExpr) Name() string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+	name, _ := c.Args[0].Lit()
+	return name
+}
+
+// NAME=value prefix of a simple command
+type Assign struct {
+	span
+	Name  string
+	Value *Word // nil for NAME=
+}
+
+type BinaryOp int
+
+const (
+	AndOp  BinaryOp = iota // &&
+	OrOp                   // ||
+	PipeOp                 // |
+)
+
+func (o BinaryOp) String() string {
+	switch o {
+	case AndOp:
+		return "&&"
+	case OrOp:
+		return "||"
+	}
+	return "|"
+}
+
+// Two statements joined by &&, || or |
+type BinaryCmd struct {
+	span
+	Op   BinaryOp
+	X, Y *Stmt
+}
+
+// ( list )
+type Subshell struct {
+	span
+	Stmts []*Stmt
+}
+
+// { list; }
+type Block struct {
+	span
+	Stmts []*Stmt
+}
+
+// if cond; then ...; else ...; fi, elif is represented by an IfClause in Else
+type IfClause struct {
+	span
+	Cond []*Stmt
+	Then []*Stmt
+	Else []*Stmt
+}
+
+// for name [in items]; do ...; done
+type ForClause struct {
+	span
+	Name  string
+	InSet bool // false if the positional parameters are iterated
+	Items []*Word
+	Do    []*Stmt
+}
+
+// while cond; do ...; done or until cond; do ...; done
+type WhileClause struct {
+	span
+	Until bool
+	Cond  []*Stmt
+	Do    []*Stmt
+}
+
+// case word in pattern) ...;; esac
+type CaseClause struct {
+	span
+	Word  *Word
+	Items []*CaseItem
+}
+
+type CaseItem struct {
+	span
+	Patterns []*Word
+	Stmts    []*Stmt
+}
+
+// Redirection like >/dev/null, 2>&1 or <<EOF
+type Redirect struct {
+	span
+	N    string // File descriptor written in front of the operator, empty if omitted
+	Op   string // <, >, >>, >|, <>, <&, >&, &>, &>>, << or <<-
+	Word *Word  // Target or heredoc delimiter
+}
+
+// A single shell word consisting of literal, quoted and expanded parts
+type Word struct {
+	span
+	Raw   string // Source of the word
+	Parts []WordPart
+}
+
+// Value of the word after quote removal, ok is false if the word contains expansions
+func (w *Word) Lit() (string, bool) {
+	var sb strings.Builder
+	if !literal(w.Parts, &sb) {
+		return "", false
+	}
+	return sb.String(), true
+}
+
+func literal(parts []WordPart, sb *strings.Builder) bool {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *Lit:
+			sb.WriteString(p.Value)
+		case *SglQuoted:
+			sb.WriteString(p.Value)
+		case *DblQuoted:
+			if !literal(p.Parts, sb) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Part of a word
+type WordPart interface {
+	Node
+	wordPartNode()
+}
+
+func (*Lit) wordPartNode()       {}
+func (*SglQuoted) wordPartNode() {}
+func (*DblQuoted) wordPartNode() {}
+func (*ParamExp) wordPartNode()  {}
+func (*CmdSubst) wordPartNode()  {}
+func (*ArithExp) wordPartNode()  {}
+
+// Unquoted text, escape characters are removed from the value
+type Lit struct {
+	span
+	Value string
+}
+
+// '...'
+type SglQuoted struct {
+	span
+	Value string
+}
+
+// "..."
+type DblQuoted struct {
+	span
+	Parts []WordPart
+}
+
+// $name, $1, $@ or ${name...}
+type ParamExp struct {
+	span
+	Name      string
+	Braced    bool
+	Length    bool   // ${#name}
+	Operation string // Everything following the name inside the braces, e.g. :-default
+}
+
+// $(...) or `...`
+type CmdSubst struct {
+	span
+	Stmts     []*Stmt
+	Backquote bool
+}
+
+// $((...)), the expression is not parsed
+type ArithExp struct {
+	span
+	Expr string
+}
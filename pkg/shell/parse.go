@@ -0,0 +1,421 @@
+package shell
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Error returned if the source is not a valid shell script
+type ParseError struct {
+	Offset  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Message)
+}
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	newlineToken
+	wordToken
+	operatorToken
+	redirectToken
+)
+
+type token struct {
+	kind     tokenKind
+	value    string // Operator or redirection operator
+	n        string // File descriptor of a redirection
+	word     *Word
+	pos, end int
+}
+
+// Operators sorted so that longer operators are matched first
+var operators = []string{"&>>", "<<-", "&&", "||", ";;", "&>", "<<", "<&", "<>", ">>", ">&", ">|", "&", "|", ";", "(", ")", "<", ">"}
+
+var redirectOperators = []string{"&>>", "<<-", "&>", "<<", "<&", "<>", ">>", ">&", ">|", "<", ">"}
+
+type parser struct {
+	src       string
+	pos       int
+	lookahead *token
+	backquote int // Depth of backquote command substitutions
+	err       error
+}
+
+// Parse the source into a shell syntax tree
+// Supported are command lists, pipelines, && and ||, subshells, groups, if, for, while, until, case, redirections, quoting and expansions
+func Parse(src string) (*Script, error) {
+	p := &parser{src: src}
+	stmts := p.list()
+	if p.err == nil && p.peek().kind != eofToken {
+		p.fail(p.peek().pos, fmt.Sprintf("unexpected %s", p.describe(p.peek())))
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Script{span: span{0, len(src)}, Stmts: stmts}, nil
+}
+
+func (p *parser) fail(offset int, message string) {
+	if p.err == nil {
+		p.err = &ParseError{Offset: offset, Message: message}
+	}
+}
+
+func (p *parser) describe(t *token) string {
+	switch t.kind {
+	case eofToken:
+		return "end of input"
+	case newlineToken:
+		return "newline"
+	case wordToken:
+		return fmt.Sprintf("word %q", t.word.Raw)
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+func (p *parser) peek() *token {
+	if p.lookahead == nil {
+		t := p.scan()
+		p.lookahead = &t
+	}
+	return p.lookahead
+}
+
+func (p *parser) next() token {
+	t := *p.peek()
+	p.lookahead = nil
+	return t
+}
+
+func (p *parser) isOperator(t *token, values ...string) bool {
+	return t.kind == operatorToken && slices.Contains(values, t.value)
+}
+
+// Reserved words are only recognized if they are written without quotes
+func (p *parser) isReserved(t *token, words ...string) bool {
+	return t.kind == wordToken && slices.Contains(words, t.word.Raw)
+}
+
+func (p *parser) expectReserved(word string) int {
+	t := p.peek()
+	if !p.isReserved(t, word) {
+		p.fail(t.pos, fmt.Sprintf("expected %q, found %s", word, p.describe(t)))
+		return t.pos
+	}
+	p.next()
+	return t.end
+}
+
+func (p *parser) expectOperator(operator string) int {
+	t := p.peek()
+	if !p.isOperator(t, operator) {
+		p.fail(t.pos, fmt.Sprintf("expected %q, found %s", operator, p.describe(t)))
+		return t.pos
+	}
+	p.next()
+	return t.end
+}
+
+func (p *parser) skipNewlines() {
+	for p.err == nil && p.peek().kind == newlineToken {
+		p.next()
+	}
+}
+
+// Statements until the end of the input or one of the stop words or operators
+func (p *parser) list(stops ...string) []*Stmt {
+	stmts := []*Stmt{}
+	for p.err == nil {
+		p.skipNewlines()
+		t := p.peek()
+		if t.kind == eofToken || p.isReserved(t, stops...) || p.isOperator(t, stops...) || p.isOperator(t, ")", ";;", "`") {
+			return stmts
+		}
+		stmt := p.andOr()
+		if p.err != nil {
+			return stmts
+		}
+		t = p.peek()
+		switch {
+		case p.isOperator(t, "&"):
+			stmt.Background = true
+			stmt.end = p.next().end
+		case p.isOperator(t, ";"), t.kind == newlineToken:
+			p.next()
+		case t.kind == eofToken, p.isReserved(t, stops...), p.isOperator(t, ")", ";;", "`"):
+		default:
+			p.fail(t.pos, fmt.Sprintf("unexpected %s", p.describe(t)))
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+func (p *parser) andOr() *Stmt {
+	x := p.pipeline()
+	for p.err == nil && p.isOperator(p.peek(), "&&", "||") {
+		op := AndOp
+		if p.next().value == "||" {
+			op = OrOp
+		}
+		p.skipNewlines()
+		y := p.pipeline()
+		x = &Stmt{span: span{x.pos, y.end}, Cmd: &BinaryCmd{span: span{x.pos, y.end}, Op: op, X: x, Y: y}}
+	}
+	return x
+}
+
+func (p *parser) pipeline() *Stmt {
+	start := p.peek().pos
+	negated := false
+	if p.isReserved(p.peek(), "!") {
+		negated = true
+		p.next()
+	}
+	x := p.command()
+	for p.err == nil && p.isOperator(p.peek(), "|") {
+		p.next()
+		p.skipNewlines()
+		y := p.command()
+		x = &Stmt{span: span{x.pos, y.end}, Cmd: &BinaryCmd{span: span{x.pos, y.end}, Op: PipeOp, X: x, Y: y}}
+	}
+	if negated {
+		x.Negated = true
+		x.pos = start
+	}
+	return x
+}
+
+func (p *parser) command() *Stmt {
+	t := p.peek()
+	stmt := &Stmt{span: span{t.pos, t.pos}}
+	switch {
+	case p.isOperator(t, "("):
+		p.next()
+		stmts := p.list()
+		end := p.expectOperator(")")
+		stmt.Cmd = &Subshell{span: span{t.pos, end}, Stmts: stmts}
+	case p.isReserved(t, "{"):
+		p.next()
+		stmts := p.list("}")
+		end := p.expectReserved("}")
+		stmt.Cmd = &Block{span: span{t.pos, end}, Stmts: stmts}
+	case p.isReserved(t, "if"):
+		p.next()
+		stmt.Cmd = p.ifClause(t.pos)
+	case p.isReserved(t, "for"):
+		p.next()
+		stmt.Cmd = p.forClause(t.pos)
+	case p.isReserved(t, "while", "until"):
+		p.next()
+		cond := p.list("do")
+		p.expectReserved("do")
+		body := p.list("done")
+		end := p.expectReserved("done")
+		stmt.Cmd = &WhileClause{span: span{t.pos, end}, Until: t.word.Raw == "until", Cond: cond, Do: body}
+	case p.isReserved(t, "case"):
+		p.next()
+		stmt.Cmd = p.caseClause(t.pos)
+	default:
+		return p.simpleCommand()
+	}
+	stmt.end = stmt.Cmd.End()
+	// Compound commands may be followed by redirections
+	for p.err == nil && p.peek().kind == redirectToken {
+		redirect := p.redirect()
+		stmt.Redirs = append(stmt.Redirs, redirect)
+		stmt.end = redirect.end
+	}
+	return stmt
+}
+
+func (p *parser) simpleCommand() *Stmt {
+	start := p.peek().pos
+	stmt := &Stmt{span: span{start, start}}
+	call := &CallExpr{span: span{start, start}}
+	for p.err == nil {
+		t := p.peek()
+		if t.kind == redirectToken {
+			redirect := p.redirect()
+			stmt.Redirs = append(stmt.Redirs, redirect)
+			stmt.end = redirect.end
+			continue
+		}
+		if t.kind != wordToken {
+			break
+		}
+		p.next()
+		if assign := assignOf(t.word); assign != nil && len(call.Args) == 0 {
+			call.Assigns = append(call.Assigns, assign)
+		} else {
+			call.Args = append(call.Args, t.word)
+		}
+		call.end = t.end
+		stmt.end = t.end
+	}
+	if len(call.Assigns) == 0 && len(call.Args) == 0 {
+		if len(stmt.Redirs) == 0 {
+			p.fail(p.peek().pos, fmt.Sprintf("unexpected %s", p.describe(p.peek())))
+		}
+		return stmt
+	}
+	stmt.Cmd = call
+	return stmt
+}
+
+func (p *parser) redirect() *Redirect {
+	t := p.next()
+	target := p.peek()
+	if target.kind != wordToken {
+		p.fail(target.pos, fmt.Sprintf("expected redirection target, found %s", p.describe(target)))
+		return &Redirect{span: span{t.pos, t.end}, N: t.n, Op: t.value}
+	}
+	p.next()
+	return &Redirect{span: span{t.pos, target.end}, N: t.n, Op: t.value, Word: target.word}
+}
+
+// Assignment if the word starts with NAME= outside of quotes
+func assignOf(w *Word) *Assign {
+	if len(w.Parts) == 0 {
+		return nil
+	}
+	lit, ok := w.Parts[0].(*Lit)
+	if !ok {
+		return nil
+	}
+	name, value, found := strings.Cut(lit.Value, "=")
+	if !found || !validName(name) || !strings.HasPrefix(w.Raw, name+"=") {
+		return nil
+	}
+	assign := &Assign{span: w.span, Name: name}
+	valueStart := w.pos + len(name) + 1
+	parts := w.Parts[1:]
+	if value != "" {
+		parts = append([]WordPart{&Lit{span: span{valueStart, lit.end}, Value: value}}, parts...)
+	}
+	if len(parts) != 0 {
+		assign.Value = &Word{span: span{valueStart, w.end}, Raw: w.Raw[len(name)+1:], Parts: parts}
+	}
+	return assign
+}
+
+func validName(name string) bool {
+	if name == "" || !isNameStart(name[0]) {
+		return false
+	}
+	for i := range len(name) {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) ifClause(start int) *IfClause {
+	clause := &IfClause{span: span{start, start}}
+	clause.Cond = p.list("then")
+	p.expectReserved("then")
+	clause.Then = p.list("elif", "else", "fi")
+	t := p.peek()
+	switch {
+	case p.isReserved(t, "elif"):
+		p.next()
+		nested := p.ifClause(t.pos)
+		clause.Else = []*Stmt{{span: nested.span, Cmd: nested}}
+		clause.end = nested.end
+	case p.isReserved(t, "else"):
+		p.next()
+		clause.Else = p.list("fi")
+		clause.end = p.expectReserved("fi")
+	default:
+		clause.end = p.expectReserved("fi")
+	}
+	return clause
+}
+
+func (p *parser) forClause(start int) *ForClause {
+	clause := &ForClause{span: span{start, start}}
+	name := p.next()
+	if name.kind != wordToken || !validName(name.word.Raw) {
+		p.fail(name.pos, fmt.Sprintf("expected variable name, found %s", p.describe(&name)))
+		return clause
+	}
+	clause.Name = name.word.Raw
+	p.skipNewlines()
+	if p.isReserved(p.peek(), "in") {
+		p.next()
+		clause.InSet = true
+		for p.err == nil && p.peek().kind == wordToken {
+			clause.Items = append(clause.Items, p.next().word)
+		}
+	}
+	if p.isOperator(p.peek(), ";") || p.peek().kind == newlineToken {
+		p.next()
+	}
+	p.skipNewlines()
+	p.expectReserved("do")
+	clause.Do = p.list("done")
+	clause.end = p.expectReserved("done")
+	return clause
+}
+
+func (p *parser) caseClause(start int) *CaseClause {
+	clause := &CaseClause{span: span{start, start}}
+	word := p.next()
+	if word.kind != wordToken {
+		p.fail(word.pos, fmt.Sprintf("expected word, found %s", p.describe(&word)))
+		return clause
+	}
+	clause.Word = word.word
+	p.skipNewlines()
+	p.expectReserved("in")
+	p.skipNewlines()
+	for p.err == nil && !p.isReserved(p.peek(), "esac") {
+		item := &CaseItem{span: span{p.peek().pos, p.peek().pos}}
+		if p.isOperator(p.peek(), "(") {
+			p.next()
+		}
+		for p.err == nil {
+			pattern := p.next()
+			if pattern.kind != wordToken {
+				p.fail(pattern.pos, fmt.Sprintf("expected pattern, found %s", p.describe(&pattern)))
+				return clause
+			}
+			item.Patterns = append(item.Patterns, pattern.word)
+			if !p.isOperator(p.peek(), "|") {
+				break
+			}
+			p.next()
+		}
+		item.end = p.expectOperator(")")
+		item.Stmts = p.list("esac")
+		if len(item.Stmts) != 0 {
+			item.end = item.Stmts[len(item.Stmts)-1].end
+		}
+		if p.isOperator(p.peek(), ";;") {
+			item.end = p.next().end
+		}
+		p.skipNewlines()
+		clause.Items = append(clause.Items, item)
+	}
+	clause.end = p.expectReserved("esac")
+	return clause
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,125 @@
+package shell_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/shell"
+)
+
+func parse(t *testing.T, src string) *shell.Script {
+	script, err := shell.Parse(src)
+	if err != nil {
+		t.Fatalf("Parsing %q failed: %s", src, err.Error())
+	}
+	return script
+}
+
+func commandNames(script *shell.Script) []string {
+	res := []string{}
+	for _, call := range script.Commands() {
+		res = append(res, call.Name())
+	}
+	return res
+}
+
+func TestCommands(t *testing.T) {
+	testCases := map[string][]string{
+		"apt-get update && apt-get install -y curl":                       {"apt-get", "apt-get"},
+		"curl -fsSL https://example.com/install.sh | sh":                  {"curl", "sh"},
+		"make || (echo failed; exit 1)":                                   {"make", "echo", "exit"},
+		"{ echo a; echo b; } > out.txt":                                   {"echo", "echo"},
+		"if [ -f a ]; then cat a; elif true; then :; else echo none; fi":  {"[", "cat", "true", ":", "echo"},
+		"for f in a b; do rm \"$f\"; done":                                {"rm"},
+		"while read line; do echo $line; done < file":                     {"read", "echo"},
+		"case $ARCH in amd64|x86_64) echo x64;; *) echo other;; esac":     {"echo", "echo"},
+		"echo $(uname -m) `id -u`":                                        {"echo", "uname", "id"},
+		"FOO=bar BAZ= env":                                                {"env"},
+		"set -ex\napt-get update\n# comment\nrm -rf /var/lib/apt/lists/*": {"set", "apt-get", "rm"},
+		"apt-get install \\\n  vim":                                       {"apt-get"},
+	}
+	for src, expected := range testCases {
+		if actual := commandNames(parse(t, src)); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Commands mismatch for %q: Expected %v Got %v", src, expected, actual)
+		}
+	}
+}
+
+func TestStructure(t *testing.T) {
+	script := parse(t, "! a && b | c 2>&1 &")
+	if len(script.Stmts) != 1 {
+		t.Fatalf("Statement count mismatch: Expected 1 Got %d", len(script.Stmts))
+	}
+	stmt := script.Stmts[0]
+	and, ok := stmt.Cmd.(*shell.BinaryCmd)
+	if !ok || and.Op != shell.AndOp || !stmt.Background {
+		t.Fatalf("Expected background && command, Got %#v", stmt)
+	}
+	if !and.X.Negated {
+		t.Errorf("Expected first pipeline to be negated")
+	}
+	pipe, ok := and.Y.Cmd.(*shell.BinaryCmd)
+	if !ok || pipe.Op != shell.PipeOp {
+		t.Fatalf("Expected pipe, Got %#v", and.Y.Cmd)
+	}
+	redirect := pipe.Y.Redirs[0]
+	if redirect.N != "2" || redirect.Op != ">&" || redirect.Word.Raw != "1" {
+		t.Errorf("Redirect mismatch: Got %s %s %s", redirect.N, redirect.Op, redirect.Word.Raw)
+	}
+}
+
+func TestWords(t *testing.T) {
+	script := parse(t, `echo plain 'single $x' "double $HOME ${PATH:-/bin} \"q\"" a\ b ${#ARR} $((1 + 2))`)
+	args := script.Commands()[0].Args
+	if len(args) != 7 {
+		t.Fatalf("Argument count mismatch: Expected 7 Got %d", len(args))
+	}
+	literals := map[int]string{0: "echo", 1: "plain", 2: "single $x", 4: "a b"}
+	for i, expected := range literals {
+		if actual, ok := args[i].Lit(); !ok || actual != expected {
+			t.Errorf("Literal mismatch for argument %d: Expected %q Got %q", i, expected, actual)
+		}
+	}
+	if _, ok := args[3].Lit(); ok {
+		t.Errorf("Expected argument with expansions to not be literal")
+	}
+	double := args[3].Parts[0].(*shell.DblQuoted)
+	home := double.Parts[1].(*shell.ParamExp)
+	path := double.Parts[3].(*shell.ParamExp)
+	if home.Name != "HOME" || home.Braced || path.Name != "PATH" || path.Operation != ":-/bin" || !path.Braced {
+		t.Errorf("Parameter expansion mismatch: Got %+v %+v", home, path)
+	}
+	if last := double.Parts[4].(*shell.Lit); last.Value != " \"q\"" {
+		t.Errorf("Escaped quote mismatch: Got %q", last.Value)
+	}
+	if length := args[5].Parts[0].(*shell.ParamExp); !length.Length || length.Name != "ARR" {
+		t.Errorf("Length expansion mismatch: Got %+v", length)
+	}
+	if arith := args[6].Parts[0].(*shell.ArithExp); arith.Expr != "1 + 2" {
+		t.Errorf("Arithmetic expansion mismatch: Got %q", arith.Expr)
+	}
+	if args[3].Raw != `"double $HOME ${PATH:-/bin} \"q\""` || args[3].Pos() != 23 {
+		t.Errorf("Word source mismatch: Got %q at %d", args[3].Raw, args[3].Pos())
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	call := parse(t, "A=1 B=\"x y\" C= cmd D=2").Commands()[0]
+	if len(call.Assigns) != 3 || len(call.Args) != 2 {
+		t.Fatalf("Assignment mismatch: Got %d assignments and %d arguments", len(call.Assigns), len(call.Args))
+	}
+	if value, _ := call.Assigns[1].Value.Lit(); call.Assigns[1].Name != "B" || value != "x y" {
+		t.Errorf("Assignment mismatch: Got %s=%s", call.Assigns[1].Name, value)
+	}
+	if call.Assigns[2].Value != nil {
+		t.Errorf("Expected empty assignment to have no value")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{"echo 'open", "echo \"open", "a &&", "(a", "if a; then b", "for 1 in a; do b; done", "echo ${a", "a | | b", ")", "echo $(a"} {
+		if _, err := shell.Parse(src); err == nil {
+			t.Errorf("Expected error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package shell
+
+import (
+	"slices"
+	"strings"
+)
+
+// Characters terminating an unquoted word
+const metacharacters = " \t\n;&|<>()"
+
+func (p *parser) scan() token {
+	p.skipBlanks()
+	if p.pos >= len(p.src) {
+		return token{kind: eofToken, pos: len(p.src), end: len(p.src)}
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '\n':
+		p.pos++
+		return token{kind: newlineToken, pos: start, end: p.pos}
+	case c == '`' && p.backquote > 0:
+		p.pos++
+		return token{kind: operatorToken, value: "`", pos: start, end: p.pos}
+	case strings.IndexByte(metacharacters, c) != -1:
+		for _, operator := range operators {
+			if strings.HasPrefix(p.src[p.pos:], operator) {
+				p.pos += len(operator)
+				kind := operatorToken
+				if slices.Contains(redirectOperators, operator) {
+					kind = redirectToken
+				}
+				return token{kind: kind, value: operator, pos: start, end: p.pos}
+			}
+		}
+	}
+	// A number directly followed by < or > is the file descriptor of a redirection
+	end := p.pos
+	for end < len(p.src) && isDigit(p.src[end]) {
+		end++
+	}
+	if end > p.pos && end < len(p.src) && (p.src[end] == '<' || p.src[end] == '>') {
+		p.pos = end
+		t := p.scan()
+		t.n, t.pos = p.src[start:end], start
+		return t
+	}
+	word := p.word()
+	return token{kind: wordToken, word: word, pos: word.pos, end: word.end}
+}
+
+// Skip blanks, escaped newlines and comments
+func (p *parser) skipBlanks() {
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == ' ' || p.src[p.pos] == '\t':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "\\\n"):
+			p.pos += 2
+		case p.src[p.pos] == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Collects the literal text in between other parts of a word
+type literalBuilder struct {
+	sb    strings.Builder
+	start int
+	parts *[]WordPart
+}
+
+func (b *literalBuilder) add(pos int, s string) {
+	if b.sb.Len() == 0 {
+		b.start = pos
+	}
+	b.sb.WriteString(s)
+}
+
+func (b *literalBuilder) flush(end int) {
+	if b.sb.Len() != 0 {
+		*b.parts = append(*b.parts, &Lit{span: span{b.start, end}, Value: b.sb.String()})
+		b.sb.Reset()
+	}
+}
+
+func (p *parser) word() *Word {
+	start := p.pos
+	parts := []WordPart{}
+	lit := &literalBuilder{parts: &parts}
+	for p.pos < len(p.src) && p.err == nil {
+		c := p.src[p.pos]
+		if strings.IndexByte(metacharacters, c) != -1 || (c == '`' && p.backquote > 0) {
+			break
+		}
+		switch c {
+		case '\\':
+			switch {
+			case p.pos+1 >= len(p.src):
+				lit.add(p.pos, "\\")
+				p.pos++
+			case p.src[p.pos+1] == '\n':
+				p.pos += 2
+			default:
+				lit.add(p.pos, p.src[p.pos+1:p.pos+2])
+				p.pos += 2
+			}
+		case '\'':
+			lit.flush(p.pos)
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end == -1 {
+				p.fail(p.pos, "unterminated single quote")
+				break
+			}
+			parts = append(parts, &SglQuoted{span: span{p.pos, p.pos + end + 2}, Value: p.src[p.pos+1 : p.pos+1+end]})
+			p.pos += end + 2
+		case '"':
+			lit.flush(p.pos)
+			parts = append(parts, p.doubleQuoted())
+		case '$':
+			if part := p.dollar(); part != nil {
+				lit.flush(part.Pos())
+				parts = append(parts, part)
+			} else {
+				lit.add(p.pos, "$")
+				p.pos++
+			}
+		case '`':
+			lit.flush(p.pos)
+			parts = append(parts, p.backquoted())
+		default:
+			lit.add(p.pos, string(c))
+			p.pos++
+		}
+	}
+	lit.flush(p.pos)
+	return &Word{span: span{start, p.pos}, Raw: p.src[start:p.pos], Parts: parts}
+}
+
+func (p *parser) doubleQuoted() *DblQuoted {
+	start := p.pos
+	p.pos++
+	parts := []WordPart{}
+	lit := &literalBuilder{parts: &parts}
+	for p.err == nil {
+		if p.pos >= len(p.src) {
+			p.fail(start, "unterminated double quote")
+			break
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			lit.flush(p.pos)
+			p.pos++
+			break
+		}
+		switch c {
+		case '\\':
+			// Inside double quotes the backslash only escapes $, `, ", \ and newlines
+			switch {
+			case p.pos+1 < len(p.src) && p.src[p.pos+1] == '\n':
+				p.pos += 2
+			case p.pos+1 < len(p.src) && strings.IndexByte("$`\"\\", p.src[p.pos+1]) != -1:
+				lit.add(p.pos, p.src[p.pos+1:p.pos+2])
+				p.pos += 2
+			default:
+				lit.add(p.pos, "\\")
+				p.pos++
+			}
+		case '$':
+			if part := p.dollar(); part != nil {
+				lit.flush(part.Pos())
+				parts = append(parts, part)
+			} else {
+				lit.add(p.pos, "$")
+				p.pos++
+			}
+		case '`':
+			lit.flush(p.pos)
+			parts = append(parts, p.backquoted())
+		default:
+			lit.add(p.pos, string(c))
+			p.pos++
+		}
+	}
+	return &DblQuoted{span: span{start, p.pos}, Parts: parts}
+}
+
+// Expansion starting with $ or nil if the $ is literal
+func (p *parser) dollar() WordPart {
+	start := p.pos
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "$(("):
+		depth := 0
+		for i := 3; i < len(rest); i++ {
+			switch rest[i] {
+			case '(':
+				depth++
+			case ')':
+				if depth > 0 {
+					depth--
+				} else if strings.HasPrefix(rest[i:], "))") {
+					p.pos += i + 2
+					return &ArithExp{span: span{start, p.pos}, Expr: rest[3:i]}
+				}
+			}
+		}
+		p.fail(start, "unterminated arithmetic expansion")
+		p.pos = len(p.src)
+		return &ArithExp{span: span{start, p.pos}}
+	case strings.HasPrefix(rest, "$("):
+		p.pos += 2
+		// The lookahead is empty as words are only scanned when the lookahead is requested
+		stmts := p.list()
+		end := p.expectOperator(")")
+		p.pos = max(p.pos, end)
+		return &CmdSubst{span: span{start, end}, Stmts: stmts}
+	case strings.HasPrefix(rest, "${"):
+		end := closingBrace(rest)
+		if end == -1 {
+			p.fail(start, "unterminated parameter expansion")
+			p.pos = len(p.src)
+			return &ParamExp{span: span{start, p.pos}, Braced: true}
+		}
+		p.pos += end + 1
+		return braced(rest[2:end], span{start, p.pos})
+	case len(rest) > 1 && isNameStart(rest[1]):
+		end := 2
+		for end < len(rest) && isNameChar(rest[end]) {
+			end++
+		}
+		p.pos += end
+		return &ParamExp{span: span{start, p.pos}, Name: rest[1:end]}
+	case len(rest) > 1 && (isDigit(rest[1]) || strings.IndexByte("@*#?-$!", rest[1]) != -1):
+		p.pos += 2
+		return &ParamExp{span: span{start, p.pos}, Name: rest[1:2]}
+	}
+	return nil
+}
+
+// Index of the brace closing ${, nested expansions and quotes are skipped
+func closingBrace(s string) int {
+	depth := 0
+	var quote byte
+	for i := 2; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{' && s[i-1] == '$':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func braced(content string, s span) *ParamExp {
+	exp := &ParamExp{span: s, Braced: true}
+	if len(content) > 1 && content[0] == '#' {
+		exp.Length = true
+		content = content[1:]
+	}
+	end := 0
+	for end < len(content) && isNameChar(content[end]) {
+		end++
+	}
+	if end == 0 && content != "" && strings.IndexByte("@*#?-$!", content[0]) != -1 {
+		end = 1
+	}
+	exp.Name, exp.Operation = content[:end], content[end:]
+	return exp
+}
+
+func (p *parser) backquoted() *CmdSubst {
+	start := p.pos
+	p.pos++
+	p.backquote++
+	stmts := p.list()
+	p.backquote--
+	end := p.expectOperator("`")
+	p.pos = max(p.pos, end)
+	return &CmdSubst{span: span{start, end}, Stmts: stmts, Backquote: true}
+}
@@ -0,0 +1,90 @@
+package shell
+
+// Traverse the tree in depth-first order calling f for every node
+// Children of a node are skipped if f returns false
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	stmts := func(list []*Stmt) {
+		for _, stmt := range list {
+			Inspect(stmt, f)
+		}
+	}
+	words := func(list []*Word) {
+		for _, word := range list {
+			Inspect(word, f)
+		}
+	}
+	switch n := node.(type) {
+	case *Script:
+		stmts(n.Stmts)
+	case *Stmt:
+		if n.Cmd != nil {
+			Inspect(n.Cmd, f)
+		}
+		for _, redirect := range n.Redirs {
+			Inspect(redirect, f)
+		}
+	case *CallExpr:
+		for _, assign := range n.Assigns {
+			Inspect(assign, f)
+		}
+		words(n.Args)
+	case *Assign:
+		if n.Value != nil {
+			Inspect(n.Value, f)
+		}
+	case *BinaryCmd:
+		Inspect(n.X, f)
+		Inspect(n.Y, f)
+	case *Subshell:
+		stmts(n.Stmts)
+	case *Block:
+		stmts(n.Stmts)
+	case *IfClause:
+		stmts(n.Cond)
+		stmts(n.Then)
+		stmts(n.Else)
+	case *ForClause:
+		words(n.Items)
+		stmts(n.Do)
+	case *WhileClause:
+		stmts(n.Cond)
+		stmts(n.Do)
+	case *CaseClause:
+		Inspect(n.Word, f)
+		for _, item := range n.Items {
+			Inspect(item, f)
+		}
+	case *CaseItem:
+		words(n.Patterns)
+		stmts(n.Stmts)
+	case *Redirect:
+		if n.Word != nil {
+			Inspect(n.Word, f)
+		}
+	case *Word:
+		for _, part := range n.Parts {
+			Inspect(part, f)
+		}
+	case *DblQuoted:
+		for _, part := range n.Parts {
+			Inspect(part, f)
+		}
+	case *CmdSubst:
+		stmts(n.Stmts)
+	}
+}
+
+// All simple commands of the script including the ones in command substitutions in the order they appear
+func (s *Script) Commands() []*CallExpr {
+	res := []*CallExpr{}
+	Inspect(s, func(n Node) bool {
+		if call, ok := n.(*CallExpr); ok {
+			res = append(res, call)
+		}
+		return true
+	})
+	return res
+}
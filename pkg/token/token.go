@@ -51,11 +51,40 @@ var TokenLookupTable = map[string]int{
 	"WORKDIR":     WORKDIR,
 }
 
+// Position in the original input
+// Lines and columns are 1-based, columns are counted in bytes
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Get the name of a token kind as used in the Dockerfile
+func KindName(kind int) string {
+	for name, k := range TokenLookupTable {
+		if k == kind {
+			return name
+		}
+	}
+	return "UNKNOWN"
+}
+
+// Heredoc as supported by RUN, COPY and ADD
+type Heredoc struct {
+	Name      string // Delimiter terminating the heredoc
+	Body      string // Raw lines of the heredoc, every line is terminated by a newline
+	Expand    bool   // The delimiter was not quoted -> variables in the body are expanded
+	StripTabs bool   // Started with <<- instead of <<
+}
+
 type Token struct {
-	Kind               int
-	Params             map[string][]string
-	Content            string
-	InlineComment      string
-	MultiLineContent   []string //This can only contain content for instructions that support heredoc (which should be COPY and RUN)
-	HereDocRedirection bool     // Did heredoc start with <<- instead of <<
+	Kind          int
+	Start         Position // Position of the first character of the instruction
+	End           Position // Position directly after the last character of the instruction
+	Params        map[string][]string
+	Flags         []string // Flags in the order and spelling they were written, e.g. --link or --from=build
+	Content       string
+	InlineComment string
+	Comments      []string  // Comment lines found in between the continuation lines of the instruction
+	Heredocs      []Heredoc // This can only contain content for instructions that support heredoc (RUN, COPY and ADD)
+	Raw           []string  // Physical lines of the input the token was lexed from
 }
@@ -2,8 +2,10 @@ package util
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strings"
+	"unicode"
 )
 
 // Get value from passed map with a default
@@ -16,86 +18,136 @@ func GetFromParamsWithDefault(m map[string][]string, k string, d []string) []str
 
 // Read the lines of a file into a slice
 func ReadFileLines(path string) ([]string, error) {
-	lines := []string{}
-
 	file, err := os.Open(path)
 	if err != nil {
-		return lines, err
+		return []string{}, err
 	}
 	defer file.Close()
+	return ReadLines(file)
+}
 
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// Read the lines of the reader into a slice
+// Lines may be of any length, CRLF line endings and a leading UTF-8 byte order mark are removed
+func ReadLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) != 0 {
+			if len(lines) == 0 {
+				line = strings.TrimPrefix(line, "\uFEFF")
+			}
+			line = strings.TrimSuffix(line, "\n")
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return lines, err
-	}
-	return lines, nil
+// Key value pair of an ENV, LABEL or ARG instruction
+// The value is kept as written, quotes and escapes are resolved when the value is expanded
+type Assign struct {
+	Key      string
+	Value    string
+	HasValue bool // false for a bare name, e.g. ARG VERSION
 }
 
-// TODO: Simplify this! For now this is GPT
+// Parse the operands of ENV and LABEL into a map
+// Use ParseKeyValues to keep the order and the syntax of the pairs
 func ParseAssigns(input string) map[string]string {
 	m := make(map[string]string)
-	parts := tokenize(input)
-
-	var key string
-	for i := 0; i < len(parts); i++ {
-		p := parts[i]
-
-		// Try normal KEY=VAL first
-		k, v := ParseAssign(p)
-		if k != "" && v != "" {
-			m[k] = v
-			continue
-		}
-
-		// Otherwise alternate KEY VAL
-		if key == "" {
-			key = p
-		} else {
-			m[key] = p
-			key = ""
-		}
-	}
-	if key != "" {
-		m[key] = "" // dangling key
+	assigns, _ := ParseKeyValues(input, '\\')
+	for _, a := range assigns {
+		m[a.Key] = a.Value
 	}
 	return m
 }
 
-func tokenize(input string) []string {
-	var tokens []string
-	var buf strings.Builder
-	inQuotes := false
+// Parse the operands of ENV and LABEL in the order they are written
+// If the first word has no = the legacy form KEY value is used, the rest of the line is the value of a single key
+// Legacy reports which of the two forms was found
+func ParseKeyValues(input string, escape byte) (assigns []Assign, legacy bool) {
+	words := SplitWords(input, escape)
+	if len(words) == 0 {
+		return nil, false
+	}
+	if !strings.Contains(words[0], "=") {
+		key, value := strings.TrimSpace(input), ""
+		if i := strings.IndexFunc(key, unicode.IsSpace); i != -1 {
+			key, value = key[:i], strings.TrimLeftFunc(key[i:], unicode.IsSpace)
+		}
+		return []Assign{{Key: key, Value: value, HasValue: value != ""}}, true
+	}
+	return ParseNameValues(input, escape), false
+}
 
-	for i := 0; i < len(input); i++ {
-		c := input[i]
+// Parse NAME=VALUE words in the order they are written, words without = are returned as bare names (e.g. ARG NAME)
+func ParseNameValues(input string, escape byte) []Assign {
+	assigns := []Assign{}
+	for _, word := range SplitWords(input, escape) {
+		key, value, hasValue := strings.Cut(word, "=")
+		assigns = append(assigns, Assign{Key: key, Value: value, HasValue: hasValue})
+	}
+	return assigns
+}
 
-		switch c {
-		case '"':
-			inQuotes = !inQuotes
-			buf.WriteByte(c) // keep the quote
-		case ' ':
-			if inQuotes {
-				buf.WriteByte(c)
-			} else {
-				if buf.Len() > 0 {
-					tokens = append(tokens, buf.String())
-					buf.Reset()
+// Split the operands of an instruction into words the way docker does
+// Words are separated by unquoted whitespace, quotes and escape characters are kept in the word
+// Within single quotes the escape character has no special meaning
+func SplitWords(input string, escape byte) []string {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	blankOK := false // a quoted empty string is a word
+	var quote rune
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == rune(escape) && quote != '\'' {
+				if i+1 == len(runes) {
+					continue
 				}
+				word.WriteRune(c)
+				i++
+				c = runes[i]
+			}
+			word.WriteRune(c)
+		case unicode.IsSpace(c):
+			if inWord && (blankOK || word.Len() > 0) {
+				words = append(words, word.String())
 			}
+			word.Reset()
+			inWord, blankOK = false, false
 		default:
-			buf.WriteByte(c)
+			inWord = true
+			if c == '\'' || c == '"' {
+				quote = c
+				blankOK = true
+			} else if c == rune(escape) {
+				// An escape character at the end of the input is dropped
+				if i+1 == len(runes) {
+					continue
+				}
+				word.WriteRune(c)
+				i++
+				c = runes[i]
+			}
+			word.WriteRune(c)
 		}
 	}
-
-	if buf.Len() > 0 {
-		tokens = append(tokens, buf.String())
+	if inWord && (blankOK || word.Len() > 0) {
+		words = append(words, word.String())
 	}
-	return tokens
+	return words
 }
 
 func ParseAssign(input string) (string, string) {
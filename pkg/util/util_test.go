@@ -2,6 +2,7 @@ package util_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coffeemakingtoaster/dockerfile-parser/pkg/util"
@@ -21,14 +22,99 @@ func TestAssignmentsParsing(t *testing.T) {
 }
 
 func TestAssignmentsParsingSpace(t *testing.T) {
+	// The legacy form assigns the rest of the line to the first key
 	input := "ABC def test \"test1 test2\" A ${SAMPLE:-placeholder}"
 	expected := map[string]string{
-		"ABC":  "def",
-		"test": "\"test1 test2\"",
-		"A":    "${SAMPLE:-placeholder}",
+		"ABC": "def test \"test1 test2\" A ${SAMPLE:-placeholder}",
 	}
 	actual := util.ParseAssigns(input)
 	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("Parsing result mismatch: Expected %v Got %v", expected, actual)
 	}
 }
+
+func TestSplitWords(t *testing.T) {
+	testCases := map[string][]string{
+		"A=\"x y\" B=z":          {"A=\"x y\"", "B=z"},
+		"  A=1\t B=2  ":          {"A=1", "B=2"},
+		"A='x \\' B=z":           {"A='x \\'", "B=z"},
+		"A=\"x \\\" y\" B=z":     {"A=\"x \\\" y\"", "B=z"},
+		"A=x\\ y B=z":            {"A=x\\ y", "B=z"},
+		"A=\"\" \"\"":            {"A=\"\"", "\"\""},
+		"A=x\\":                  {"A=x"},
+		"A=\"unterminated value": {"A=\"unterminated value"},
+	}
+	for input, expected := range testCases {
+		if actual := util.SplitWords(input, '\\'); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Word splitting mismatch for %q: Expected %q Got %q", input, expected, actual)
+		}
+	}
+	if actual := util.SplitWords("A=x` y B=\\", '`'); !reflect.DeepEqual([]string{"A=x` y", "B=\\"}, actual) {
+		t.Errorf("Word splitting mismatch: Expected %q Got %q", []string{"A=x` y", "B=\\"}, actual)
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected []util.Assign
+		Legacy   bool
+	}{
+		{
+			Input:    "Z=1 A=\"x y\" M='a b'",
+			Expected: []util.Assign{{Key: "Z", Value: "1", HasValue: true}, {Key: "A", Value: "\"x y\"", HasValue: true}, {Key: "M", Value: "'a b'", HasValue: true}},
+		},
+		{
+			Input:    "KEY some value  with spaces",
+			Expected: []util.Assign{{Key: "KEY", Value: "some value  with spaces", HasValue: true}},
+			Legacy:   true,
+		},
+		{
+			Input:    "KEY a=b",
+			Expected: []util.Assign{{Key: "KEY", Value: "a=b", HasValue: true}},
+			Legacy:   true,
+		},
+		{
+			Input:    "KEY",
+			Expected: []util.Assign{{Key: "KEY"}},
+			Legacy:   true,
+		},
+		{
+			Input:    "A=1 B",
+			Expected: []util.Assign{{Key: "A", Value: "1", HasValue: true}, {Key: "B"}},
+		},
+		{
+			Input:    "A= B=2",
+			Expected: []util.Assign{{Key: "A", Value: "", HasValue: true}, {Key: "B", Value: "2", HasValue: true}},
+		},
+	}
+	for _, c := range testCases {
+		actual, legacy := util.ParseKeyValues(c.Input, '\\')
+		if !reflect.DeepEqual(c.Expected, actual) {
+			t.Errorf("Parsing result mismatch for %q: Expected %v Got %v", c.Input, c.Expected, actual)
+		}
+		if legacy != c.Legacy {
+			t.Errorf("Legacy mismatch for %q: Expected %v Got %v", c.Input, c.Legacy, legacy)
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	long := strings.Repeat("x", 70*1024)
+	testCases := map[string][]string{
+		"a\nb\n":               {"a", "b"},
+		"a\r\nb":               {"a", "b"},
+		"\uFEFFa\r\n\r\nb\r\n": {"a", "", "b"},
+		"a\n" + long + "\n":    {"a", long},
+		"":                     {},
+	}
+	for input, expected := range testCases {
+		actual, err := util.ReadLines(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Reading failed: %s", err.Error())
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Lines mismatch for %.20q: Expected %d lines Got %d lines", input, len(expected), len(actual))
+		}
+	}
+}